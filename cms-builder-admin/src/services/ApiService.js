@@ -109,7 +109,7 @@ const apiService = ({ token }) => {
     try {
       const response = await executeApiCall({
         method: "POST",
-        relativePath: `private/api/${entity}/new`,
+        relativePath: `private/api/${entity}`,
         body,
       });
       return response.data;
@@ -122,7 +122,7 @@ const apiService = ({ token }) => {
     try {
       const response = await executeApiCall({
         method: "PUT",
-        relativePath: `private/api/${entity}/${instance.ID}/update`,
+        relativePath: `private/api/${entity}/${instance.ID}`,
         body,
       });
       return response;
@@ -135,7 +135,7 @@ const apiService = ({ token }) => {
     try {
       return await executeApiCall({
         method: "DELETE",
-        relativePath: `private/api/${resourceName}/${resourceId}/delete`,
+        relativePath: `private/api/${resourceName}/${resourceId}`,
       });
     } catch (error) {
       throw error;
@@ -0,0 +1,275 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/invopop/jsonschema"
+)
+
+type ActionScope string
+
+const (
+	ActionScopeCollection ActionScope = "collection" // The action runs on the App, e.g. /api/invoices/actions/export
+	ActionScopeRecord     ActionScope = "record"     // The action runs on a record, e.g. /api/invoices/{id}/actions/send
+)
+
+var actionNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ActionContext holds everything an action handler needs to run.
+type ActionContext struct {
+	App      *App
+	DB       *Database
+	Request  *http.Request
+	Params   *RequestParameters
+	Instance interface{} // The record the action runs on, nil for collection actions
+	Input    interface{} // The decoded request body, a pointer to a new value of the input schema type
+}
+
+// ActionHandler runs a custom action and returns the data sent back to the client.
+type ActionHandler func(ctx *ActionContext) (interface{}, error)
+
+// ActionError is an error returned by an action handler that sets the status code of the response.
+type ActionError struct {
+	Status  int
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return e.Message
+}
+
+// NewActionError creates an ActionError with the given status code and message.
+func NewActionError(status int, message string) *ActionError {
+	return &ActionError{Status: status, Message: message}
+}
+
+// Action is a custom operation exposed by an App besides the CRUD endpoints.
+type Action struct {
+	Name        string        `json:"name"`
+	Scope       ActionScope   `json:"scope"`
+	Handler     ActionHandler `json:"-"`
+	InputSchema interface{}   `json:"-"` // A struct value the request body is decoded into, nil if the action takes no input
+}
+
+// Permission returns the operation roles must be granted in the RolePermissionMap of the App
+// to run the action. It is the name of the action, which can't be a CRUD operation, see RegisterAction.
+func (ac *Action) Permission() CrudOperation {
+	return CrudOperation(ac.Name)
+}
+
+// Path returns the path of the action relative to the base route of the App.
+func (ac *Action) Path() string {
+	if ac.Scope == ActionScopeRecord {
+		return "/{id}/actions/" + ac.Name
+	}
+	return "/actions/" + ac.Name
+}
+
+// GetSchema returns the JSON schema of the input of the action, or nil if it takes no input.
+func (ac *Action) GetSchema() *jsonschema.Schema {
+	if ac.InputSchema == nil {
+		return nil
+	}
+	return jsonschema.Reflect(ac.InputSchema)
+}
+
+// RegisterAction adds a custom action to the App.
+//
+// The action is served with POST at /api/{app}/actions/{name} for collection actions and at
+// /api/{app}/{id}/actions/{name} for record actions. Only roles that have the name of the
+// action in the permissions of the App are allowed to run it.
+//
+// Parameters:
+// - name: the name of the action, in kebab case, e.g. "send-invoice".
+// - scope: whether the action runs on the App or on a record.
+// - handler: the function that runs the action.
+// - inputSchema: a struct value the request body is decoded into, or nil if the action takes no input.
+//
+// Returns:
+// - error: an error if the name is invalid or is a CRUD operation, e.g. "read", the scope is
+// unknown or the action is already registered.
+func (a *App) RegisterAction(name string, scope ActionScope, handler ActionHandler, inputSchema interface{}) error {
+	if !actionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid action name: %s", name)
+	}
+
+	// the permission of the action is its name, so it can't be one of the CRUD operations
+	for _, operation := range AllAllowedAccess {
+		if name == string(operation) {
+			return fmt.Errorf("action name is reserved: %s", name)
+		}
+	}
+
+	if scope != ActionScopeCollection && scope != ActionScopeRecord {
+		return fmt.Errorf("invalid action scope: %s", scope)
+	}
+
+	if handler == nil {
+		return fmt.Errorf("action %s has no handler", name)
+	}
+
+	if inputSchema != nil && reflect.Indirect(reflect.ValueOf(inputSchema)).Kind() != reflect.Struct {
+		return fmt.Errorf("input schema of action %s must be a struct", name)
+	}
+
+	if a.Actions == nil {
+		return fmt.Errorf("app %s is not registered", a.Name())
+	}
+
+	if _, ok := a.Actions[name]; ok {
+		return fmt.Errorf("action already registered: %s", name)
+	}
+
+	a.Actions[name] = &Action{
+		Name:        name,
+		Scope:       scope,
+		Handler:     handler,
+		InputSchema: inputSchema,
+	}
+
+	return nil
+}
+
+// GetAction returns the action of the App with the given name and scope.
+func (a *App) GetAction(name string, scope ActionScope) (*Action, error) {
+	action, ok := a.Actions[name]
+	if !ok || action.Scope != scope {
+		return nil, fmt.Errorf("action not found: %s", name)
+	}
+	return action, nil
+}
+
+// GetActions returns the actions of the App sorted by name.
+func (a *App) GetActions() []*Action {
+	actions := make([]*Action, 0, len(a.Actions))
+	for _, action := range a.Actions {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Name < actions[j].Name
+	})
+	return actions
+}
+
+// decodeActionInput decodes the request body into a new value of the input schema type.
+func decodeActionInput(r *http.Request, inputSchema interface{}) (interface{}, error) {
+	if inputSchema == nil {
+		return nil, nil
+	}
+
+	input := CreateInstanceForUndeterminedType(inputSchema)
+	if r.Body == nil {
+		return input, nil
+	}
+
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return input, nil
+}
+
+// ApiCollectionAction returns a handler function that runs the collection actions of the App,
+// e.g. /api/invoices/actions/{action}.
+func (a *App) ApiCollectionAction(db *Database) HandlerFunc {
+	return a.apiAction(db, ActionScopeCollection)
+}
+
+// ApiRecordAction returns a handler function that runs the record actions of the App,
+// e.g. /api/invoices/{id}/actions/{action}.
+func (a *App) ApiRecordAction(db *Database) HandlerFunc {
+	return a.apiAction(db, ActionScopeRecord)
+}
+
+func (a *App) apiAction(db *Database, scope ActionScope) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action, err := a.GetAction(GetUrlParam("action", r), scope)
+		if err != nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, err.Error())
+			return
+		}
+
+		params := FormatRequestParameters(r, a.Admin.Builder)
+
+		isAllowed := a.Permissions.HasPermission(params.Roles, action.Permission())
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to run this action")
+			return
+		}
+
+		ctx := &ActionContext{
+			App:     a,
+			DB:      db,
+			Request: r,
+			Params:  &params,
+		}
+
+		if scope == ActionScopeRecord {
+			instanceId := GetUrlParam("id", r)
+			instance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+			if instance == nil {
+				SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+				return
+			}
+			ctx.Instance = instance
+		}
+
+		ctx.Input, err = decodeActionInput(r, action.InputSchema)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		data, err := action.Handler(ctx)
+		if err != nil {
+			var actionErr *ActionError
+			if errors.As(err, &actionErr) {
+				SendJsonResponse(w, actionErr.Status, nil, actionErr.Message)
+				return
+			}
+			log.Error().Err(err).Str("action", action.Name).Msg("Error running action")
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, data, a.Name()+" "+action.Name+" done")
+	}
+}
+
+// ActionInfo describes an action in the schema and the API metadata.
+type ActionInfo struct {
+	Name       string             `json:"name"`
+	Scope      ActionScope        `json:"scope"`
+	Method     string             `json:"method"`
+	Path       string             `json:"path"`
+	Permission CrudOperation      `json:"permission"`
+	Input      *jsonschema.Schema `json:"input,omitempty"`
+}
+
+// GetActionsInfo returns the description of the actions of the App sorted by name.
+func (a *App) GetActionsInfo() []ActionInfo {
+	output := make([]ActionInfo, 0, len(a.Actions))
+	for _, action := range a.GetActions() {
+		output = append(output, ActionInfo{
+			Name:       action.Name,
+			Scope:      action.Scope,
+			Method:     http.MethodPost,
+			Path:       "/api/" + a.KebabPluralName() + action.Path(),
+			Permission: action.Permission(),
+			Input:      action.GetSchema(),
+		})
+	}
+	return output
+}
@@ -0,0 +1,88 @@
+package builder_test
+
+import (
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type RenameInput struct {
+	Field string `json:"field"`
+}
+
+// TestRecordAction tests that a record action is only run by roles with its permission, and
+// that it receives the record and the decoded input.
+func TestRecordAction(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	rename := func(ctx *builder.ActionContext) (interface{}, error) {
+		instance := ctx.Instance.(*th.MockStruct)
+		input := ctx.Input.(*RenameInput)
+		if input.Field == "" {
+			return nil, builder.NewActionError(http.StatusBadRequest, "field is required")
+		}
+
+		instance.Field = input.Field
+		res := ctx.DB.Save(instance, ctx.Params.User)
+		return instance, res.Error
+	}
+
+	err = e.App.RegisterAction("rename", builder.ActionScopeRecord, rename, RenameInput{})
+	assert.NoError(t, err, "RegisterAction should not return an error")
+
+	err = e.App.RegisterAction("rename", builder.ActionScopeRecord, rename, RenameInput{})
+	assert.Error(t, err, "RegisterAction should return an error for duplicated actions")
+
+	err = e.App.RegisterAction("Bad Name", builder.ActionScopeRecord, rename, nil)
+	assert.Error(t, err, "RegisterAction should return an error for invalid names")
+
+	err = e.App.RegisterAction("read", builder.ActionScopeRecord, rename, nil)
+	assert.Error(t, err, "RegisterAction should return an error for the names of the CRUD operations")
+
+	instance, user, userRollback := th.CreateMockResource(t, e.DB, e.App, nil)
+	defer userRollback()
+
+	vars := map[string]string{"id": instance.GetIDString(), "action": "rename"}
+
+	t.Log("Running the action without permission")
+	request, _, _ := th.NewRequest(http.MethodPost, `{"field": "renamed"}`, true, user, vars)
+	response, err := th.ExecuteApiCall(t, e.App.ApiRecordAction(e.DB), request, nil)
+	assert.NoError(t, err, "ApiRecordAction should not return an error")
+	assert.False(t, response.Success, "ApiRecordAction should fail without permission")
+
+	for _, role := range []builder.Role{builder.AdminRole, builder.VisitorRole} {
+		e.App.Permissions[role] = append(e.App.Permissions[role], "rename")
+	}
+
+	t.Log("Running the action on the wrong scope")
+	request, _, _ = th.NewRequest(http.MethodPost, `{"field": "renamed"}`, true, user, vars)
+	response, err = th.ExecuteApiCall(t, e.App.ApiCollectionAction(e.DB), request, nil)
+	assert.NoError(t, err, "ApiCollectionAction should not return an error")
+	assert.False(t, response.Success, "Record actions should not run as collection actions")
+
+	t.Log("Running the action with invalid input")
+	request, _, _ = th.NewRequest(http.MethodPost, `{}`, true, user, vars)
+	response, err = th.ExecuteApiCall(t, e.App.ApiRecordAction(e.DB), request, nil)
+	assert.NoError(t, err, "ApiRecordAction should not return an error")
+	assert.False(t, response.Success, "ApiRecordAction should fail with invalid input")
+	assert.Equal(t, "field is required", response.Message, "Message should come from the action error")
+
+	t.Log("Running the action")
+	request, _, _ = th.NewRequest(http.MethodPost, `{"field": "renamed"}`, true, user, vars)
+
+	var result th.MockStruct
+	response, err = th.ExecuteApiCall(t, e.App.ApiRecordAction(e.DB), request, &result)
+	assert.NoError(t, err, "ApiRecordAction should not return an error")
+	assert.True(t, response.Success, "ApiRecordAction should return a success response")
+	assert.Equal(t, instance.ID, result.ID, "ID should be the same")
+	assert.Equal(t, "renamed", result.Field, "Field should be renamed")
+
+	info := e.App.GetActionsInfo()
+	assert.Equal(t, 1, len(info), "There should be one action")
+	assert.Equal(t, "/api/mock-structs/{id}/actions/rename", info[0].Path, "Path should include the id")
+	assert.NotNil(t, info[0].Input, "Input schema should be published")
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/invopop/jsonschema"
+	"github.com/graphql-go/graphql"
 )
 
 var (
@@ -16,6 +18,11 @@ var (
 type Admin struct {
 	apps    map[string]App
 	Builder *Builder
+	mu      sync.RWMutex // mu guards apps, which can change while the server is running
+	version uint64       // version counts the changes of apps, guarded by mu
+
+	graphQLMu     sync.Mutex      // graphQLMu lets a single request build the GraphQL schema
+	graphQLSchema *graphql.Schema // built from the apps on the first GraphQL request
 }
 
 // NewAdmin creates a new instance of the Admin, which is a central
@@ -42,6 +49,9 @@ func NewAdmin(builder *Builder) *Admin {
 // - App: The App instance associated with the given name if found.
 // - error: An error if the App is not found.
 func (a *Admin) GetApp(appName string) (App, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	lowerAppName := strings.ToLower(appName)
 	if app, ok := a.apps[lowerAppName]; ok {
 		return app, nil
@@ -50,20 +60,54 @@ func (a *Admin) GetApp(appName string) (App, error) {
 	return App{}, fmt.Errorf("app not found: %s", appName)
 }
 
+// GetApps returns the registered apps sorted by name.
+//
+// The slice is a copy, so apps registered or unregistered afterwards do not change it.
+func (a *Admin) GetApps() []App {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	apps := make([]App, 0, len(a.apps))
+	for _, app := range a.apps {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name() < apps[j].Name()
+	})
+
+	return apps
+}
+
 // Register adds a new App to the Admin instance, applies database migration, and
 // registers API routes for CRUD operations.
 //
+// It can be called while the server is running, the routes are served right away.
+//
 // Parameters:
 // - model: The model to register.
 // - skipUserBinding: Whether to skip user binding which is used for filtering db queries by userId
 func (a *Admin) Register(model interface{}, skipUserBinding bool, permissions RolePermissionMap) (App, error) {
+	return a.register(a.newApp(model, skipUserBinding, permissions))
+}
 
-	app := App{
-		Model:           model,
-		SkipUserBinding: skipUserBinding,
-		Admin:           a,
-		Validators:      make(ValidatorsMap),
-		Permissions:     permissions,
+// newApp creates an App for the given model with the default API and empty configuration.
+func (a *Admin) newApp(model interface{}, skipUserBinding bool, permissions RolePermissionMap) App {
+	return App{
+		Model:              model,
+		SkipUserBinding:    skipUserBinding,
+		Admin:              a,
+		Validators:         make(ValidatorsMap),
+		Permissions:        permissions,
+		TranslatableFields: make(map[string]bool),
+		Slug:               &SlugConfig{},
+		Actions:            make(map[string]*Action),
+		Comments:           &CommentsConfig{},
+		Taxonomy:           &TaxonomyConfig{},
+		RichText:           make(map[string]*RichTextField),
+		Media:              make(map[string]*MediaField),
+		Sortable:           &SortableConfig{},
+		Tree:               &TreeConfig{},
+		Presentation:       &AdminConfig{},
 		Api: &API{
 			List:   DefaultList,
 			Detail: DefaultDetail,
@@ -72,29 +116,42 @@ func (a *Admin) Register(model interface{}, skipUserBinding bool, permissions Ro
 			Delete: DefaultDelete,
 		},
 	}
+}
+
+// register adds the given App to the Admin instance, applies database migration, and
+// registers its API routes.
+func (a *Admin) register(app App) (App, error) {
+	// check the app is not already registered and reserve the slot in the same lock,
+	// so two concurrent registrations of the same app can't both succeed
+	appName := strings.ToLower(app.Name())
 
-	// check the app is not already registered
-	_, err := a.GetApp(app.Name())
-	if err == nil {
-		// If app isn't found it will return an error, which means it doesn't exist
-		// In other words. We are expecting an error here. Error means slot is free for the new app
+	a.mu.Lock()
+	if _, ok := a.apps[appName]; ok {
+		a.mu.Unlock()
 		return App{}, fmt.Errorf("app already registered: %s", app.Name())
 	}
 
 	// register the app
-	appName := strings.ToLower(app.Name())
 	a.apps[appName] = app
+	a.version++
+	a.graphQLSchema = nil
+	a.mu.Unlock()
 
 	// apply migrations
 	a.Builder.DB.Migrate(app.Model)
 
-	// register CRUD routes
+	// register CRUD routes, the router is rebuilt once for all of them
+	a.Builder.Server.BeginUpdate()
+	defer a.Builder.Server.Commit()
 	a.registerAPIRoutes(app)
 
 	return app, nil
 }
 
-// Unregister removes the given app from the Admin instance.
+// Unregister removes the given app from the Admin instance, together with its API routes.
+//
+// It can be called while the server is running, the routes stop being served right away.
+// The database table is kept.
 //
 // If the app is not found, it returns an error.
 //
@@ -105,12 +162,20 @@ func (a *Admin) Register(model interface{}, skipUserBinding bool, permissions Ro
 // - error: An error if the app is not found.
 func (a *Admin) Unregister(appName string) error {
 
+	a.mu.Lock()
 	lowerAppName := strings.ToLower(appName)
-	if _, ok := a.apps[lowerAppName]; !ok {
+	app, ok := a.apps[lowerAppName]
+	if !ok {
+		a.mu.Unlock()
 		return fmt.Errorf("app not found: %s", appName)
 	}
 
 	delete(a.apps, lowerAppName)
+	a.version++
+	a.graphQLSchema = nil
+	a.mu.Unlock()
+
+	a.Builder.Server.RemoveRoutes("/api/" + app.KebabPluralName())
 	return nil
 }
 
@@ -122,12 +187,36 @@ func (a *Admin) Unregister(appName string) error {
 //
 // It registers the following API routes:
 //   - GET /{appName}: Returns a list of all App instances.
-//   - POST /{appName}/new: Creates a new App instance.
+//   - POST /{appName}: Creates a new App instance.
+//   - GET /{appName}/by-slug/{slug}: Returns the App instance with the given slug.
+//   - POST /{appName}/actions/{action}: Runs a collection action of the App.
+//   - POST /{appName}/{id}/actions/{action}: Runs a record action on the App instance with the given ID.
 //   - GET /{appName}/{id}: Returns the App instance with the given ID.
-//   - DELETE /{appName}/{id}/delete: Deletes the App instance with the given ID.
-//   - PUT /{appName}/{id}/update: Updates the App instance with the given ID.
+//   - PUT /{appName}/{id}: Updates the App instance with the given ID.
+//   - PATCH /{appName}/{id}: Updates the App instance with the given ID, same as PUT.
+//   - DELETE /{appName}/{id}: Deletes the App instance with the given ID.
+//   - GET /{appName}/{id}/revisions: Returns the history snapshots of the App instance.
+//   - GET /{appName}/{id}/revisions/diff: Returns the field differences between two snapshots.
+//   - POST /{appName}/{id}/revert/{historyId}: Restores the App instance to a previous snapshot.
+//   - GET /{appName}/translations/missing: Returns the translatable fields without a value per locale.
+//   - GET /{appName}/{id}/translations: Returns the translations of the App instance.
+//   - PUT /{appName}/{id}/translations/{locale}: Writes the translations of the App instance for a locale.
+//   - GET /{appName}/{id}/comments: Returns the comment threads of the App instance.
+//   - POST /{appName}/{id}/comments: Comments on the App instance.
+//   - PUT /{appName}/{id}/comments/{commentId}: Edits a comment of the user.
+//   - DELETE /{appName}/{id}/comments/{commentId}: Deletes a comment of the user.
+//   - GET /{appName}/{id}/tags: Returns the tags of the App instance.
+//   - PUT /{appName}/{id}/tags: Replaces the tags of the App instance.
+//   - GET /{appName}/{id}/categories: Returns the categories of the App instance.
+//   - PUT /{appName}/{id}/categories: Replaces the categories of the App instance.
+//   - POST /{appName}/reorder: Changes the manual order of the App instances.
+//   - GET /{appName}/{id}/children: Returns the children of the App instance.
+//   - GET /{appName}/{id}/descendants: Returns the subtree under the App instance.
+//   - GET /{appName}/{id}/ancestors: Returns the ancestors of the App instance, from the root.
 //
 // All CRUD routes are protected by authentication middleware.
+//
+// If the server keeps the legacy routes, the verb paths are served too, see registerLegacyRoutes.
 func (a *Admin) registerAPIRoutes(app App) {
 
 	kebabName := app.KebabPluralName()
@@ -138,7 +227,7 @@ func (a *Admin) registerAPIRoutes(app App) {
 	a.Builder.Server.AddRoute(
 		baseRoute+"/schema",
 		func(w http.ResponseWriter, r *http.Request) {
-			schema := jsonschema.Reflect(app.Model)
+			schema := app.GetSchema()
 			SendJsonResponse(w, http.StatusOK, schema, fmt.Sprintf("Schema for %s", app.Name()))
 		},
 		kebabName+"-schema",
@@ -157,7 +246,7 @@ func (a *Admin) registerAPIRoutes(app App) {
 	)
 
 	a.Builder.Server.AddRoute(
-		baseRoute+"/new",
+		baseRoute,
 		app.ApiCreate(a.Builder.DB),
 		kebabName+"-new",
 		protectedRoute,
@@ -165,6 +254,45 @@ func (a *Admin) registerAPIRoutes(app App) {
 		app.Model,
 	)
 
+	// needs to be registered before the {id} routes, otherwise "reorder" could be taken as an id
+	a.Builder.Server.AddRoute(
+		baseRoute+"/reorder",
+		app.ApiReorder(a.Builder.DB),
+		kebabName+"-reorder",
+		protectedRoute,
+		http.MethodPost,
+		ReorderInput{},
+	)
+
+	// needs to be registered before the {id} routes, otherwise slugs could be taken as ids
+	a.Builder.Server.AddRoute(
+		baseRoute+"/by-slug/{slug}",
+		app.ApiDetailBySlug(a.Builder.DB),
+		kebabName+"-get-by-slug",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	// needs to be registered before the {id} routes, otherwise "actions" could be taken as an id
+	a.Builder.Server.AddRoute(
+		baseRoute+"/actions/{action}",
+		app.ApiCollectionAction(a.Builder.DB),
+		kebabName+"-collection-action",
+		protectedRoute,
+		http.MethodPost,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/actions/{action}",
+		app.ApiRecordAction(a.Builder.DB),
+		kebabName+"-record-action",
+		protectedRoute,
+		http.MethodPost,
+		nil,
+	)
+
 	a.Builder.Server.AddRoute(
 		baseRoute+"/{id}",
 		app.ApiDetail(a.Builder.DB),
@@ -175,7 +303,25 @@ func (a *Admin) registerAPIRoutes(app App) {
 	)
 
 	a.Builder.Server.AddRoute(
-		baseRoute+"/{id}/delete",
+		baseRoute+"/{id}",
+		app.ApiUpdate(a.Builder.DB),
+		kebabName+"-update",
+		protectedRoute,
+		http.MethodPut,
+		app.Model,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}",
+		app.ApiUpdate(a.Builder.DB),
+		kebabName+"-patch",
+		protectedRoute,
+		http.MethodPatch,
+		app.Model,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}",
 		app.ApiDelete(a.Builder.DB),
 		kebabName+"-delete",
 		protectedRoute,
@@ -184,18 +330,195 @@ func (a *Admin) registerAPIRoutes(app App) {
 	)
 
 	a.Builder.Server.AddRoute(
-		baseRoute+"/{id}/update",
-		app.ApiUpdate(a.Builder.DB),
-		kebabName+"-update",
+		baseRoute+"/{id}/revisions",
+		app.ApiRevisions(a.Builder.DB),
+		kebabName+"-revisions",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/revisions/diff",
+		app.ApiRevisionsDiff(a.Builder.DB),
+		kebabName+"-revisions-diff",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/revert/{historyId}",
+		app.ApiRevert(a.Builder.DB),
+		kebabName+"-revert",
+		protectedRoute,
+		http.MethodPost,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/translations/missing",
+		app.ApiMissingTranslations(a.Builder.DB),
+		kebabName+"-translations-missing",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/translations",
+		app.ApiTranslations(a.Builder.DB),
+		kebabName+"-translations",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/translations/{locale}",
+		app.ApiUpdateTranslation(a.Builder.DB),
+		kebabName+"-translations-update",
 		protectedRoute,
 		http.MethodPut,
-		app.Model,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/comments",
+		app.ApiComments(a.Builder.DB),
+		kebabName+"-comments",
+		protectedRoute,
+		http.MethodGet,
+		nil,
 	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/comments",
+		app.ApiCreateComment(a.Builder.DB),
+		kebabName+"-comments-new",
+		protectedRoute,
+		http.MethodPost,
+		CommentInput{},
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/comments/{commentId}",
+		app.ApiUpdateComment(a.Builder.DB),
+		kebabName+"-comments-update",
+		protectedRoute,
+		http.MethodPut,
+		CommentInput{},
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/comments/{commentId}",
+		app.ApiDeleteComment(a.Builder.DB),
+		kebabName+"-comments-delete",
+		protectedRoute,
+		http.MethodDelete,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/tags",
+		app.ApiTags(a.Builder.DB),
+		kebabName+"-tags",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/tags",
+		app.ApiUpdateTags(a.Builder.DB),
+		kebabName+"-tags-update",
+		protectedRoute,
+		http.MethodPut,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/categories",
+		app.ApiCategories(a.Builder.DB),
+		kebabName+"-categories",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/categories",
+		app.ApiUpdateCategories(a.Builder.DB),
+		kebabName+"-categories-update",
+		protectedRoute,
+		http.MethodPut,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/children",
+		app.ApiChildren(a.Builder.DB),
+		kebabName+"-children",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/descendants",
+		app.ApiDescendants(a.Builder.DB),
+		kebabName+"-descendants",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	a.Builder.Server.AddRoute(
+		baseRoute+"/{id}/ancestors",
+		app.ApiAncestors(a.Builder.DB),
+		kebabName+"-ancestors",
+		protectedRoute,
+		http.MethodGet,
+		nil,
+	)
+
+	if a.Builder.Server.LegacyRoutes {
+		a.registerLegacyRoutes(app)
+	}
 }
 
-// AddApiRoute adds an endpoint that returns a JSON response with information about
-// all the registered apps, including their name, plural name, snake case name,
-// kebab case name, endpoints, and their respective HTTP methods.
+// registerLegacyRoutes registers the verb paths the routes of the App were served from,
+// kept for the clients that still use them:
+//   - POST /{appName}/new: Same as POST /{appName}.
+//   - PUT /{appName}/{id}/update: Same as PUT /{appName}/{id}.
+//   - DELETE /{appName}/{id}/delete: Same as DELETE /{appName}/{id}.
+//   - POST /{appName}/{id}/comments/new: Same as POST /{appName}/{id}/comments.
+//   - PUT /{appName}/{id}/comments/{commentId}/update: Same as PUT /{appName}/{id}/comments/{commentId}.
+//   - DELETE /{appName}/{id}/comments/{commentId}/delete: Same as DELETE /{appName}/{id}/comments/{commentId}.
+//   - PUT /{appName}/{id}/tags/update: Same as PUT /{appName}/{id}/tags.
+//   - PUT /{appName}/{id}/categories/update: Same as PUT /{appName}/{id}/categories.
+//
+// They are left out of the API documents and clients.
+func (a *Admin) registerLegacyRoutes(app App) {
+	kebabName := app.KebabPluralName()
+	baseRoute := "/api/" + kebabName
+
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/new", app.ApiCreate(a.Builder.DB), kebabName+"-new-legacy", true, http.MethodPost, app.Model)
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/update", app.ApiUpdate(a.Builder.DB), kebabName+"-update-legacy", true, http.MethodPut, app.Model)
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/delete", app.ApiDelete(a.Builder.DB), kebabName+"-delete-legacy", true, http.MethodDelete, nil)
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/comments/new", app.ApiCreateComment(a.Builder.DB), kebabName+"-comments-new-legacy", true, http.MethodPost, CommentInput{})
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/comments/{commentId}/update", app.ApiUpdateComment(a.Builder.DB), kebabName+"-comments-update-legacy", true, http.MethodPut, CommentInput{})
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/comments/{commentId}/delete", app.ApiDeleteComment(a.Builder.DB), kebabName+"-comments-delete-legacy", true, http.MethodDelete, nil)
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/tags/update", app.ApiUpdateTags(a.Builder.DB), kebabName+"-tags-update-legacy", true, http.MethodPut, nil)
+	a.Builder.Server.AddLegacyRoute(baseRoute+"/{id}/categories/update", app.ApiUpdateCategories(a.Builder.DB), kebabName+"-categories-update-legacy", true, http.MethodPut, nil)
+}
+
+// AddApiRoute adds the /api endpoint, the document clients such as cms-builder-admin build
+// their UI from. It describes every registered App: its names, its endpoints, the operations
+// the requesting user is allowed to perform, its validators, relations and custom actions.
+//
+// Paths are relative to the server, and the urls are built from the host the request was
+// sent to, so the document is right behind proxies and on any port.
 //
 // The structure of the response is as follows:
 //
@@ -209,12 +532,31 @@ func (a *Admin) registerAPIRoutes(app App) {
 //	  "snakePluralName": "string",
 //	  "kebabPluralName": "string",
 //	  "endpoints": {
-//	    "schema": {
-//	      "method": "string",
-//	      "path": "string",
+//	    "list": {
+//	      "method": "GET",
+//	      "path": "/private/api/posts",
+//	      "url": "https://example.com/private/api/posts",
+//	      "requiresAuth": true
 //	    },
 //	    // ... other endpoints ...
-//	  }
+//	  },
+//	  "operations": {"create": true, "read": true, "update": false, "delete": false},
+//	  "validators": {"email": ["required", "email"]},
+//	  "relations": [
+//	    {"field": "author", "type": "belongs_to", "app": "Author", "foreignKey": "authorId"}
+//	  ],
+//	  "actions": [
+//	    {
+//	      "name": "string",
+//	      "scope": "collection|record",
+//	      "method": "string",
+//	      "path": "string",
+//	      "permission": "string",
+//	      "input": { ... json schema ... }
+//	    }
+//	  ],
+//	  "features": {"comments": false, "sortable": true, ...},
+//	  "fields": {"title": {"translatable": true}}
 //	},
 //	// ... other apps ...
 //
@@ -225,40 +567,13 @@ func (a *Admin) AddApiRoute() {
 	s.AddRoute(
 		"/api",
 		func(w http.ResponseWriter, r *http.Request) {
-			type Endpoint struct {
-				Method string `json:"method"`
-				Path   string `json:"path"`
-			}
-			type appInfo struct {
-				Name        string              `json:"name"`
-				Plural      string              `json:"pluralName"`
-				Snake       string              `json:"snakeName"`
-				Kebab       string              `json:"kebabName"`
-				SnakePlural string              `json:"snakePluralName"`
-				KebabPlural string              `json:"kebabPluralName"`
-				Endpoints   map[string]Endpoint `json:"endpoints"`
-			}
-			output := make([]appInfo, 0)
-
-			for _, app := range s.Builder.Admin.apps {
-				baseUrl := config.GetString(EnvKeys.BaseUrl) + "/api/" + app.KebabPluralName()
-
-				data := appInfo{
-					Name:        app.Name(),
-					Plural:      app.PluralName(),
-					Snake:       app.SnakeName(),
-					Kebab:       app.KebabName(),
-					SnakePlural: app.SnakePluralName(),
-					KebabPlural: app.KebabPluralName(),
-					Endpoints: map[string]Endpoint{
-						"schema": {
-							Method: http.MethodGet,
-							Path:   baseUrl + "/schema",
-						},
-					},
-				}
-
-				output = append(output, data)
+			params := FormatRequestParameters(r, a.Builder)
+			baseUrl := GetRequestBaseUrl(r)
+			routes := s.GetRoutes()
+
+			output := make([]AppInfo, 0)
+			for _, app := range a.GetApps() {
+				output = append(output, app.GetInfo(routes, &params, baseUrl))
 			}
 
 			SendJsonResponse(w, http.StatusOK, output, "ok")
@@ -2,6 +2,7 @@ package builder
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -47,12 +48,6 @@ type API struct {
 var DefaultList ApiFunction = func(a *App, db *Database) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		err := ValidateRequestMethod(r, http.MethodGet)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
-			return
-		}
-
 		params := FormatRequestParameters(r, a.Admin.Builder)
 		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
 		if !isAllowed {
@@ -62,21 +57,30 @@ var DefaultList ApiFunction = func(a *App, db *Database) HandlerFunc {
 
 		limit, err := strconv.Atoi(GetQueryParam("limit", r))
 		if err != nil {
-			log.Error().Err(err).Msgf("Error converting limit")
+			GetRequestLogger(r).Error().Err(err).Msgf("Error converting limit")
 			limit = 10
 		}
 
 		page, err := strconv.Atoi(GetQueryParam("page", r))
 		if err != nil {
-			log.Error().Err(err).Msgf("Error converting page")
+			GetRequestLogger(r).Error().Err(err).Msgf("Error converting page")
 			page = 1
 		}
 
 		orderParam := GetQueryParam("order", r)
 		order, err := a.ValidateOrderParam(orderParam)
 		if err != nil {
-			log.Error().Err(err).Msgf("Error validating order")
-			log.Warn().Msg("Using default order")
+			GetRequestLogger(r).Error().Err(err).Msgf("Error validating order")
+			GetRequestLogger(r).Warn().Msg("Using default order")
+		}
+
+		// sortable apps are listed in their manual order
+		if order == "" && a.IsSortable() {
+			order, err = a.getSortableOrder(db)
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
 		}
 
 		// Create slice to store the model instances.
@@ -91,21 +95,37 @@ var DefaultList ApiFunction = func(a *App, db *Database) HandlerFunc {
 			Page:  page,
 			Limit: limit,
 		}
-		query := ""
+
+		// filter by ?search= and the list filters, the other conditions are appended with their
+		// arguments after them
+		query, args, err := a.ListFilters(db, r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		// filter by ?tag= and ?category=
+		taxonomyQuery, taxonomyArgs, err := a.TaxonomyFilter(db, r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		query = JoinQueries(query, taxonomyQuery)
+		args = append(args, taxonomyArgs...)
 
 		if a.SkipUserBinding {
 			// Admin
 			for _, role := range params.Roles {
 				if role == AdminRole {
-					db.Find(instances, query, pagination, order)
-					SendJsonResponseWithPagination(w, http.StatusOK, instances, a.Name()+" list", pagination)
+					db.Find(instances, query, pagination, order, args...)
+					a.SendLocalizedJsonResponse(w, r, db, instances, a.Name()+" list", pagination)
 					return
 				}
 			}
 
-			response := db.Find(instances, query, pagination, order)
+			response := db.Find(instances, query, pagination, order, args...)
 			if response.Error != nil {
-				log.Error().Err(response.Error).Msgf("Error finding instances")
+				GetRequestLogger(r).Error().Err(response.Error).Msgf("Error finding instances")
 				SendJsonResponse(w, http.StatusInternalServerError, nil, response.Error.Error())
 				return
 			}
@@ -114,32 +134,26 @@ var DefaultList ApiFunction = func(a *App, db *Database) HandlerFunc {
 			// Admin
 			for _, role := range params.Roles {
 				if role == AdminRole {
-					db.Find(instances, "", pagination, order)
-					SendJsonResponseWithPagination(w, http.StatusOK, instances, a.Name()+" list", pagination)
+					db.Find(instances, query, pagination, order, args...)
+					a.SendLocalizedJsonResponse(w, r, db, instances, a.Name()+" list", pagination)
 					return
 				}
 			}
 
-			query = "created_by_id = '" + params.RequestedById + "'"
-			res := db.Find(instances, query, pagination, order)
+			query = JoinQueries(query, "created_by_id = '"+params.RequestedById+"'")
+			res := db.Find(instances, query, pagination, order, args...)
 			if res.Error != nil {
 				SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
 				return
 			}
 		}
 
-		SendJsonResponseWithPagination(w, http.StatusOK, instances, a.Name()+" list", pagination)
+		a.SendLocalizedJsonResponse(w, r, db, instances, a.Name()+" list", pagination)
 	}
 }
 
 var DefaultDetail ApiFunction = func(a *App, db *Database) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := ValidateRequestMethod(r, http.MethodGet)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, err, err.Error())
-			return
-		}
-
 		params := FormatRequestParameters(r, a.Admin.Builder)
 		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
 		if !isAllowed {
@@ -150,6 +164,7 @@ var DefaultDetail ApiFunction = func(a *App, db *Database) HandlerFunc {
 		// Create a new instance of the model
 		instanceId := GetUrlParam("id", r)
 		var instance interface{}
+		var err error
 		if a.SkipUserBinding {
 			instance = CreateInstanceForUndeterminedType(a.Model)
 
@@ -174,18 +189,12 @@ var DefaultDetail ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
-		SendJsonResponse(w, http.StatusOK, instance, a.Name()+" detail")
+		a.SendLocalizedJsonResponse(w, r, db, instance, a.Name()+" detail", nil)
 	}
 }
 
 var DefaultCreate ApiFunction = func(a *App, db *Database) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := ValidateRequestMethod(r, http.MethodPost)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
-			return
-		}
-
 		params := FormatRequestParameters(r, a.Admin.Builder)
 		isAllowed := a.Permissions.HasPermission(params.Roles, OperationCreate)
 		if !isAllowed {
@@ -205,7 +214,7 @@ var DefaultCreate ApiFunction = func(a *App, db *Database) HandlerFunc {
 
 		bodyBytes, err := json.Marshal(body)
 		if err != nil {
-			log.Error().Err(err).Msg("Error marshalling request body")
+			GetRequestLogger(r).Error().Err(err).Msg("Error marshalling request body")
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
@@ -217,8 +226,39 @@ var DefaultCreate ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
+		err = a.PrepareSlug(db, instance, "")
+		if err != nil {
+			GetRequestLogger(r).Error().Err(err).Msg("Error generating slug")
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = a.PrepareRichText(db, instance, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		err = a.PreparePosition(db, instance, false)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = a.PrepareTree(db, instance, "", nil, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
 		// Run validations
 		validationErrors := a.Validate(instance)
+		mediaErrors, err := a.ValidateMedia(db, instance, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		validationErrors.Errors = append(validationErrors.Errors, mediaErrors...)
 		if len(validationErrors.Errors) > 0 {
 			SendJsonResponse(w, http.StatusBadRequest, validationErrors, "Validation failed")
 			return
@@ -230,18 +270,18 @@ var DefaultCreate ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
-		SendJsonResponse(w, http.StatusCreated, &instance, a.Name()+" created")
+		output, err := a.RenderRecords(db, instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusCreated, output, a.Name()+" created")
 	}
 }
 
 var DefaultUpdate ApiFunction = func(a *App, db *Database) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := ValidateRequestMethod(r, http.MethodPut)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
-			return
-		}
-
 		params := FormatRequestParameters(r, a.Admin.Builder)
 
 		isAllowed := a.Permissions.HasPermission(params.Roles, OperationUpdate)
@@ -276,15 +316,70 @@ var DefaultUpdate ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
+		previousSlug := a.GetSlug(instance)
+		previousGroup, err := a.GetGroup(instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		var previousNode TreeNode
+		if a.IsTree() {
+			node, err := GetTreeNode(instance)
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+			previousNode = *node
+		}
+
 		err = json.Unmarshal(bodyBytes, instance)
 		if err != nil {
-			log.Error().Err(err).Msg("Error unmarshalling request body")
+			GetRequestLogger(r).Error().Err(err).Msg("Error unmarshalling request body")
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
 
+		err = a.PrepareSlug(db, instance, instanceId)
+		if err != nil {
+			GetRequestLogger(r).Error().Err(err).Msg("Error generating slug")
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = a.PrepareRichText(db, instance, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		group, err := a.GetGroup(instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		// records moved to another group go to its end
+		err = a.PreparePosition(db, instance, !sameGroup(previousGroup, group))
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = a.PrepareTree(db, instance, instanceId, &previousNode, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
 		// Run validations
 		validationErrors := a.Validate(instance)
+		mediaErrors, err := a.ValidateMedia(db, instance, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		validationErrors.Errors = append(validationErrors.Errors, mediaErrors...)
 		if len(validationErrors.Errors) > 0 {
 			response, err := json.Marshal(validationErrors)
 
@@ -297,26 +392,43 @@ var DefaultUpdate ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
-		// Update the record in the database
-		res := db.Save(instance, params.User)
-		if res.Error != nil {
-			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+		// Update the record in the database, records moved to another parent take their subtree with them
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			txDb := &Database{DB: tx}
+
+			res := txDb.Save(instance, params.User)
+			if res == nil {
+				return fmt.Errorf("error updating %s", a.Name())
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+
+			return a.MoveSubtree(txDb, instance, previousNode.TreePath, previousNode.Depth)
+		})
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = a.SaveSlugHistory(db, instanceId, previousSlug, a.GetSlug(instance), params.User)
+		if err != nil {
+			GetRequestLogger(r).Error().Err(err).Msg("Error saving slug history")
+		}
+
+		output, err := a.RenderRecords(db, instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
 
-		SendJsonResponse(w, http.StatusOK, instance, a.Name()+" updated")
+		SendJsonResponse(w, http.StatusOK, output, a.Name()+" updated")
 	}
 }
 
 var DefaultDelete ApiFunction = func(a *App, db *Database) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		err := ValidateRequestMethod(r, http.MethodDelete)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
-			return
-		}
-
 		params := FormatRequestParameters(r, a.Admin.Builder)
 		isAllowed := a.Permissions.HasPermission(params.Roles, OperationDelete)
 		if !isAllowed {
@@ -336,9 +448,45 @@ var DefaultDelete ApiFunction = func(a *App, db *Database) HandlerFunc {
 			return
 		}
 
-		res := db.Delete(instance, params.User)
-		if res.Error != nil {
-			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+		// the children are deleted or re-parented along with the record
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			txDb := &Database{DB: tx}
+
+			err := a.DeleteSubtree(txDb, instance, &params)
+			if err != nil {
+				return err
+			}
+
+			res := txDb.Delete(instance, params.User)
+			if res == nil {
+				return fmt.Errorf("error deleting %s", a.Name())
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+
+			err = a.DeleteTranslations(txDb, []string{instanceId})
+			if err != nil {
+				return err
+			}
+
+			return a.DeleteTerms(txDb, []string{instanceId})
+		})
+		if err != nil {
+			var inUse *MediaInUseError
+			if errors.As(err, &inUse) {
+				SendJsonResponse(w, http.StatusConflict, inUse.References, inUse.Error())
+				return
+			}
+			if errors.Is(err, ErrSubtreeNotOwned) {
+				SendJsonResponse(w, http.StatusForbidden, nil, err.Error())
+				return
+			}
+			if errors.Is(err, ErrCategoryHasChildren) || errors.Is(err, ErrContentTypeHasEntries) {
+				SendJsonResponse(w, http.StatusConflict, nil, err.Error())
+				return
+			}
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
 
@@ -384,17 +532,28 @@ func GetInstanceIfAuthorized(model interface{}, skipUserBinding bool, instanceId
 }
 
 type App struct {
-	Model           interface{}       // The model struct
-	SkipUserBinding bool              // Means that theres a CreatedBy field in the model that will be used for filtering the database query to only include records created by the user
-	Admin           *Admin            // The admin instance
-	Validators      ValidatorsMap     // A map of field names to validation functions
-	Permissions     RolePermissionMap // Key is Role name, value is permission
-	Api             *API              // The API struct
+	Model              interface{}               // The model struct
+	SkipUserBinding    bool                      // Means that theres a CreatedBy field in the model that will be used for filtering the database query to only include records created by the user
+	Admin              *Admin                    // The admin instance
+	Validators         ValidatorsMap             // A map of field names to validation functions
+	Permissions        RolePermissionMap         // Key is Role name, value is permission
+	Api                *API                      // The API struct
+	TranslatableFields map[string]bool           // Set of field names whose values can be stored per locale
+	Slug               *SlugConfig               // Slug field configuration, see RegisterSlugField
+	Actions            map[string]*Action        // Custom actions by name, see RegisterAction
+	ContentType        *ContentType              // Definition of the model for Apps defined at runtime, see RegisterContentType
+	Comments           *CommentsConfig           // Whether the records can be commented, see EnableComments
+	Taxonomy           *TaxonomyConfig           // Whether the records can be tagged and categorized, see EnableTags and EnableCategories
+	RichText           map[string]*RichTextField // Rich text fields by JSON name, see RegisterRichTextField
+	Media              map[string]*MediaField    // Media fields by JSON name, see RegisterMediaField
+	Sortable           *SortableConfig           // Position field configuration, see EnableSorting
+	Tree               *TreeConfig               // Whether the records can be nested, see EnableTree
+	Presentation       *AdminConfig              // How the admin UI presents the records, see SetAdminConfig
 }
 
 // Name returns the name of the model as a string, lowercased and without the package name.
 func (a *App) Name() string {
-	return GetStructName(a.Model)
+	return GetResourceName(a.Model)
 }
 
 // PluralName returns the plural form of the name of the model as a string.
@@ -539,6 +698,10 @@ func (a *App) Validate(instance interface{}) ValidationResult {
 // - string: a valid order string for the given model, or an empty string if the orderParam is empty.
 // - error: an error if one of the fields in the orderParam is not found in the model.
 func (a *App) ValidateOrderParam(orderParam string) (string, error) {
+	if orderParam == "" {
+		orderParam = a.GetDefaultOrder()
+	}
+
 	if orderParam == "" {
 		return "", nil
 	}
@@ -688,3 +851,112 @@ func CreateSliceForUndeterminedType(model interface{}) (interface{}, error) {
 
 	return entities, nil
 }
+
+// findFieldIndexByJsonName returns the index path of the struct field whose JSON name
+// matches the given name (case-insensitive). Embedded structs without a JSON name are
+// searched as well, the same way encoding/json flattens them.
+func findFieldIndexByJsonName(t reflect.Type, name string) ([]int, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && tag == "" {
+			if index, ok := findFieldIndexByJsonName(f.Type, name); ok {
+				return append([]int{i}, index...), true
+			}
+			continue
+		}
+
+		jsonName := tag
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+
+		if strings.EqualFold(jsonName, name) {
+			return []int{i}, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetStructFieldByJsonName returns the struct field of the model whose JSON name matches the given name.
+//
+// Parameters:
+// - model: a struct or a pointer to a struct.
+// - name: the JSON name of the field.
+//
+// Returns:
+// - reflect.StructField: the struct field.
+// - error: an error if the field is not found in the model.
+func GetStructFieldByJsonName(model interface{}, name string) (reflect.StructField, error) {
+	t := reflect.TypeOf(model)
+	index, ok := findFieldIndexByJsonName(t, name)
+	if !ok {
+		return reflect.StructField{}, fmt.Errorf("field %s not found in model", name)
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.FieldByIndex(index), nil
+}
+
+// GetFieldValueByJsonName returns the value of the field of the given instance whose JSON
+// name matches the given name. Nil embedded pointers are allocated on the way, so the
+// returned value can be set.
+//
+// Parameters:
+// - instance: a pointer to a struct.
+// - name: the JSON name of the field.
+//
+// Returns:
+// - reflect.Value: the value of the field.
+// - error: an error if the instance is not a pointer to a struct or the field is not found.
+func GetFieldValueByJsonName(instance interface{}, name string) (reflect.Value, error) {
+	v := reflect.ValueOf(instance)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, fmt.Errorf("instance is nil")
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct || !v.CanAddr() {
+		return reflect.Value{}, fmt.Errorf("instance must be a pointer to a struct")
+	}
+
+	index, ok := findFieldIndexByJsonName(v.Type(), name)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("field %s not found in model", name)
+	}
+
+	for i, idx := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					if !v.CanSet() {
+						return reflect.Value{}, fmt.Errorf("field %s belongs to an unexported embedded struct", name)
+					}
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(idx)
+	}
+
+	return v, nil
+}
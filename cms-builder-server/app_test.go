@@ -73,17 +73,29 @@ func TestRegisterAPIRoutes(t *testing.T) {
 	// check ig server has expected routs
 	expectedRoutes := []builder.RouteHandler{
 		builder.NewRouteHandler("/api/two-words", handler, "two-words-list", true, http.MethodGet, nil),
-		builder.NewRouteHandler("/api/two-words/new", handler, "two-words-new", true, http.MethodPost, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words", handler, "two-words-new", true, http.MethodPost, TwoWords{}),
 		builder.NewRouteHandler("/api/two-words/{id}", handler, "two-words-get", true, http.MethodGet, nil),
-		builder.NewRouteHandler("/api/two-words/{id}/delete", handler, "two-words-delete", true, http.MethodDelete, nil),
-		builder.NewRouteHandler("/api/two-words/{id}/update", handler, "two-words-update", true, http.MethodPut, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words/{id}", handler, "two-words-delete", true, http.MethodDelete, nil),
+		builder.NewRouteHandler("/api/two-words/{id}", handler, "two-words-update", true, http.MethodPut, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words/{id}", handler, "two-words-patch", true, http.MethodPatch, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words/new", handler, "two-words-new-legacy", true, http.MethodPost, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words/{id}/delete", handler, "two-words-delete-legacy", true, http.MethodDelete, nil),
+		builder.NewRouteHandler("/api/two-words/{id}/update", handler, "two-words-update-legacy", true, http.MethodPut, TwoWords{}),
+		builder.NewRouteHandler("/api/two-words/{id}/comments", handler, "two-words-comments-new", true, http.MethodPost, builder.CommentInput{}),
+		builder.NewRouteHandler("/api/two-words/{id}/comments/{commentId}", handler, "two-words-comments-update", true, http.MethodPut, builder.CommentInput{}),
+		builder.NewRouteHandler("/api/two-words/{id}/comments/{commentId}", handler, "two-words-comments-delete", true, http.MethodDelete, nil),
+		builder.NewRouteHandler("/api/two-words/{id}/tags", handler, "two-words-tags-update", true, http.MethodPut, nil),
+		builder.NewRouteHandler("/api/two-words/{id}/categories", handler, "two-words-categories-update", true, http.MethodPut, nil),
+		builder.NewRouteHandler("/api/two-words/{id}/comments/new", handler, "two-words-comments-new-legacy", true, http.MethodPost, builder.CommentInput{}),
+		builder.NewRouteHandler("/api/two-words/{id}/tags/update", handler, "two-words-tags-update-legacy", true, http.MethodPut, nil),
+		builder.NewRouteHandler("/api/two-words/{id}/categories/update", handler, "two-words-categories-update-legacy", true, http.MethodPut, nil),
 	}
 
 	routes := e.Server.GetRoutes()
 	for _, expectedRoute := range expectedRoutes {
 		found := false
 		for _, route := range routes {
-			if route.Route == expectedRoute.Route {
+			if route.Route == expectedRoute.Route && route.Method == expectedRoute.Method {
 				assert.Equal(t, expectedRoute.Name, route.Name, "Route name should be the same")
 				assert.Equal(t, expectedRoute.RequiresAuth, route.RequiresAuth, "Route requires auth should be the same")
 				assert.Equal(t, expectedRoute.Schema, route.Schema, "Route schema should be the same")
@@ -701,3 +713,37 @@ func TestJsonifyInterfaceWithOmitempty(t *testing.T) {
 	assert.Equal(t, `{"field":"","omitted":""}`, string(bytes))
 
 }
+
+// TestGetFieldValueByJsonName tests that fields are found by their JSON name, including fields of embedded structs.
+func TestGetFieldValueByJsonName(t *testing.T) {
+	type Embedded struct {
+		Inner string `json:"inner"`
+	}
+	type reflectTest struct {
+		*Embedded
+		Field   string `json:"field"`
+		NoTag   string
+		Ignored string `json:"-"`
+	}
+
+	instance := &reflectTest{Field: "value", NoTag: "other"}
+
+	value, err := builder.GetFieldValueByJsonName(instance, "FIELD")
+	assert.NoError(t, err, "GetFieldValueByJsonName should not return an error")
+	assert.Equal(t, "value", value.String(), "Field should be found case-insensitively")
+
+	value, err = builder.GetFieldValueByJsonName(instance, "NoTag")
+	assert.NoError(t, err, "GetFieldValueByJsonName should not return an error")
+	assert.Equal(t, "other", value.String(), "Fields without tag should be found by name")
+
+	value, err = builder.GetFieldValueByJsonName(instance, "inner")
+	assert.NoError(t, err, "GetFieldValueByJsonName should not return an error")
+	value.SetString("set")
+	assert.Equal(t, "set", instance.Inner, "Embedded pointers should be allocated")
+
+	_, err = builder.GetFieldValueByJsonName(instance, "Ignored")
+	assert.Error(t, err, "Ignored fields should not be found")
+
+	_, err = builder.GetFieldValueByJsonName(*instance, "field")
+	assert.Error(t, err, "Non pointer instances should return an error")
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -22,7 +23,9 @@ var systemUser = User{
 // If the token is valid, it retrieves the user record from the database and returns it.
 // If the token is invalid, it returns an error.
 func (b *Builder) VerifyUser(userIdToken string) (*User, error) {
+	start := time.Now()
 	accessToken, err := b.Firebase.VerifyIDToken(context.Background(), userIdToken)
+	b.Metrics.observeFirebaseVerification(time.Since(start), err)
 	if err != nil {
 		log.Error().Err(err).Msg("Error verifying token")
 		return nil, err
@@ -65,7 +68,7 @@ func (b *Builder) AuthMiddleware(next http.Handler) http.Handler {
 		accessToken := GetAccessTokenFromRequest(r)
 		localUser, err := b.VerifyUser(accessToken)
 		if err != nil {
-			log.Error().Err(err).Msg("Error verifying user")
+			GetRequestLogger(r).Error().Err(err).Msg("Error verifying user")
 			SendJsonResponse(w, http.StatusUnauthorized, err, "Unauthorized")
 			return
 		}
@@ -80,14 +83,18 @@ func (b *Builder) AuthMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("auth", "true")
 		w.Header().Set("roles", localUser.Roles)
 
-		next.ServeHTTP(w, r)
+		// the middlewares and the handler of the route read the user from the context,
+		// instead of verifying the token again
+		setRequestUser(r, localUser)
+		ctx := context.WithValue(r.Context(), requestUserKey, localUser)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 // RegisterUserController handles the endpoint to register a new user. The endpoint
 // expects a POST request with a JSON body containing the name, email and password
 // of the user to register. The function will return a 400 error if the request body
-// is not valid JSON, or if the request method is not POST.
+// is not valid JSON.
 //
 // The function will also return a 500 error if there is an error registering the user
 // in Firebase, or if there is an error creating the user in the local database.
@@ -95,11 +102,6 @@ func (b *Builder) AuthMiddleware(next http.Handler) http.Handler {
 // The function will also set the requested_by header to the ID of the newly created
 // user.
 func (b *Builder) RegisterVisitorController(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		SendJsonResponse(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
-		return
-	}
-
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		msg := fmt.Sprintf("Error reading request body: %s", err.Error())
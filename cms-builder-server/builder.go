@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const builderVersion = "1.5.0"
@@ -25,6 +27,20 @@ type ConfigKeys struct {
 	DbUrl                 string `json:"dbUrl"`                 // Database URL
 	ServerHost            string `json:"serverHost"`            // Server host
 	ServerPort            string `json:"serverPort"`            // Server port
+	ServerShutdownTimeout string `json:"serverShutdownTimeout"` // Seconds the requests in flight have to finish when the server stops
+	ServerTlsCertFile     string `json:"serverTlsCertFile"`     // TLS certificate file, enables HTTPS and HTTP/2
+	ServerTlsKeyFile      string `json:"serverTlsKeyFile"`      // TLS private key file
+	ServerTlsMinVersion   string `json:"serverTlsMinVersion"`   // Minimum TLS version, e.g. 1.2
+	ServerTlsClientCaFile string `json:"serverTlsClientCaFile"` // CA file of the client certificates, enables mTLS
+	ServerRedirectPort    string `json:"serverRedirectPort"`    // Port of the HTTP listener redirecting to HTTPS
+	ServerLegacyRoutes    string `json:"serverLegacyRoutes"`    // Keep the verb paths of the Apps, e.g. /api/posts/new
+	ServerTrustedProxies  string `json:"serverTrustedProxies"`  // Comma-separated IPs and CIDRs of the proxies whose X-Forwarded-For is honored
+	RateLimitRegister     string `json:"rateLimitRegister"`     // Requests allowed to /auth/register per client, e.g. 10/1m, or off
+	RateLimitPrivate      string `json:"rateLimitPrivate"`      // Requests allowed to the /private routes per user, e.g. 300/1m, or off
+	RateLimitAuth         string `json:"rateLimitAuth"`         // Requests allowed to the /private routes and /graphql per IP before the token is verified, or off
+	MetricsEnabled        string `json:"metricsEnabled"`        // Serve the metrics in the Prometheus format at /metrics
+	GraphQLMaxDepth       string `json:"graphQLMaxDepth"`       // Levels of nested fields allowed in the GraphQL queries
+	GraphQLMaxComplexity  string `json:"graphQLMaxComplexity"`  // Fields a GraphQL query can return, counting each record of the pages
 	CsrfToken             string `json:"csrfToken"`             // CSRF token
 	FirebaseSecret        string `json:"firebaseSecret"`        // Firebase secret
 	FirebaseApiKey        string `json:"firebaseApiKey"`        // Firebase API key
@@ -38,6 +54,9 @@ type ConfigKeys struct {
 	AwsSecretAccessKey    string `json:"awsSecretAccessKey"`    // AWS secret access key
 	AwsAccessKeyId        string `json:"awsAccessKeyId"`        // AWS access key id
 	BaseUrl               string `json:"baseUrl"`               // where the app is running
+	DefaultLocale         string `json:"defaultLocale"`         // Locale of the values stored in the models
+	LocaleFallbacks       string `json:"localeFallbacks"`       // Comma-separated locales tried before the default locale
+	SupportedLocales      string `json:"supportedLocales"`      // Comma-separated locales editors are expected to translate
 }
 
 // EnvKeys are the keys used in the configuration file
@@ -57,6 +76,20 @@ var EnvKeys = ConfigKeys{
 	DbUrl:                 "DB_URL",
 	ServerHost:            "SERVER_HOST",
 	ServerPort:            "SERVER_PORT",
+	ServerShutdownTimeout: "SERVER_SHUTDOWN_TIMEOUT",
+	ServerTlsCertFile:     "SERVER_TLS_CERT_FILE",
+	ServerTlsKeyFile:      "SERVER_TLS_KEY_FILE",
+	ServerTlsMinVersion:   "SERVER_TLS_MIN_VERSION",
+	ServerTlsClientCaFile: "SERVER_TLS_CLIENT_CA_FILE",
+	ServerRedirectPort:    "SERVER_REDIRECT_PORT",
+	ServerLegacyRoutes:    "SERVER_LEGACY_ROUTES",
+	ServerTrustedProxies:  "SERVER_TRUSTED_PROXIES",
+	RateLimitRegister:     "RATE_LIMIT_REGISTER",
+	RateLimitPrivate:      "RATE_LIMIT_PRIVATE",
+	RateLimitAuth:         "RATE_LIMIT_AUTH",
+	MetricsEnabled:        "METRICS_ENABLED",
+	GraphQLMaxDepth:       "GRAPHQL_MAX_DEPTH",
+	GraphQLMaxComplexity:  "GRAPHQL_MAX_COMPLEXITY",
 	CsrfToken:             "CSRF_TOKEN",
 	FirebaseSecret:        "FIREBASE_SECRET",
 	FirebaseApiKey:        "FIREBASE_API_KEY",
@@ -70,6 +103,9 @@ var EnvKeys = ConfigKeys{
 	AwsSecretAccessKey:    "AWS_SECRET_ACCESS_KEY",
 	AwsAccessKeyId:        "AWS_ACCESS_KEY_ID",
 	BaseUrl:               "BASE_URL",
+	DefaultLocale:         "DEFAULT_LOCALE",
+	LocaleFallbacks:       "LOCALE_FALLBACKS",
+	SupportedLocales:      "SUPPORTED_LOCALES",
 }
 
 // defaultConfig defines the default values for the configuration
@@ -89,6 +125,20 @@ var DefaultEnvValues = ConfigKeys{
 	DbUrl:                 "",
 	ServerHost:            "0.0.0.0",
 	ServerPort:            "80",
+	ServerShutdownTimeout: "30",
+	ServerTlsCertFile:     "",
+	ServerTlsKeyFile:      "",
+	ServerTlsMinVersion:   DefaultTLSMinVersion,
+	ServerTlsClientCaFile: "",
+	ServerRedirectPort:    "",
+	ServerLegacyRoutes:    "true",
+	ServerTrustedProxies:  "",
+	RateLimitRegister:     "10/1m",
+	RateLimitPrivate:      "300/1m",
+	RateLimitAuth:         "600/1m",
+	MetricsEnabled:        "false",
+	GraphQLMaxDepth:       "10",
+	GraphQLMaxComplexity:  "1000",
 	CsrfToken:             "someToken",
 	FirebaseSecret:        "encoded64-token-thisIsGeneratedByEncodingFirebaseConfigFile",
 	FirebaseApiKey:        "apikeyProvidedByFirebaseClient",
@@ -102,6 +152,18 @@ var DefaultEnvValues = ConfigKeys{
 	AwsSecretAccessKey:    "secretAccessKey",
 	AwsAccessKeyId:        "accessKeyId",
 	BaseUrl:               "http://0.0.0.0:80",
+	DefaultLocale:         "en",
+	LocaleFallbacks:       "",
+	SupportedLocales:      "en",
+}
+
+// GetAppName returns the name of the app, used as the title of the API documents and clients.
+func GetAppName() string {
+	name := config.GetString(EnvKeys.AppName)
+	if name == "" {
+		name = DefaultEnvValues.AppName
+	}
+	return name
 }
 
 type BuilderErrors struct {
@@ -153,6 +215,11 @@ type Builder struct {
 	Server    *Server        // Reference to the created Server instance
 	Store     Store          // Reference to the created Store instance
 	Scheduler *Scheduler     // Reference to the created Scheduler instance
+	Metrics   *Metrics       // Reference to the created Metrics instance, nil if the metrics are disabled
+
+	ShutdownTimeout time.Duration // Time the requests in flight have to finish when the Builder stops, see Run
+	lifecycle       lifecycle     // Start and stop hooks, see OnStart and OnStop
+	openAPI         openAPICache  // OpenAPI document served by AddOpenAPIRoutes, see getCachedOpenAPI
 }
 
 // NewBuilderInput defines the input parameters for the Builder constructor.
@@ -209,6 +276,13 @@ func NewBuilder(input *NewBuilderInput) (*Builder, error) {
 		return nil, err
 	}
 
+	// Metrics
+	err = b.InitMetrics()
+	if err != nil {
+		log.Err(err).Msg("Error initializing metrics")
+		return nil, err
+	}
+
 	// Admin
 	b.InitAdmin()
 
@@ -219,6 +293,41 @@ func NewBuilder(input *NewBuilderInput) (*Builder, error) {
 		return nil, err
 	}
 
+	// Localization
+	err = b.InitLocalization()
+	if err != nil {
+		log.Err(err).Msg("Error initializing localization")
+		return nil, err
+	}
+
+	// Slugs
+	err = b.InitSlugs()
+	if err != nil {
+		log.Err(err).Msg("Error initializing slugs")
+		return nil, err
+	}
+
+	// Comments
+	err = b.InitComments()
+	if err != nil {
+		log.Err(err).Msg("Error initializing comments")
+		return nil, err
+	}
+
+	// Taxonomy
+	err = b.InitTaxonomy()
+	if err != nil {
+		log.Err(err).Msg("Error initializing taxonomy")
+		return nil, err
+	}
+
+	// Content types
+	err = b.InitContentTypes()
+	if err != nil {
+		log.Err(err).Msg("Error initializing content types")
+		return nil, err
+	}
+
 	// Firebase
 	err = b.InitFirebase()
 	if err != nil {
@@ -326,20 +435,98 @@ func (b *Builder) InitDatabase() error {
 
 // InitServer initializes the server based on the provided configuration.
 //
-// It takes the server host, port, and CSRF token from the environment variables and uses them to create a new server.
-// The server is assigned to the Builder instance.
+// It takes the server host, port, and CSRF token from the environment variables and uses them to create a new server,
+// served over HTTPS if a TLS certificate is configured.
+// The routes that require authentication are rate limited per user, see RATE_LIMIT_PRIVATE.
+// The server is assigned to the Builder instance, together with the time it has to stop, see Run.
 // If there is an error initializing the server, it returns the error. On success, it returns nil.
 func (b *Builder) InitServer() error {
-	server, err := NewServer(&ServerConfig{
-		Host:      config.GetString(EnvKeys.ServerHost),
-		Port:      config.GetString(EnvKeys.ServerPort),
-		CSRFToken: config.GetString(EnvKeys.CsrfToken),
-		Builder:   b,
-	})
+	legacyRoutes := config.GetString(EnvKeys.ServerLegacyRoutes)
+	if legacyRoutes == "" {
+		legacyRoutes = DefaultEnvValues.ServerLegacyRoutes
+	}
+
+	serverConfig := &ServerConfig{
+		Host:         config.GetString(EnvKeys.ServerHost),
+		Port:         config.GetString(EnvKeys.ServerPort),
+		CSRFToken:    config.GetString(EnvKeys.CsrfToken),
+		Builder:      b,
+		LegacyRoutes: legacyRoutes == "true",
+	}
+
+	// HTTPS is enabled by providing a certificate
+	if certFile := config.GetString(EnvKeys.ServerTlsCertFile); certFile != "" {
+		serverConfig.TLS = &TLSConfig{
+			CertFile:     certFile,
+			KeyFile:      config.GetString(EnvKeys.ServerTlsKeyFile),
+			MinVersion:   config.GetString(EnvKeys.ServerTlsMinVersion),
+			ClientCAFile: config.GetString(EnvKeys.ServerTlsClientCaFile),
+			RedirectPort: config.GetString(EnvKeys.ServerRedirectPort),
+		}
+	}
+
+	server, err := NewServer(serverConfig)
 	if err != nil {
 		return err
 	}
 	b.Server = server
+
+	// the clients are identified by the X-Forwarded-For header only behind these proxies
+	TrustedProxies, err = ParseTrustedProxies(config.GetString(EnvKeys.ServerTrustedProxies))
+	if err != nil {
+		return err
+	}
+
+	// every IP gets a bucket before the token is verified, so invalid tokens can't reach
+	// Firebase unthrottled
+	limit, ok, err := getConfigRateLimit(EnvKeys.RateLimitAuth, DefaultEnvValues.RateLimitAuth)
+	if err != nil {
+		return err
+	}
+	if ok {
+		server.AddPreAuthMiddleware(RateLimitMiddleware(RateLimitConfig{Name: "auth", Limit: limit, Key: RateLimitIPKey}))
+	}
+
+	// every user gets their own bucket for the routes that require authentication
+	limit, ok, err = getConfigRateLimit(EnvKeys.RateLimitPrivate, DefaultEnvValues.RateLimitPrivate)
+	if err != nil {
+		return err
+	}
+	if ok {
+		server.userRateLimit = RateLimitMiddleware(RateLimitConfig{Name: "private", Limit: limit})
+		server.AddPrivateMiddleware(server.userRateLimit)
+	}
+
+	if seconds := config.GetInt(EnvKeys.ServerShutdownTimeout); seconds > 0 {
+		b.ShutdownTimeout = time.Duration(seconds) * time.Second
+	}
+
+	return nil
+}
+
+// InitMetrics serves the metrics of the server, the database, the uploads, the scheduler and
+// the authentication at /metrics, in the Prometheus text format, if METRICS_ENABLED is true.
+// The metrics are disabled by default, and b.Metrics is nil.
+func (b *Builder) InitMetrics() error {
+	enabled := config.GetString(EnvKeys.MetricsEnabled)
+	if enabled == "" {
+		enabled = DefaultEnvValues.MetricsEnabled
+	}
+	if enabled != "true" {
+		return nil
+	}
+
+	metrics := NewMetrics()
+
+	err := metrics.registerDBCallbacks(b.DB)
+	if err != nil {
+		return err
+	}
+
+	b.Metrics = metrics
+	b.Server.Metrics = metrics
+	b.Server.AddRoute(MetricsRoute, metrics.Handler, "metrics", false, http.MethodGet, nil)
+
 	return nil
 }
 
@@ -371,7 +558,7 @@ func (b *Builder) InitFirebase() error {
 // It also registers two validators for the User model, EmailValidator and NameValidator.
 //
 // The route for user registration is added to the server with the name "register" and
-// the path "/auth/register".
+// the path "/auth/register", and it's rate limited per client, see RATE_LIMIT_REGISTER.
 //
 // If an error occurs while registering the User app, it logs the error and panics.
 func (b *Builder) InitAuth() error {
@@ -417,8 +604,17 @@ func (b *Builder) InitAuth() error {
 	// No user should be able to delete other users
 	// No user should be able to delete users, including himself
 
+	middlewares := make([]Middleware, 0)
+	limit, ok, err := getConfigRateLimit(EnvKeys.RateLimitRegister, DefaultEnvValues.RateLimitRegister)
+	if err != nil {
+		return err
+	}
+	if ok {
+		middlewares = append(middlewares, RateLimitMiddleware(RateLimitConfig{Name: "register", Limit: limit}))
+	}
+
 	svr := b.Server
-	svr.AddRoute("/auth/register", b.RegisterVisitorController, "register", false, http.MethodPost, RegisterUserInput{})
+	svr.AddRoute("/auth/register", b.RegisterVisitorController, "register", false, http.MethodPost, RegisterUserInput{}, middlewares...)
 	return nil
 }
 
@@ -477,6 +673,13 @@ func (b *Builder) InitUploader() error {
 		return err
 	}
 
+	// apply the delete policy of media fields whenever uploads are deleted
+	err = b.Admin.registerMediaDeleteCallback(b.DB)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering media delete callback")
+		return err
+	}
+
 	fdApp, err := b.Admin.Register(&FileData{}, false, permissions)
 	if err != nil {
 		log.Error().Err(err).Msg("Error registering FileData app")
@@ -513,6 +716,12 @@ func (b *Builder) InitUploader() error {
 		"list files",
 	)
 
+	// the body holds the file and the multipart envelope around it
+	maxSize := config.GetInt64(EnvKeys.UploaderMaxSize)
+	if maxSize <= 0 {
+		maxSize, _ = strconv.ParseInt(DefaultEnvValues.UploaderMaxSize, 10, 64)
+	}
+
 	// Add route for uploading new files
 	b.Server.AddRoute(
 		route+"/upload",
@@ -521,6 +730,7 @@ func (b *Builder) InitUploader() error {
 		true, // Requires authentication
 		http.MethodPost,
 		"form with file",
+		MaxBodySize((maxSize+1)<<20),
 	)
 
 	// Add route for deleting files by ID
@@ -625,3 +835,128 @@ func (b *Builder) InitHistory() error {
 
 	return nil
 }
+
+// InitLocalization registers the Translation app, which stores the values of translatable
+// fields for every locale other than the default one.
+func (b *Builder) InitLocalization() error {
+	permissions := RolePermissionMap{
+		AdminRole:   AllAllowedAccess,
+		VisitorRole: []CrudOperation{OperationRead},
+	}
+
+	_, err := b.Admin.Register(&Translation{}, false, permissions)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering translation app")
+		return err
+	}
+
+	return nil
+}
+
+// InitSlugs registers the SlugHistory app, which keeps previous slugs of the records
+// of Apps with a slug field, so old URLs keep resolving.
+func (b *Builder) InitSlugs() error {
+	permissions := RolePermissionMap{
+		AdminRole: []CrudOperation{OperationRead},
+	}
+
+	_, err := b.Admin.Register(&SlugHistory{}, false, permissions)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering slug history app")
+		return err
+	}
+
+	return nil
+}
+
+// InitComments registers the Comment app, which stores the comments left on the records
+// of Apps with comments enabled.
+func (b *Builder) InitComments() error {
+	permissions := RolePermissionMap{
+		AdminRole: []CrudOperation{OperationRead},
+	}
+
+	_, err := b.Admin.Register(&Comment{}, false, permissions)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering comment app")
+		return err
+	}
+
+	return nil
+}
+
+// InitTaxonomy registers the Tag and Category apps, which hold the vocabularies records of
+// any App can be labeled with, and the routes that report tag usage and the category tree.
+func (b *Builder) InitTaxonomy() error {
+	permissions := RolePermissionMap{
+		AdminRole:   AllAllowedAccess,
+		VisitorRole: []CrudOperation{OperationRead},
+	}
+
+	tagApp, err := b.Admin.Register(&Tag{}, true, permissions)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering tag app")
+		return err
+	}
+
+	err = tagApp.RegisterSlugField("slug", "name", false)
+	if err != nil {
+		return err
+	}
+
+	categoryApp, err := b.Admin.Register(&Category{}, true, permissions)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering category app")
+		return err
+	}
+
+	err = categoryApp.RegisterSlugField("slug", "name", false)
+	if err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{&ResourceTag{}, &ResourceCategory{}} {
+		err = b.DB.Migrate(model)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.Server.AddRoute("/api/taxonomy/tags/usage", b.Admin.ApiTagUsage(b.DB), "taxonomy-tags-usage", true, http.MethodGet, nil)
+	b.Server.AddRoute("/api/taxonomy/categories/tree", ApiCategoryTree(b.DB), "taxonomy-categories-tree", true, http.MethodGet, nil)
+
+	return nil
+}
+
+// InitContentTypes registers the ContentType app, where admins define models at runtime,
+// and an App for each content type stored in the database.
+func (b *Builder) InitContentTypes() error {
+	permissions := RolePermissionMap{
+		AdminRole: AllAllowedAccess,
+	}
+
+	err := b.DB.Migrate(&ContentEntry{})
+	if err != nil {
+		log.Error().Err(err).Msg("Error migrating content entries")
+		return err
+	}
+
+	// the Apps of the content types are reloaded after every change to their definitions
+	app := b.Admin.newApp(&ContentType{}, false, permissions)
+	app.Api.Create = reloadContentTypesAfter(DefaultCreate)
+	app.Api.Update = reloadContentTypesAfter(DefaultUpdate)
+	app.Api.Delete = reloadContentTypesAfter(DefaultDelete)
+
+	contentTypeApp, err := b.Admin.register(app)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering content type app")
+		return err
+	}
+
+	err = contentTypeApp.RegisterValidator("name", ValidatorsList{RequiredValidator, b.Admin.ContentTypeValidator})
+	if err != nil {
+		return err
+	}
+
+	return b.Admin.LoadContentTypes()
+}
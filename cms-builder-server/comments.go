@@ -0,0 +1,356 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mentions are written as @email, e.g. @jane@example.com, or as the part of the email
+// before the @, e.g. @jane, which only resolves if a single user matches it
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.+-])@([\w.+-]+(?:@[\w-]+(?:\.[\w-]+)+)?)`)
+
+// CommentsConfig defines whether the records of an App can be commented.
+type CommentsConfig struct {
+	Enabled bool
+}
+
+// Comment is a note left by a user on a record of an App. Comments can reply to other
+// comments of the same record, forming threads.
+type Comment struct {
+	*SystemData
+	ResourceName     string `gorm:"index:idx_comment" json:"resourceName"`
+	ResourceId       string `gorm:"index:idx_comment" json:"resourceId"`
+	ParentID         *uint  `json:"parentId"`
+	Body             string `json:"body"`
+	MentionedUserIds []uint `gorm:"serializer:json" json:"mentionedUserIds"`
+}
+
+// CommentThread is a comment together with its replies.
+type CommentThread struct {
+	Comment
+	Replies []*CommentThread `json:"replies"`
+}
+
+// CommentInput is the body of the requests that create or update a comment.
+type CommentInput struct {
+	Body     string `json:"body"`
+	ParentID *uint  `json:"parentId"`
+}
+
+// EnableComments allows users to comment on the records of the App.
+func (a *App) EnableComments() {
+	if a.Comments == nil {
+		a.Comments = &CommentsConfig{}
+	}
+	a.Comments.Enabled = true
+}
+
+// HasComments returns true if the records of the App can be commented.
+func (a *App) HasComments() bool {
+	return a.Comments != nil && a.Comments.Enabled
+}
+
+// ParseMentions returns the mentions found in the given text, without the leading @.
+func ParseMentions(text string) []string {
+	mentions := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		mention := strings.ToLower(strings.TrimRight(match[1], "."))
+		if mention == "" || seen[mention] {
+			continue
+		}
+		seen[mention] = true
+		mentions = append(mentions, mention)
+	}
+	return mentions
+}
+
+// ResolveMentions returns the IDs of the users mentioned in the given text.
+// Mentions that don't match a user, or that match more than one, are ignored.
+func ResolveMentions(db *Database, text string) ([]uint, error) {
+	ids := make([]uint, 0)
+	seen := make(map[uint]bool)
+
+	for _, mention := range ParseMentions(text) {
+		var users []User
+		q := db.DB.Model(&User{})
+		if strings.Contains(mention, "@") {
+			q = q.Where("LOWER(email) = ?", mention)
+		} else {
+			q = q.Where("LOWER(email) LIKE ?", mention+"@%")
+		}
+
+		err := q.Limit(2).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if len(users) != 1 || seen[users[0].ID] {
+			continue
+		}
+		seen[users[0].ID] = true
+		ids = append(ids, users[0].ID)
+	}
+
+	return ids, nil
+}
+
+// BuildCommentThreads nests the given comments under the comments they reply to.
+// Replies to comments that are not in the list are returned as top level comments.
+func BuildCommentThreads(comments []Comment) []*CommentThread {
+	threads := make(map[uint]*CommentThread, len(comments))
+	for _, comment := range comments {
+		threads[comment.ID] = &CommentThread{Comment: comment, Replies: make([]*CommentThread, 0)}
+	}
+
+	output := make([]*CommentThread, 0)
+	for _, comment := range comments {
+		thread := threads[comment.ID]
+		if comment.ParentID != nil {
+			if parent, ok := threads[*comment.ParentID]; ok && parent != thread {
+				parent.Replies = append(parent.Replies, thread)
+				continue
+			}
+		}
+		output = append(output, thread)
+	}
+
+	return output
+}
+
+// getCommentedInstance checks that the App has comments and the user can read the record in
+// the request. It sends the error response and returns false otherwise.
+func (a *App) getCommentedInstance(w http.ResponseWriter, r *http.Request, db *Database, params *RequestParameters) bool {
+	if !a.HasComments() {
+		SendJsonResponse(w, http.StatusNotFound, nil, a.Name()+" has no comments")
+		return false
+	}
+
+	isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+	if !isAllowed {
+		SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+		return false
+	}
+
+	instance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, GetUrlParam("id", r), db, params)
+	if err != nil {
+		SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+		return false
+	}
+	if instance == nil {
+		SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+		return false
+	}
+
+	return true
+}
+
+// getOwnComment returns the comment in the request if it belongs to the record and was written by
+// the user. It sends the error response and returns nil otherwise.
+func (a *App) getOwnComment(w http.ResponseWriter, r *http.Request, db *Database, params *RequestParameters) *Comment {
+	commentId, err := strconv.ParseUint(GetUrlParam("commentId", r), 10, 64)
+	if err != nil {
+		SendJsonResponse(w, http.StatusNotFound, nil, "Comment not found")
+		return nil
+	}
+
+	var comment Comment
+	res := db.DB.Where("resource_name = ? AND resource_id = ? AND id = ?", a.Name(), GetUrlParam("id", r), uint(commentId)).
+		Limit(1).
+		Find(&comment)
+	if res.Error != nil {
+		SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+		return nil
+	}
+	if res.RowsAffected == 0 {
+		SendJsonResponse(w, http.StatusNotFound, nil, "Comment not found")
+		return nil
+	}
+
+	if comment.CreatedByID != params.User.ID {
+		SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to change this comment")
+		return nil
+	}
+
+	return &comment
+}
+
+// readCommentInput reads the body of the request and checks it is not empty.
+func readCommentInput(r *http.Request) (CommentInput, error) {
+	var input CommentInput
+
+	body, err := ReadRequestBody(r)
+	if err != nil {
+		return input, err
+	}
+
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		return input, err
+	}
+
+	input.Body = strings.TrimSpace(input.Body)
+	if input.Body == "" {
+		return input, fmt.Errorf("body is required")
+	}
+
+	return input, nil
+}
+
+// ApiComments returns a handler function that responds to GET requests on the
+// comments endpoint, e.g. /api/posts/{id}/comments.
+//
+// The comments of the record are returned as threads, oldest first.
+func (a *App) ApiComments(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		if !a.getCommentedInstance(w, r, db, &params) {
+			return
+		}
+
+		var comments []Comment
+		err := db.DB.Where("resource_name = ? AND resource_id = ?", a.Name(), GetUrlParam("id", r)).
+			Order("id asc").
+			Find(&comments).Error
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, BuildCommentThreads(comments), a.Name()+" comments")
+	}
+}
+
+// ApiCreateComment returns a handler function that responds to POST requests on the
+// comments endpoint, e.g. /api/posts/{id}/comments.
+//
+// Users that can read the record can comment on it. Mentions in the body are resolved to users.
+func (a *App) ApiCreateComment(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		if !a.getCommentedInstance(w, r, db, &params) {
+			return
+		}
+
+		input, err := readCommentInput(r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+
+		if input.ParentID != nil {
+			var count int64
+			err = db.DB.Model(&Comment{}).
+				Where("id = ? AND resource_name = ? AND resource_id = ?", *input.ParentID, a.Name(), instanceId).
+				Count(&count).Error
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+			if count == 0 {
+				SendJsonResponse(w, http.StatusBadRequest, nil, "Parent comment not found")
+				return
+			}
+		}
+
+		mentions, err := ResolveMentions(db, input.Body)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		comment := Comment{
+			SystemData: &SystemData{
+				CreatedByID: params.User.ID,
+				UpdatedByID: params.User.ID,
+			},
+			ResourceName:     a.Name(),
+			ResourceId:       instanceId,
+			ParentID:         input.ParentID,
+			Body:             input.Body,
+			MentionedUserIds: mentions,
+		}
+
+		res := db.Create(&comment, params.User)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusCreated, &comment, "Comment created")
+	}
+}
+
+// ApiUpdateComment returns a handler function that responds to PUT requests on the
+// comment endpoint, e.g. /api/posts/{id}/comments/{commentId}.
+//
+// Users can only edit their own comments.
+func (a *App) ApiUpdateComment(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		if !a.getCommentedInstance(w, r, db, &params) {
+			return
+		}
+
+		comment := a.getOwnComment(w, r, db, &params)
+		if comment == nil {
+			return
+		}
+
+		input, err := readCommentInput(r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		mentions, err := ResolveMentions(db, input.Body)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		comment.Body = input.Body
+		comment.MentionedUserIds = mentions
+		comment.UpdatedByID = params.User.ID
+
+		res := db.Save(comment, params.User)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, comment, "Comment updated")
+	}
+}
+
+// ApiDeleteComment returns a handler function that responds to DELETE requests on the
+// comment endpoint, e.g. /api/posts/{id}/comments/{commentId}.
+//
+// Users can only delete their own comments. Replies to a deleted comment are kept.
+func (a *App) ApiDeleteComment(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		if !a.getCommentedInstance(w, r, db, &params) {
+			return
+		}
+
+		comment := a.getOwnComment(w, r, db, &params)
+		if comment == nil {
+			return
+		}
+
+		res := db.Delete(comment, params.User)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, nil, "Comment deleted")
+	}
+}
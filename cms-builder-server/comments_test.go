@@ -0,0 +1,112 @@
+package builder_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "no mentions",
+			text: "nothing to see here",
+			want: []string{},
+		},
+		{
+			name: "email and short mentions",
+			text: "@jane@example.com can you check with @Bob?",
+			want: []string{"jane@example.com", "bob"},
+		},
+		{
+			name: "emails are not mentions",
+			text: "write to bob@example.com",
+			want: []string{},
+		},
+		{
+			name: "duplicated mentions",
+			text: "@bob, @Bob and @bob.",
+			want: []string{"bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, builder.ParseMentions(tt.text))
+		})
+	}
+}
+
+// TestCommentsFollowRecordAccess tests that users can comment on records they can read, reply
+// to comments and edit their own comments, and that other users can't see or change them.
+func TestCommentsFollowRecordAccess(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	e.App.EnableComments()
+
+	instance, user, userRollback := th.CreateMockResource(t, e.DB, e.App, nil)
+	defer userRollback()
+
+	vars := map[string]string{"id": instance.GetIDString()}
+
+	t.Log("Commenting on the record")
+	request, _, _ := th.NewRequest(http.MethodPost, `{"body": "First"}`, true, user, vars)
+
+	var comment builder.Comment
+	response, err := th.ExecuteApiCall(t, e.App.ApiCreateComment(e.DB), request, &comment)
+	assert.NoError(t, err, "ApiCreateComment should not return an error")
+	assert.True(t, response.Success, "ApiCreateComment should return a success response")
+
+	t.Log("Replying to the comment")
+	body := fmt.Sprintf(`{"body": "Reply @%s", "parentId": %d}`, user.Email, comment.ID)
+	request, _, _ = th.NewRequest(http.MethodPost, body, true, user, vars)
+
+	var reply builder.Comment
+	response, err = th.ExecuteApiCall(t, e.App.ApiCreateComment(e.DB), request, &reply)
+	assert.NoError(t, err, "ApiCreateComment should not return an error")
+	assert.True(t, response.Success, "ApiCreateComment should return a success response")
+	assert.Equal(t, []uint{user.ID}, reply.MentionedUserIds, "Mention should resolve to the user")
+
+	t.Log("Listing the threads")
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, vars)
+
+	var threads []builder.CommentThread
+	response, err = th.ExecuteApiCall(t, e.App.ApiComments(e.DB), request, &threads)
+	assert.NoError(t, err, "ApiComments should not return an error")
+	assert.True(t, response.Success, "ApiComments should return a success response")
+	assert.Equal(t, 1, len(threads), "There should be one thread")
+	assert.Equal(t, 1, len(threads[0].Replies), "The thread should have one reply")
+
+	t.Log("Other users can't see the comments of records they can't read")
+	request, _, otherRollback := th.NewRequest(http.MethodGet, "", true, nil, vars)
+	defer otherRollback()
+
+	response, err = th.ExecuteApiCall(t, e.App.ApiComments(e.DB), request, nil)
+	assert.NoError(t, err, "ApiComments should not return an error")
+	assert.False(t, response.Success, "ApiComments should fail for other users")
+
+	t.Log("Editing the comment")
+	commentVars := map[string]string{"id": instance.GetIDString(), "commentId": fmt.Sprint(comment.ID)}
+	request, _, _ = th.NewRequest(http.MethodPut, `{"body": "Edited"}`, true, user, commentVars)
+
+	var edited builder.Comment
+	response, err = th.ExecuteApiCall(t, e.App.ApiUpdateComment(e.DB), request, &edited)
+	assert.NoError(t, err, "ApiUpdateComment should not return an error")
+	assert.True(t, response.Success, "ApiUpdateComment should return a success response")
+	assert.Equal(t, "Edited", edited.Body, "Body should be updated")
+
+	t.Log("Deleting the comment")
+	request, _, _ = th.NewRequest(http.MethodDelete, "", true, user, commentVars)
+	response, err = th.ExecuteApiCall(t, e.App.ApiDeleteComment(e.DB), request, nil)
+	assert.NoError(t, err, "ApiDeleteComment should not return an error")
+	assert.True(t, response.Success, "ApiDeleteComment should return a success response")
+}
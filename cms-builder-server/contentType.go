@@ -0,0 +1,834 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/invopop/jsonschema"
+	"gorm.io/gorm"
+)
+
+// ErrContentTypeHasEntries is returned when deleting a content type that has entries, which
+// have to be deleted first.
+var ErrContentTypeHasEntries = errors.New("content type has entries")
+
+type ContentFieldType string
+
+const (
+	ContentFieldString   ContentFieldType = "string"
+	ContentFieldText     ContentFieldType = "text"
+	ContentFieldNumber   ContentFieldType = "number"
+	ContentFieldInteger  ContentFieldType = "integer"
+	ContentFieldBoolean  ContentFieldType = "boolean"
+	ContentFieldDateTime ContentFieldType = "datetime"
+	ContentFieldRichText ContentFieldType = "richtext"
+	ContentFieldMarkdown ContentFieldType = "markdown"
+)
+
+var contentFieldTypes = map[ContentFieldType]bool{
+	ContentFieldString:   true,
+	ContentFieldText:     true,
+	ContentFieldNumber:   true,
+	ContentFieldInteger:  true,
+	ContentFieldBoolean:  true,
+	ContentFieldDateTime: true,
+	ContentFieldRichText: true,
+	ContentFieldMarkdown: true,
+}
+
+// ContentValidators are the validators content type fields can refer to by name.
+// Custom validators can be added before the content types are loaded.
+var ContentValidators = map[string]Validator{
+	"required": RequiredValidator,
+	"email":    EmailValidator,
+}
+
+var (
+	contentTypeNamePattern  = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	contentFieldNamePattern = regexp.MustCompile(`^[a-z][A-Za-z0-9_]*$`)
+
+	// keys used by the system data of the entries, they can't be used as field names
+	contentReservedFields = map[string]bool{
+		"id":          true,
+		"createdat":   true,
+		"updatedat":   true,
+		"deletedat":   true,
+		"createdbyid": true,
+		"createdby":   true,
+		"updatedbyid": true,
+		"updatedby":   true,
+		"contenttype": true,
+	}
+
+	// guards the reload of the content types, so concurrent changes don't register the same app twice
+	contentTypesMu sync.Mutex
+)
+
+// ContentField defines a field of a content type.
+type ContentField struct {
+	Name        string           `json:"name"`
+	Type        ContentFieldType `json:"type"`
+	Required    bool             `json:"required"`
+	Description string           `json:"description,omitempty"`
+	Validators  []string         `json:"validators,omitempty"` // Names of validators in ContentValidators
+}
+
+// ContentType is the definition of a model created at runtime, e.g. from the admin UI.
+//
+// Each content type is served as an App with the same routes as the Apps registered with
+// Go structs. Its records are stored as ContentEntry.
+type ContentType struct {
+	*SystemData
+	Name            string            `gorm:"index" json:"name"`
+	Description     string            `json:"description"`
+	Fields          []ContentField    `gorm:"serializer:json" json:"fields"`
+	Permissions     RolePermissionMap `gorm:"serializer:json" json:"permissions"`
+	SkipUserBinding bool              `json:"skipUserBinding"`
+}
+
+// ContentEntry is a record of a content type. The values of the fields are stored as JSON.
+//
+// It is serialized as a flat object, the values of the fields are next to the system data,
+// so it looks the same as a record of an App registered with a Go struct.
+type ContentEntry struct {
+	*SystemData
+	ContentType string                 `gorm:"index" json:"contentType"`
+	Data        map[string]interface{} `gorm:"serializer:json" json:"-"`
+}
+
+// ResourceName returns the name of the content type of the entry, so history and Apps use it
+// instead of the name of the struct.
+func (e ContentEntry) ResourceName() string {
+	return e.ContentType
+}
+
+// MarshalJSON serializes the entry as the system data and the values of its fields in a single object.
+func (e ContentEntry) MarshalJSON() ([]byte, error) {
+	output := make(map[string]interface{})
+
+	if e.SystemData != nil {
+		systemData, err := JsonifyInterface(e.SystemData)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range systemData {
+			output[key] = value
+		}
+	}
+
+	for key, value := range e.Data {
+		output[key] = value
+	}
+
+	output["contentType"] = e.ContentType
+
+	return json.Marshal(output)
+}
+
+// GetField returns the definition of the field with the given name.
+func (ct *ContentType) GetField(name string) (ContentField, bool) {
+	for _, field := range ct.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return ContentField{}, false
+}
+
+// Validate checks the name and the fields of the content type.
+func (ct *ContentType) Validate() error {
+	if !contentTypeNamePattern.MatchString(ct.Name) {
+		return fmt.Errorf("invalid content type name %q, it must be in PascalCase", ct.Name)
+	}
+
+	names := make(map[string]bool)
+	for _, field := range ct.Fields {
+		if !contentFieldNamePattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q, it must be in camelCase", field.Name)
+		}
+
+		lowerName := strings.ToLower(field.Name)
+		if contentReservedFields[lowerName] {
+			return fmt.Errorf("field name %q is reserved", field.Name)
+		}
+		if names[lowerName] {
+			return fmt.Errorf("field %q is duplicated", field.Name)
+		}
+		names[lowerName] = true
+
+		if !contentFieldTypes[field.Type] {
+			return fmt.Errorf("field %q has an invalid type %q", field.Name, field.Type)
+		}
+
+		for _, validator := range field.Validators {
+			if _, ok := ContentValidators[validator]; !ok {
+				return fmt.Errorf("field %q has an unknown validator %q", field.Name, validator)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetValidators returns the validators of the fields of the content type, keyed by field name.
+func (ct *ContentType) GetValidators() ValidatorsMap {
+	validators := make(ValidatorsMap)
+	for _, field := range ct.Fields {
+		key := strings.ToLower(field.Name)
+		if field.Required {
+			validators[key] = append(validators[key], RequiredValidator)
+		}
+		for _, name := range field.Validators {
+			if name == "required" && field.Required {
+				continue
+			}
+			if validator, ok := ContentValidators[name]; ok {
+				validators[key] = append(validators[key], validator)
+			}
+		}
+	}
+	return validators
+}
+
+// BeforeDelete prevents a content type with entries from being deleted, so the entries are
+// not left behind to come back under a new content type with the same name.
+func (ct *ContentType) BeforeDelete(tx *gorm.DB) error {
+	if ct.Name == "" {
+		return nil
+	}
+
+	var entries int64
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(&ContentEntry{}).Where("content_type = ?", ct.Name).Count(&entries).Error
+	if err != nil {
+		return err
+	}
+	if entries > 0 {
+		return ErrContentTypeHasEntries
+	}
+	return nil
+}
+
+// NewEntry returns an empty entry of the content type, with every field set to nil.
+func (ct *ContentType) NewEntry() *ContentEntry {
+	data := make(map[string]interface{})
+	for _, field := range ct.Fields {
+		data[field.Name] = nil
+	}
+
+	return &ContentEntry{
+		ContentType: ct.Name,
+		Data:        data,
+	}
+}
+
+// SetData writes the values of the given body into the entry, converting them to the type of
+// their fields. Keys that are not fields of the content type are ignored, and fields that are
+// not in the body keep their value.
+//
+// It returns a validation error for each value that doesn't match the type of its field.
+func (ct *ContentType) SetData(entry *ContentEntry, body map[string]interface{}) ValidationResult {
+	result := ValidationResult{Errors: make([]ValidationError, 0)}
+
+	if entry.Data == nil {
+		entry.Data = make(map[string]interface{})
+	}
+
+	for _, field := range ct.Fields {
+		if _, ok := entry.Data[field.Name]; !ok {
+			entry.Data[field.Name] = nil
+		}
+
+		value, ok := body[field.Name]
+		if !ok {
+			continue
+		}
+
+		converted, err := field.Convert(value)
+		if err != nil {
+			result.Errors = append(result.Errors, ValidationError{Field: field.Name, Error: err.Error()})
+			continue
+		}
+		entry.Data[field.Name] = converted
+	}
+
+	return result
+}
+
+// RichText returns the rich text definition of richtext and markdown fields, or nil for other types.
+// They are sanitized with DefaultRichTextAllowlist.
+func (f ContentField) RichText() *RichTextField {
+	format := RichTextHTML
+	switch f.Type {
+	case ContentFieldRichText:
+	case ContentFieldMarkdown:
+		format = RichTextMarkdown
+	default:
+		return nil
+	}
+
+	richText, _ := NewRichTextField(f.Name, format, nil, false)
+	return richText
+}
+
+// Convert returns the given value converted to the type of the field, or an error if it
+// can't be converted. Nil values are allowed, required fields are checked by the validators.
+func (f ContentField) Convert(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	invalid := fmt.Errorf("%s must be of type %s", f.Name, f.Type)
+
+	switch f.Type {
+	case ContentFieldString, ContentFieldText:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return s, nil
+
+	case ContentFieldRichText, ContentFieldMarkdown:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return f.RichText().Sanitize(s)
+
+	case ContentFieldNumber, ContentFieldInteger:
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case int:
+			n = float64(v)
+		case int64:
+			n = float64(v)
+		case json.Number:
+			parsed, err := strconv.ParseFloat(v.String(), 64)
+			if err != nil {
+				return nil, invalid
+			}
+			n = parsed
+		default:
+			return nil, invalid
+		}
+
+		if f.Type == ContentFieldInteger {
+			if n != math.Trunc(n) {
+				return nil, invalid
+			}
+			return int64(n), nil
+		}
+		return n, nil
+
+	case ContentFieldBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		return b, nil
+
+	case ContentFieldDateTime:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date time in RFC 3339 format", f.Name)
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	}
+
+	return nil, fmt.Errorf("field %s has an invalid type %s", f.Name, f.Type)
+}
+
+// JSONSchema returns the JSON schema of the entries of the content type, in the same shape
+// as the schema of the Apps registered with Go structs.
+func (ct *ContentType) JSONSchema() *jsonschema.Schema {
+	schema := jsonschema.Reflect(&ContentEntry{})
+
+	definition, ok := schema.Definitions["ContentEntry"]
+	if !ok {
+		return schema
+	}
+	delete(schema.Definitions, "ContentEntry")
+
+	definition.Title = ct.Name
+	definition.Description = ct.Description
+
+	for _, field := range ct.Fields {
+		property := &jsonschema.Schema{
+			Description: field.Description,
+		}
+
+		switch field.Type {
+		case ContentFieldString, ContentFieldText:
+			property.Type = "string"
+		case ContentFieldRichText, ContentFieldMarkdown:
+			property.Type = "string"
+			property.ContentMediaType = field.RichText().MediaType()
+		case ContentFieldNumber:
+			property.Type = "number"
+		case ContentFieldInteger:
+			property.Type = "integer"
+		case ContentFieldBoolean:
+			property.Type = "boolean"
+		case ContentFieldDateTime:
+			property.Type = "string"
+			property.Format = "date-time"
+		}
+
+		definition.Properties.Set(field.Name, property)
+		if field.Required {
+			definition.Required = append(definition.Required, field.Name)
+		}
+	}
+
+	schema.Definitions[ct.Name] = definition
+	schema.Ref = "#/$defs/" + ct.Name
+
+	return schema
+}
+
+// IsContentType returns true if the App was defined at runtime from a ContentType.
+func (a *App) IsContentType() bool {
+	return a.ContentType != nil
+}
+
+// GetSchema returns the JSON schema of the model of the App.
+func (a *App) GetSchema() *jsonschema.Schema {
+	if a.IsContentType() {
+		schema := a.ContentType.JSONSchema()
+		a.annotateAdminSchema(schema)
+		return schema
+	}
+
+	schema := jsonschema.Reflect(a.Model)
+	a.annotateRichTextSchema(schema)
+	a.annotateMediaSchema(schema)
+	a.annotateAdminSchema(schema)
+	return schema
+}
+
+// RegisterContentType adds an App for the given content type, with the same routes as
+// the Apps registered with Go structs.
+//
+// Parameters:
+// - contentType: the definition of the content type.
+//
+// Returns:
+// - App: the App of the content type.
+// - error: an error if the definition is invalid or an App with the same name is already registered.
+func (a *Admin) RegisterContentType(contentType *ContentType) (App, error) {
+	err := contentType.Validate()
+	if err != nil {
+		return App{}, err
+	}
+
+	permissions := contentType.Permissions
+	if permissions == nil {
+		permissions = RolePermissionMap{}
+	}
+
+	app := a.newApp(contentType.NewEntry(), contentType.SkipUserBinding, permissions)
+	app.ContentType = contentType
+	app.Validators = contentType.GetValidators()
+	for _, field := range contentType.Fields {
+		if richText := field.RichText(); richText != nil {
+			app.RichText[field.Name] = richText
+		}
+	}
+	app.Api = &API{
+		List:   ContentList,
+		Detail: ContentDetail,
+		Create: ContentCreate,
+		Update: ContentUpdate,
+		Delete: ContentDelete,
+	}
+
+	return a.register(app)
+}
+
+// LoadContentTypes registers an App for every content type stored in the database.
+//
+// The Apps of the content types that were loaded before are unregistered first, so it can
+// be called after a content type is created, updated or deleted.
+func (a *Admin) LoadContentTypes() error {
+	contentTypesMu.Lock()
+	defer contentTypesMu.Unlock()
+
+	var contentTypes []ContentType
+	err := a.Builder.DB.DB.Find(&contentTypes).Error
+	if err != nil {
+		return err
+	}
+
+	// the routes of every content type are swapped at once
+	a.Builder.Server.BeginUpdate()
+	defer a.Builder.Server.Commit()
+
+	for _, app := range a.GetApps() {
+		if app.IsContentType() {
+			err = a.Unregister(app.Name())
+			if err != nil {
+				log.Error().Err(err).Str("contentType", app.Name()).Msg("Error unregistering content type")
+			}
+		}
+	}
+
+	for i := range contentTypes {
+		_, err = a.RegisterContentType(&contentTypes[i])
+		if err != nil {
+			log.Error().Err(err).Str("contentType", contentTypes[i].Name).Msg("Error registering content type")
+		}
+	}
+
+	return nil
+}
+
+// reloadContentTypesAfter wraps an ApiFunction of the ContentType App, so the Apps of the
+// content types are reloaded after each change.
+func reloadContentTypesAfter(apiFunction ApiFunction) ApiFunction {
+	return func(a *App, db *Database) HandlerFunc {
+		handler := apiFunction(a, db)
+		return func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+
+			err := a.Admin.LoadContentTypes()
+			if err != nil {
+				log.Error().Err(err).Msg("Error loading content types")
+			}
+		}
+	}
+}
+
+// ContentTypeValidator checks the definition of a content type before it is saved.
+//
+// The name can't be the name of another App, and content types with entries can't be renamed,
+// since the entries are stored under the name of their content type.
+func (a *Admin) ContentTypeValidator(fieldName string, instance EntityData, output *ValidationError) *ValidationError {
+	data, err := json.Marshal(instance)
+	if err != nil {
+		output.Error = err.Error()
+		return output
+	}
+
+	var contentType ContentType
+	err = json.Unmarshal(data, &contentType)
+	if err != nil {
+		output.Error = err.Error()
+		return output
+	}
+
+	err = contentType.Validate()
+	if err != nil {
+		output.Error = err.Error()
+		return output
+	}
+
+	var id uint
+	if contentType.SystemData != nil {
+		id = contentType.ID
+	}
+
+	app, err := a.GetApp(contentType.Name)
+	if err == nil && (!app.IsContentType() || app.ContentType.ID != id) {
+		output.Error = fmt.Sprintf("name %q is already used by another App", contentType.Name)
+		return output
+	}
+
+	if id == 0 {
+		return output
+	}
+
+	var previous ContentType
+	err = a.Builder.DB.DB.First(&previous, id).Error
+	if err != nil || previous.Name == contentType.Name {
+		return output
+	}
+
+	var entries int64
+	err = a.Builder.DB.DB.Model(&ContentEntry{}).Where("content_type = ?", previous.Name).Count(&entries).Error
+	if err != nil {
+		output.Error = err.Error()
+		return output
+	}
+	if entries > 0 {
+		output.Error = fmt.Sprintf("content type %q has entries, it can't be renamed", previous.Name)
+	}
+
+	return output
+}
+
+// contentOrderColumns are the columns the entries of content types can be sorted by. The values
+// of the fields are stored as JSON, so they can't be sorted by.
+var contentOrderColumns = map[string]bool{
+	"id":            true,
+	"created_at":    true,
+	"updated_at":    true,
+	"created_by_id": true,
+	"updated_by_id": true,
+}
+
+// validateContentOrder returns the order of the entries for the given order parameter, see
+// ValidateOrderParam, or an error if it sorts by a column other than the system data.
+func (a *App) validateContentOrder(orderParam string) (string, error) {
+	order, err := a.ValidateOrderParam(orderParam)
+	if err != nil {
+		return "", err
+	}
+
+	for _, part := range strings.Split(order, ",") {
+		column := strings.TrimSuffix(part, " desc")
+		if column != "" && !contentOrderColumns[column] {
+			return "", fmt.Errorf("cannot sort %s by %s", a.Name(), column)
+		}
+	}
+
+	return order, nil
+}
+
+// getContentEntry returns the entry with the given ID if it belongs to the content type of the
+// App and the user is authorized to access it, or nil otherwise.
+func (a *App) getContentEntry(db *Database, instanceId string, params *RequestParameters) (*ContentEntry, error) {
+	instance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, params)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := instance.(*ContentEntry)
+	if !ok || entry.ContentType != a.ContentType.Name {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// ContentList is the List ApiFunction of the Apps of content types.
+var ContentList ApiFunction = func(a *App, db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		limit, err := strconv.Atoi(GetQueryParam("limit", r))
+		if err != nil {
+			limit = 10
+		}
+
+		page, err := strconv.Atoi(GetQueryParam("page", r))
+		if err != nil {
+			page = 1
+		}
+
+		order, err := a.validateContentOrder(GetQueryParam("order", r))
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		pagination := &Pagination{
+			Total: 0,
+			Page:  page,
+			Limit: limit,
+		}
+
+		// filter by ?tag= and ?category=
+		query, args, err := a.TaxonomyFilter(db, r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		// content type names are validated, so they are safe to use in the query
+		query = JoinQueries(query, "content_type = '"+a.ContentType.Name+"'")
+		if !a.SkipUserBinding && !params.IsAdmin() {
+			query = JoinQueries(query, "created_by_id = '"+params.RequestedById+"'")
+		}
+
+		entries := make([]ContentEntry, 0)
+		res := db.Find(&entries, query, pagination, order, args...)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		a.SendLocalizedJsonResponse(w, r, db, entries, a.Name()+" list", pagination)
+	}
+}
+
+// ContentDetail is the Detail ApiFunction of the Apps of content types.
+var ContentDetail ApiFunction = func(a *App, db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		entry, err := a.getContentEntry(db, GetUrlParam("id", r), &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		if entry == nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		a.SendLocalizedJsonResponse(w, r, db, entry, a.Name()+" detail", nil)
+	}
+}
+
+// ContentCreate is the Create ApiFunction of the Apps of content types.
+var ContentCreate ApiFunction = func(a *App, db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationCreate)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to create this resource")
+			return
+		}
+
+		body, err := FormatRequestBody(r, filterKeys)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		entry := a.ContentType.NewEntry()
+		entry.SystemData = &SystemData{
+			CreatedByID: params.User.ID,
+			UpdatedByID: params.User.ID,
+		}
+
+		validationErrors := a.ContentType.SetData(entry, body)
+		validationErrors.Errors = append(validationErrors.Errors, a.Validate(entry).Errors...)
+		if len(validationErrors.Errors) > 0 {
+			SendJsonResponse(w, http.StatusBadRequest, validationErrors, "Validation failed")
+			return
+		}
+
+		res := db.Create(entry, params.User)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		output, err := a.RenderRecords(db, entry)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusCreated, output, a.Name()+" created")
+	}
+}
+
+// ContentUpdate is the Update ApiFunction of the Apps of content types.
+var ContentUpdate ApiFunction = func(a *App, db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationUpdate)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to update this resource")
+			return
+		}
+
+		body, err := FormatRequestBody(r, filterKeys)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		entry, err := a.getContentEntry(db, GetUrlParam("id", r), &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		if entry == nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		validationErrors := a.ContentType.SetData(entry, body)
+		validationErrors.Errors = append(validationErrors.Errors, a.Validate(entry).Errors...)
+		if len(validationErrors.Errors) > 0 {
+			SendJsonResponse(w, http.StatusBadRequest, validationErrors, "Validation failed")
+			return
+		}
+
+		entry.UpdatedByID = params.User.ID
+
+		res := db.Save(entry, params.User)
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		output, err := a.RenderRecords(db, entry)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, output, a.Name()+" updated")
+	}
+}
+
+// ContentDelete is the Delete ApiFunction of the Apps of content types.
+var ContentDelete ApiFunction = func(a *App, db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationDelete)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to delete this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		entry, err := a.getContentEntry(db, instanceId, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		if entry == nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		// the links to the tags and categories are deleted along with the entry
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			txDb := &Database{DB: tx}
+
+			res := txDb.Delete(entry, params.User)
+			if res == nil {
+				return fmt.Errorf("error deleting %s", a.Name())
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+
+			return a.DeleteTerms(txDb, []string{instanceId})
+		})
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, nil, a.Name()+" deleted")
+	}
+}
@@ -0,0 +1,227 @@
+package builder_test
+
+import (
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentFieldConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   builder.ContentField
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "string",
+			field: builder.ContentField{Name: "title", Type: builder.ContentFieldString},
+			value: "hello",
+			want:  "hello",
+		},
+		{
+			name:    "string with number",
+			field:   builder.ContentField{Name: "title", Type: builder.ContentFieldString},
+			value:   1.0,
+			wantErr: true,
+		},
+		{
+			name:  "integer",
+			field: builder.ContentField{Name: "views", Type: builder.ContentFieldInteger},
+			value: 3.0,
+			want:  int64(3),
+		},
+		{
+			name:    "integer with decimals",
+			field:   builder.ContentField{Name: "views", Type: builder.ContentFieldInteger},
+			value:   3.5,
+			wantErr: true,
+		},
+		{
+			name:  "boolean",
+			field: builder.ContentField{Name: "published", Type: builder.ContentFieldBoolean},
+			value: true,
+			want:  true,
+		},
+		{
+			name:  "datetime is normalized to UTC",
+			field: builder.ContentField{Name: "publishedAt", Type: builder.ContentFieldDateTime},
+			value: "2024-01-02T10:00:00-03:00",
+			want:  "2024-01-02T13:00:00Z",
+		},
+		{
+			name:    "invalid datetime",
+			field:   builder.ContentField{Name: "publishedAt", Type: builder.ContentFieldDateTime},
+			value:   "yesterday",
+			wantErr: true,
+		},
+		{
+			name:  "nil is allowed",
+			field: builder.ContentField{Name: "title", Type: builder.ContentFieldString, Required: true},
+			value: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.Convert(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err, "Convert should return an error")
+				return
+			}
+
+			assert.NoError(t, err, "Convert should not return an error")
+			assert.Equal(t, tt.want, got, "Convert should return the expected value")
+		})
+	}
+}
+
+func TestContentTypeValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType builder.ContentType
+		wantErr     bool
+	}{
+		{
+			name: "valid",
+			contentType: builder.ContentType{
+				Name:   "Article",
+				Fields: []builder.ContentField{{Name: "title", Type: builder.ContentFieldString}},
+			},
+		},
+		{
+			name:        "invalid name",
+			contentType: builder.ContentType{Name: "my articles"},
+			wantErr:     true,
+		},
+		{
+			name: "reserved field",
+			contentType: builder.ContentType{
+				Name:   "Article",
+				Fields: []builder.ContentField{{Name: "createdById", Type: builder.ContentFieldInteger}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicated field",
+			contentType: builder.ContentType{
+				Name: "Article",
+				Fields: []builder.ContentField{
+					{Name: "title", Type: builder.ContentFieldString},
+					{Name: "title", Type: builder.ContentFieldText},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown type",
+			contentType: builder.ContentType{
+				Name:   "Article",
+				Fields: []builder.ContentField{{Name: "title", Type: "color"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown validator",
+			contentType: builder.ContentType{
+				Name:   "Article",
+				Fields: []builder.ContentField{{Name: "title", Type: builder.ContentFieldString, Validators: []string{"nope"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.contentType.Validate()
+			if tt.wantErr {
+				assert.Error(t, err, "Validate should return an error")
+			} else {
+				assert.NoError(t, err, "Validate should not return an error")
+			}
+		})
+	}
+}
+
+// TestContentTypeEntries tests that a content type stored in the database is served as an App,
+// and that its entries are validated and logged in the history.
+func TestContentTypeEntries(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	contentType := builder.ContentType{
+		SystemData: &builder.SystemData{},
+		Name:       "RuntimeArticle",
+		Fields: []builder.ContentField{
+			{Name: "title", Type: builder.ContentFieldString, Required: true},
+			{Name: "views", Type: builder.ContentFieldInteger},
+		},
+		Permissions: builder.RolePermissionMap{
+			builder.AdminRole:   builder.AllAllowedAccess,
+			builder.VisitorRole: builder.AllAllowedAccess,
+		},
+	}
+	err = e.DB.DB.Create(&contentType).Error
+	assert.NoError(t, err, "Creating the content type should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&contentType)
+	defer e.DB.DB.Unscoped().Where("content_type = ?", contentType.Name).Delete(&builder.ContentEntry{})
+
+	err = e.Admin.LoadContentTypes()
+	assert.NoError(t, err, "LoadContentTypes should not return an error")
+
+	app, err := e.Admin.GetApp("RuntimeArticle")
+	assert.NoError(t, err, "GetApp should return the app of the content type")
+	assert.True(t, app.IsContentType(), "App should be a content type")
+	defer e.Admin.Unregister(app.Name())
+
+	t.Log("Creating an invalid entry")
+	request, user, rollback := th.NewRequest(http.MethodPost, `{"views": 1.5}`, true, nil, nil)
+	defer rollback()
+
+	response, err := th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, nil)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+	assert.False(t, response.Success, "ApiCreate should fail validation")
+
+	t.Log("Creating a valid entry")
+	request, _, _ = th.NewRequest(http.MethodPost, `{"title": "Hello", "views": 2}`, true, user, nil)
+
+	var entry map[string]interface{}
+	response, err = th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &entry)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+	assert.True(t, response.Success, "ApiCreate should return a success response")
+	assert.Equal(t, "Hello", entry["title"], "Title should be stored")
+	assert.Equal(t, "RuntimeArticle", entry["contentType"], "Content type should be set")
+
+	t.Log("Checking the history")
+	var history builder.HistoryEntry
+	err = e.DB.DB.Where("resource_name = ?", "RuntimeArticle").Last(&history).Error
+	assert.NoError(t, err, "History entry should be logged with the name of the content type")
+	assert.Equal(t, builder.CreateCRUDAction, history.Action, "History entry should be a creation")
+
+	t.Log("Sorting by a field")
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, nil)
+	request.URL.RawQuery = "order=title"
+
+	response, err = th.ExecuteApiCall(t, app.ApiList(e.DB), request, nil)
+	assert.NoError(t, err, "ApiList should not return an error")
+	assert.False(t, response.Success, "ApiList should not sort by the fields of the content type")
+
+	t.Log("Validating the definitions")
+	validate := func(definition builder.EntityData) string {
+		output := builder.NewFieldValidationError("name")
+		return e.Admin.ContentTypeValidator("name", definition, &output).Error
+	}
+
+	assert.NotEmpty(t, validate(builder.EntityData{"name": "User"}), "Names of other Apps should be rejected")
+	assert.Empty(t, validate(builder.EntityData{"ID": contentType.ID, "name": "RuntimeArticle"}), "Content types should keep their name")
+	assert.NotEmpty(t, validate(builder.EntityData{"ID": contentType.ID, "name": "RenamedArticle"}), "Content types with entries should not be renamed")
+
+	t.Log("Deleting a content type with entries")
+	err = e.DB.DB.Delete(&contentType).Error
+	assert.ErrorIs(t, err, builder.ErrContentTypeHasEntries, "Content types with entries should not be deleted")
+}
@@ -2,6 +2,8 @@ package builder
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -60,29 +62,42 @@ func (db *Database) FindUserByFirebaseId(firebaseId string, user *User) *gorm.DB
 //   - entity: the destination where the result will be stored.
 //   - query: the query to be executed, it can be a raw SQL query or a GORM query.
 //   - pagination: optional pagination information.
+//   - order: the order of the records, "id desc" if empty.
+//   - args: the values of the placeholders of the query, if any.
 //
 // Returns:
 //   - *gorm.DB: the result of the database query, which can be used to check for errors.
-func (db *Database) Find(entity interface{}, query string, pagination *Pagination, order string) *gorm.DB {
+func (db *Database) Find(entity interface{}, query string, pagination *Pagination, order string, args ...interface{}) *gorm.DB {
 	if order == "" {
 		order = "id desc"
 	}
 
 	if pagination == nil {
-		return db.DB.Order(order).Where(query).Find(entity)
+		return db.DB.Order(order).Where(query, args...).Find(entity)
 	}
 
 	// Retrieve total number of records
-	db.DB.Model(entity).Debug().Where(query).Count(&pagination.Total)
+	db.DB.Model(entity).Debug().Where(query, args...).Count(&pagination.Total)
 
 	// Apply pagination
-	filtered := db.DB.Where(query).Order(order)
+	filtered := db.DB.Where(query, args...).Order(order)
 	limit := pagination.Limit
 	offset := (pagination.Page - 1) * pagination.Limit
 
 	return filtered.Limit(limit).Offset(offset).Find(entity)
 }
 
+// JoinQueries joins the given conditions with AND, skipping the empty ones.
+func JoinQueries(queries ...string) string {
+	conditions := make([]string, 0, len(queries))
+	for _, query := range queries {
+		if query != "" {
+			conditions = append(conditions, "("+query+")")
+		}
+	}
+	return strings.Join(conditions, " AND ")
+}
+
 // Create creates a new record in the database.
 //
 // Parameters:
@@ -213,3 +228,33 @@ func (db *Database) Migrate(model interface{}) error {
 	db.DB.AutoMigrate(model)
 	return nil
 }
+
+// GetColumnName returns the name of the database column that stores the field of the model
+// with the given JSON name.
+//
+// Parameters:
+//   - model: the model the field belongs to.
+//   - fieldName: the JSON name of the field.
+//
+// Returns:
+//   - string: the column name.
+//   - error: an error if the field is not found or is not stored in the database.
+func (db *Database) GetColumnName(model interface{}, fieldName string) (string, error) {
+	structField, err := GetStructFieldByJsonName(model, fieldName)
+	if err != nil {
+		return "", err
+	}
+
+	stmt := &gorm.Statement{DB: db.DB}
+	err = stmt.Parse(CreateInstanceForUndeterminedType(model))
+	if err != nil {
+		return "", err
+	}
+
+	field := stmt.Schema.LookUpField(structField.Name)
+	if field == nil || field.DBName == "" {
+		return "", fmt.Errorf("field %s is not stored in the database", fieldName)
+	}
+
+	return field.DBName, nil
+}
@@ -0,0 +1,379 @@
+package builder
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// privatePrefix is the prefix of the routes that require authentication, see Server.buildRouter.
+const privatePrefix = "/private"
+
+// EndpointInfo describes a route of an App in the /api document.
+type EndpointInfo struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"` // The path as served, with the /private prefix for protected routes
+	Url          string `json:"url"`  // The path prefixed with the scheme and host of the request
+	RequiresAuth bool   `json:"requiresAuth"`
+}
+
+// RelationInfo describes a field of an App that references records of another App.
+type RelationInfo struct {
+	Field      string `json:"field"`                // JSON name of the field holding the related records
+	Type       string `json:"type"`                 // has_one, has_many, belongs_to, many_to_many, media or parent
+	App        string `json:"app,omitempty"`        // Name of the related App, empty if it's not registered
+	ForeignKey string `json:"foreignKey,omitempty"` // JSON name of the field holding the ID of the related record
+}
+
+// AppInfo describes an App in the /api document.
+type AppInfo struct {
+	Name        string                   `json:"name"`
+	Plural      string                   `json:"pluralName"`
+	Snake       string                   `json:"snakeName"`
+	Kebab       string                   `json:"kebabName"`
+	SnakePlural string                   `json:"snakePluralName"`
+	KebabPlural string                   `json:"kebabPluralName"`
+	Endpoints   map[string]EndpointInfo  `json:"endpoints"`
+	Operations  map[CrudOperation]bool   `json:"operations"` // Operations the requesting user is allowed to perform
+	Validators  map[string][]string      `json:"validators"` // Names of the validators by JSON field name
+	Relations   []RelationInfo           `json:"relations"`
+	Actions     []ActionInfo             `json:"actions"`
+	Features    map[string]bool          `json:"features"` // Opt-in behaviours, e.g. comments or sorting
+	Fields      map[string]FieldMetadata `json:"fields,omitempty"`
+}
+
+// FieldMetadata describes the opt-in behaviour of a field, e.g. whether it's translatable.
+type FieldMetadata struct {
+	Translatable bool              `json:"translatable,omitempty"`
+	Slug         bool              `json:"slug,omitempty"`
+	RichText     RichTextFormat    `json:"richText,omitempty"`
+	Media        *MediaFieldConfig `json:"media,omitempty"`
+}
+
+// GetValidatorName returns the name of the given validator, e.g. "required" for RequiredValidator.
+//
+// Validators in ContentValidators are named after their key. Other validators are named
+// after their function, validators built by other functions after the function that built them.
+func GetValidatorName(validator Validator) string {
+	pointer := reflect.ValueOf(validator).Pointer()
+	for name, v := range ContentValidators {
+		if reflect.ValueOf(v).Pointer() == pointer {
+			return name
+		}
+	}
+
+	fn := runtime.FuncForPC(pointer)
+	if fn == nil {
+		return "custom"
+	}
+
+	// e.g. github.com/user/app/validators.MinLengthValidator.func1
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 || strings.HasPrefix(parts[1], "func") {
+		return "custom"
+	}
+
+	// closures are only named after the function that built them if it's a validator too
+	isClosure := len(parts) > 2
+	if isClosure && !strings.HasSuffix(parts[1], "Validator") {
+		return "custom"
+	}
+
+	name = strings.TrimSuffix(parts[1], "Validator")
+	if name == "" {
+		return "custom"
+	}
+
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// getJsonName returns the JSON name of the given struct field.
+func getJsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// getFieldJsonName returns the JSON name of the field with the given case-insensitive name,
+// as Validators and TranslatableFields are keyed by lowercased names.
+func (a *App) getFieldJsonName(field string) string {
+	if a.IsContentType() {
+		for _, contentField := range a.ContentType.Fields {
+			if strings.EqualFold(contentField.Name, field) {
+				return contentField.Name
+			}
+		}
+		return field
+	}
+
+	if structField, err := GetStructFieldByJsonName(a.Model, field); err == nil {
+		return getJsonName(structField)
+	}
+	return field
+}
+
+// GetValidatorsInfo returns the names of the validators of the App by JSON field name.
+func (a *App) GetValidatorsInfo() map[string][]string {
+	output := make(map[string][]string)
+	for field, validators := range a.Validators {
+		name := a.getFieldJsonName(field)
+		for _, validator := range validators {
+			output[name] = append(output[name], GetValidatorName(validator))
+		}
+	}
+	return output
+}
+
+// GetRelationsInfo returns the fields of the App that reference records of other Apps.
+//
+// Relations are read from the GORM associations of the model, and include the media fields
+// and the parent of the records of trees.
+func (a *App) GetRelationsInfo(db *gorm.DB) []RelationInfo {
+	output := make([]RelationInfo, 0)
+
+	if db != nil && !a.IsContentType() {
+		stmt := &gorm.Statement{DB: db}
+		err := stmt.Parse(CreateInstanceForUndeterminedType(a.Model))
+		if err != nil {
+			log.Error().Err(err).Str("app", a.Name()).Msg("Error parsing model")
+		} else {
+			for _, rel := range stmt.Schema.Relationships.Relations {
+				info := RelationInfo{
+					Field: getJsonName(rel.Field.StructField),
+					Type:  string(rel.Type),
+				}
+
+				related := reflect.New(rel.FieldSchema.ModelType).Interface()
+				if app, err := a.Admin.GetApp(GetResourceName(related)); err == nil {
+					info.App = app.Name()
+				}
+
+				// the foreign key is only a field of the App for belongs to
+				if rel.Type == schema.BelongsTo && len(rel.References) > 0 {
+					info.ForeignKey = getJsonName(rel.References[0].ForeignKey.StructField)
+				}
+
+				output = append(output, info)
+			}
+		}
+	}
+
+	for _, field := range a.getMediaFieldNames() {
+		output = append(output, RelationInfo{
+			Field:      a.Media[field].ExpandField,
+			Type:       "media",
+			App:        GetResourceName(&Upload{}),
+			ForeignKey: field,
+		})
+	}
+
+	if a.IsTree() {
+		output = append(output, RelationInfo{
+			Field:      "parentId",
+			Type:       "parent",
+			App:        a.Name(),
+			ForeignKey: "parentId",
+		})
+	}
+
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Field < output[j].Field
+	})
+
+	return output
+}
+
+// GetFeaturesInfo returns which opt-in behaviours are enabled for the App.
+func (a *App) GetFeaturesInfo() map[string]bool {
+	return map[string]bool{
+		"userBound":   !a.SkipUserBinding,
+		"contentType": a.IsContentType(),
+		"slug":        a.Slug != nil && a.Slug.Field != "",
+		"comments":    a.Comments != nil && a.Comments.Enabled,
+		"tags":        a.Taxonomy != nil && a.Taxonomy.Tags,
+		"categories":  a.Taxonomy != nil && a.Taxonomy.Categories,
+		"sortable":    a.IsSortable(),
+		"tree":        a.IsTree(),
+	}
+}
+
+// GetFieldsInfo returns the fields of the App with opt-in behaviours.
+func (a *App) GetFieldsInfo() map[string]FieldMetadata {
+	output := make(map[string]FieldMetadata)
+	update := func(name string, fn func(*FieldMetadata)) {
+		info := output[name]
+		fn(&info)
+		output[name] = info
+	}
+
+	for field := range a.TranslatableFields {
+		update(a.getFieldJsonName(field), func(f *FieldMetadata) { f.Translatable = true })
+	}
+
+	if a.Slug != nil && a.Slug.Field != "" {
+		update(a.Slug.Field, func(f *FieldMetadata) { f.Slug = true })
+	}
+
+	for field, richText := range a.RichText {
+		update(field, func(f *FieldMetadata) { f.RichText = richText.Format })
+	}
+
+	for field, media := range a.Media {
+		update(field, func(f *FieldMetadata) { f.Media = &media.MediaFieldConfig })
+	}
+
+	return output
+}
+
+// systemFields are set by the database, so they can't be set in the requests.
+var systemFields = map[string]bool{
+	"ID":        true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// GetInputFields returns the JSON names of the fields that can be set in the body of the
+// create and update requests of the App, in the order of the model.
+//
+// The system fields, the read-only fields, the related records, which are set by their
+// foreign key, and the paths of the trees, which are set by their parent, are left out.
+func (a *App) GetInputFields(db *gorm.DB) []string {
+	output := make([]string, 0)
+
+	schema := a.GetSchema()
+	definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	if !ok || definition.Properties == nil {
+		return output
+	}
+
+	skip := make(map[string]bool)
+	for _, relation := range a.GetRelationsInfo(db) {
+		if relation.ForeignKey != "" && relation.Field != relation.ForeignKey {
+			skip[relation.Field] = true
+		}
+	}
+	if a.IsTree() {
+		skip["treePath"] = true
+		skip["depth"] = true
+	}
+
+	for pair := definition.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		key := pair.Key
+		if filterKeys[key] || systemFields[key] || skip[key] || pair.Value.ReadOnly {
+			continue
+		}
+		output = append(output, key)
+	}
+
+	return output
+}
+
+// GetInfo returns the description of the App in the /api document, with the operations
+// allowed for the given request parameters.
+//
+// Parameters:
+// - routes: the routes of the server, the ones under the base route of the App are listed as endpoints.
+// - params: the parameters of the request.
+// - baseUrl: the scheme and host the endpoints are served from, see GetRequestBaseUrl.
+func (a *App) GetInfo(routes []RouteHandler, params *RequestParameters, baseUrl string) AppInfo {
+	kebab := a.KebabPluralName()
+	baseRoute := "/api/" + kebab
+
+	endpoints := make(map[string]EndpointInfo)
+	for _, route := range routes {
+		if route.Legacy || (route.Route != baseRoute && !strings.HasPrefix(route.Route, baseRoute+"/")) {
+			continue
+		}
+
+		path := route.Route
+		if route.RequiresAuth {
+			path = privatePrefix + path
+		}
+
+		endpoints[strings.TrimPrefix(route.Name, kebab+"-")] = EndpointInfo{
+			Method:       route.Method,
+			Path:         path,
+			Url:          baseUrl + path,
+			RequiresAuth: route.RequiresAuth,
+		}
+	}
+
+	operations := make(map[CrudOperation]bool)
+	for _, operation := range AllAllowedAccess {
+		operations[operation] = a.Permissions.HasPermission(params.Roles, operation)
+	}
+
+	// actions are served behind authentication
+	actions := a.GetActionsInfo()
+	for i := range actions {
+		actions[i].Path = privatePrefix + actions[i].Path
+	}
+
+	var db *gorm.DB
+	if a.Admin != nil && a.Admin.Builder != nil && a.Admin.Builder.DB != nil {
+		db = a.Admin.Builder.DB.DB
+	}
+
+	return AppInfo{
+		Name:        a.Name(),
+		Plural:      a.PluralName(),
+		Snake:       a.SnakeName(),
+		Kebab:       a.KebabName(),
+		SnakePlural: a.SnakePluralName(),
+		KebabPlural: kebab,
+		Endpoints:   endpoints,
+		Operations:  operations,
+		Validators:  a.GetValidatorsInfo(),
+		Relations:   a.GetRelationsInfo(db),
+		Actions:     actions,
+		Features:    a.GetFeaturesInfo(),
+		Fields:      a.GetFieldsInfo(),
+	}
+}
+
+// forwardedHostRegex matches the hosts with an optional port, e.g. example.com:8080 or [::1].
+var forwardedHostRegex = regexp.MustCompile(`^[A-Za-z0-9.\-]+(:[0-9]+)?$|^\[[0-9A-Fa-f:.]+\](:[0-9]+)?$`)
+
+// GetRequestBaseUrl returns the scheme and host the request was sent to, e.g. https://example.com.
+//
+// The X-Forwarded-Proto and X-Forwarded-Host headers are only honored if the request comes
+// from one of the TrustedProxies, like in GetRequestIP. Forwarded schemes other than http and
+// https, and invalid hosts, are ignored.
+func GetRequestBaseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if !isTrustedProxy(getRemoteHost(r)) {
+		return scheme + "://" + host
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		proto = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		if proto == "http" || proto == "https" {
+			scheme = proto
+		}
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		forwarded = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		if forwardedHostRegex.MatchString(forwarded) {
+			host = forwarded
+		}
+	}
+
+	return scheme + "://" + host
+}
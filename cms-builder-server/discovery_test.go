@@ -0,0 +1,85 @@
+package builder_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockDiscoveryStruct struct {
+	*builder.SystemData
+	Email string `json:"email"`
+}
+
+// TestGetValidatorName tests that validators are named after their key or function.
+func TestGetValidatorName(t *testing.T) {
+	assert.Equal(t, "required", builder.GetValidatorName(builder.RequiredValidator))
+	assert.Equal(t, "field", builder.GetValidatorName(th.FieldValidator))
+	assert.Equal(t, "custom", builder.GetValidatorName(func(fieldName string, entity builder.EntityData, output *builder.ValidationError) *builder.ValidationError {
+		return output
+	}))
+}
+
+// TestGetRequestBaseUrl tests that the base url is taken from the request, and from the proxy
+// headers only behind the trusted proxies.
+func TestGetRequestBaseUrl(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "http://localhost:8080/api", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "http://localhost:8080", builder.GetRequestBaseUrl(request))
+
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.Header.Set("X-Forwarded-Host", "cms.example.com")
+	assert.Equal(t, "http://localhost:8080", builder.GetRequestBaseUrl(request), "The proxy headers should be ignored from untrusted addresses")
+
+	proxies, err := builder.ParseTrustedProxies("10.0.0.0/8")
+	assert.NoError(t, err, "ParseTrustedProxies should not return an error")
+
+	builder.TrustedProxies = proxies
+	defer func() { builder.TrustedProxies = nil }()
+
+	assert.Equal(t, "https://cms.example.com", builder.GetRequestBaseUrl(request))
+
+	request.Header.Set("X-Forwarded-Proto", "javascript")
+	request.Header.Set("X-Forwarded-Host", "evil.com/path")
+	assert.Equal(t, "http://localhost:8080", builder.GetRequestBaseUrl(request), "Invalid schemes and hosts should be ignored")
+}
+
+// TestGetInfo tests that the /api document lists the endpoints, allowed operations and validators of an App.
+func TestGetInfo(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockDiscoveryStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: []builder.CrudOperation{builder.OperationRead},
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.RegisterValidator("email", builder.ValidatorsList{builder.RequiredValidator, builder.EmailValidator})
+	assert.NoError(t, err, "RegisterValidator should not return an error")
+
+	params := &builder.RequestParameters{Roles: []builder.Role{builder.VisitorRole}}
+	info := app.GetInfo(e.Server.GetRoutes(), params, "https://cms.example.com")
+
+	list, ok := info.Endpoints["list"]
+	assert.True(t, ok, "List endpoint should be listed")
+	assert.Equal(t, http.MethodGet, list.Method)
+	assert.Equal(t, "/private/api/"+app.KebabPluralName(), list.Path, "Protected endpoints should be served under /private")
+	assert.Equal(t, "https://cms.example.com/private/api/"+app.KebabPluralName(), list.Url)
+
+	update, ok := info.Endpoints["update"]
+	assert.True(t, ok, "Update endpoint should be listed")
+	assert.Equal(t, http.MethodPut, update.Method)
+	assert.Equal(t, "/private/api/"+app.KebabPluralName()+"/{id}", update.Path, "Update should be served from the resource path")
+
+	_, ok = info.Endpoints["update-legacy"]
+	assert.False(t, ok, "Legacy endpoints should not be listed")
+
+	assert.True(t, info.Operations[builder.OperationRead], "Visitors should be allowed to read")
+	assert.False(t, info.Operations[builder.OperationDelete], "Visitors should not be allowed to delete")
+	assert.Equal(t, []string{"required", "email"}, info.Validators["email"])
+}
@@ -0,0 +1,693 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/invopop/jsonschema"
+	"gorm.io/gorm"
+)
+
+const (
+	GoClientFilePath       = "client/client.go"
+	DefaultGoClientPackage = "client"
+)
+
+// goClientReserved are the names of the types of the generated client, which can't be used
+// by the models.
+var goClientReserved = map[string]bool{
+	"Client":          true,
+	"Error":           true,
+	"Option":          true,
+	"ListOptions":     true,
+	"Pagination":      true,
+	"TokenSource":     true,
+	"TokenSourceFunc": true,
+	"StaticToken":     true,
+}
+
+// isEnvelopeRoute returns false for the routes that don't respond with a Response, e.g. the
+// GraphQL endpoint and the API explorer, which the generated clients can't decode.
+func isEnvelopeRoute(route string) bool {
+	for _, raw := range []string{GraphQLRoute, OpenAPIRoute, OpenAPIDocsRoute} {
+		if route == raw || strings.HasPrefix(route, raw+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+var goIdentifierRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// commentLines returns the lines of the given text, trimmed, to be written as a comment.
+func commentLines(text string) []string {
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(strings.TrimSpace(text))
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return lines
+}
+
+// goComment returns the given text as a Go comment with the given indentation, a // per line.
+func goComment(text string, indent string) string {
+	var comment strings.Builder
+	for _, line := range commentLines(text) {
+		comment.WriteString(strings.TrimRight(indent+"// "+line, " ") + "\n")
+	}
+	return comment.String()
+}
+
+// goIdentifier returns the exported Go identifier of the given name, e.g. created-by-id is CreatedByID.
+func goIdentifier(name string) string {
+	output := ""
+	for _, part := range goIdentifierRegex.Split(name, -1) {
+		output += upperFirst(part)
+	}
+
+	if strings.HasSuffix(output, "Id") {
+		output = strings.TrimSuffix(output, "Id") + "ID"
+	}
+	if output == "" || (output[0] >= '0' && output[0] <= '9') {
+		output = "X" + output
+	}
+
+	return output
+}
+
+// goClientApp is an App in the generated client.
+type goClientApp struct {
+	Name    string // Name of the model type
+	Input   string // Name of the input type
+	Service string // Name of the service type
+	Field   string // Field of the service in the Client
+	Plural  string
+	List    *EndpointInfo
+	Get     *EndpointInfo
+	Create  *EndpointInfo
+	Update  *EndpointInfo
+	Delete  *EndpointInfo
+}
+
+// goClientPath is a route that is not part of an App, which can be called with Client.Do.
+type goClientPath struct {
+	Name string
+	Path string
+}
+
+// goClientGenerator builds the Go types of the client from the JSON schemas of the Apps.
+type goClientGenerator struct {
+	types map[string]string // Source of the struct types by name
+	names map[string]string // Go names of the definitions by definition name
+}
+
+// typeName returns the Go name of the given definition, which is renamed if it is reserved.
+func (g *goClientGenerator) typeName(name string) string {
+	if goName, ok := g.names[name]; ok {
+		return goName
+	}
+
+	goName := goIdentifier(name)
+	if goClientReserved[goName] {
+		goName += "Record"
+	}
+	g.names[name] = goName
+	return goName
+}
+
+// goType returns the Go type of the given JSON schema, and adds the struct types it needs.
+func (g *goClientGenerator) goType(name string, schema *jsonschema.Schema, defs jsonschema.Definitions) string {
+	if schema.Ref != "" {
+		defName := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		definition, ok := defs[defName]
+		if !ok {
+			return "json.RawMessage"
+		}
+		return g.goType(defName, definition, defs)
+	}
+
+	switch schema.Type {
+	case "string":
+		if schema.Format == "date-time" {
+			return "*time.Time"
+		}
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		if schema.Items == nil {
+			return "[]json.RawMessage"
+		}
+		return "[]" + strings.TrimPrefix(g.goType(name, schema.Items, defs), "*")
+	case "object":
+		if schema.Properties == nil || schema.Properties.Len() == 0 {
+			return "map[string]interface{}"
+		}
+		return "*" + g.addStruct(name, schema, defs)
+	}
+
+	return "json.RawMessage"
+}
+
+// addStruct adds the struct type of the given JSON schema object, and returns its name.
+func (g *goClientGenerator) addStruct(name string, schema *jsonschema.Schema, defs jsonschema.Definitions) string {
+	goName := g.typeName(name)
+	if _, ok := g.types[goName]; ok {
+		return goName
+	}
+	// reserve the name first, so recursive types end
+	g.types[goName] = ""
+
+	var source strings.Builder
+	fmt.Fprintf(&source, "// %s is a record of %s.\n", goName, name)
+	fmt.Fprintf(&source, "type %s struct {\n", goName)
+
+	used := make(map[string]bool)
+	for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		field := goIdentifier(pair.Key)
+		if used[field] {
+			continue
+		}
+		used[field] = true
+
+		fieldType := g.goType(goName+field, pair.Value, defs)
+		if pair.Value.Description != "" {
+			source.WriteString(goComment(pair.Value.Description, "\t"))
+		}
+		fmt.Fprintf(&source, "\t%s %s `json:\"%s\"`\n", field, fieldType, pair.Key)
+	}
+	source.WriteString("}\n")
+
+	g.types[goName] = source.String()
+	return goName
+}
+
+// addInput adds the input type of the create and update requests of the App, whose fields
+// are pointers, so only the fields that are set are sent.
+func (g *goClientGenerator) addInput(app *App, name string, schema *jsonschema.Schema, definition *jsonschema.Schema) {
+	var source strings.Builder
+	fmt.Fprintf(&source, "// %s is the body of the create and update requests of %s.\n", name, app.Name())
+	fmt.Fprintf(&source, "// Only the fields that are set are sent.\n")
+	fmt.Fprintf(&source, "type %s struct {\n", name)
+
+	var db *gorm.DB
+	if database := app.getDatabase(); database != nil {
+		db = database.DB
+	}
+
+	used := make(map[string]bool)
+	for _, key := range app.GetInputFields(db) {
+		property, ok := definition.Properties.Get(key)
+		field := goIdentifier(key)
+		if !ok || used[field] {
+			continue
+		}
+		used[field] = true
+
+		fieldType := g.goType(name+field, property, schema.Definitions)
+		if !strings.HasPrefix(fieldType, "*") && !strings.HasPrefix(fieldType, "[]") &&
+			!strings.HasPrefix(fieldType, "map[") && fieldType != "json.RawMessage" {
+			fieldType = "*" + fieldType
+		}
+		fmt.Fprintf(&source, "\t%s %s `json:\"%s,omitempty\"`\n", field, fieldType, key)
+	}
+	source.WriteString("}\n")
+
+	g.types[name] = source.String()
+}
+
+// GetGoClient returns the source of a Go package with a typed client of the API:
+//   - a struct for the model of each App, and an input struct for its create and update requests.
+//   - a service for each App with List, Get, Create, Update and Delete methods, for the
+//     endpoints registered in the server.
+//   - ListOptions with the pagination, order, search, taxonomy and filters of the lists.
+//   - Error, which can be compared with ErrNotFound, ErrForbidden, etc. using errors.Is.
+//   - a pluggable TokenSource, which returns the token sent in the Authorization header.
+//   - the paths of the other routes, which can be called with Client.Do.
+//
+// Parameters:
+// - packageName: the name of the generated package, e.g. "client".
+//
+// Returns:
+// - []byte: the formatted source of the package.
+// - error: an error if the source can't be generated.
+func (b *Builder) GetGoClient(packageName string) ([]byte, error) {
+	if packageName == "" {
+		packageName = DefaultGoClientPackage
+	}
+
+	g := &goClientGenerator{
+		types: make(map[string]string),
+		names: make(map[string]string),
+	}
+
+	apps := b.Admin.GetApps()
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name() < apps[j].Name()
+	})
+
+	routes := b.Server.GetRoutes()
+	params := &RequestParameters{}
+
+	clientApps := make([]goClientApp, 0)
+	appRoutes := make(map[string]bool)
+	usedFields := make(map[string]bool)
+	for _, app := range apps {
+		schema := app.GetSchema()
+		definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+		if !ok || definition.Properties == nil {
+			continue
+		}
+
+		name := g.addStruct(strings.TrimPrefix(schema.Ref, "#/$defs/"), definition, schema.Definitions)
+		input := name + "Input"
+		g.addInput(&app, input, schema, definition)
+
+		field := goIdentifier(app.PluralName())
+		if usedFields[field] {
+			field = name + "List"
+		}
+		usedFields[field] = true
+
+		clientApp := goClientApp{
+			Name:    name,
+			Input:   input,
+			Service: name + "Service",
+			Field:   field,
+			Plural:  app.PluralName(),
+		}
+
+		info := app.GetInfo(routes, params, "")
+		endpoint := func(name string) *EndpointInfo {
+			if endpoint, ok := info.Endpoints[name]; ok {
+				return &endpoint
+			}
+			return nil
+		}
+		clientApp.List = endpoint("list")
+		clientApp.Get = endpoint("get")
+		clientApp.Create = endpoint("new")
+		clientApp.Update = endpoint("update")
+		clientApp.Delete = endpoint("delete")
+
+		for _, endpoint := range info.Endpoints {
+			appRoutes[endpoint.Path] = true
+		}
+
+		clientApps = append(clientApps, clientApp)
+	}
+
+	paths := make([]goClientPath, 0)
+	usedPaths := make(map[string]bool)
+	for _, route := range routes {
+		path := route.Route
+		if route.RequiresAuth {
+			path = privatePrefix + path
+		}
+		name := "Path" + goIdentifier(route.Name)
+		if route.Name == "" || route.Legacy || appRoutes[path] || usedPaths[name] || !isEnvelopeRoute(route.Route) {
+			continue
+		}
+		usedPaths[name] = true
+		paths = append(paths, goClientPath{Name: name, Path: path})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Name < paths[j].Name
+	})
+
+	typeNames := make([]string, 0, len(g.types))
+	for name := range g.types {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+
+	types := make([]string, 0, len(typeNames))
+	for _, name := range typeNames {
+		types = append(types, g.types[name])
+	}
+
+	var source bytes.Buffer
+	err := goClientTemplate.Execute(&source, map[string]interface{}{
+		"Package": packageName,
+		"Title":   strings.Join(commentLines(GetAppName()), " "),
+		"Apps":    clientApps,
+		"Paths":   paths,
+		"Types":   types,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := format.Source(source.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting client: %w", err)
+	}
+
+	return output, nil
+}
+
+// ExportGoClient writes the Go client of the API to GoClientFilePath, see GetGoClient.
+func (b *Builder) ExportGoClient(packageName string) error {
+	source, err := b.GetGoClient(packageName)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(GoClientFilePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(GoClientFilePath, source, 0644)
+}
+
+// goClientTemplate is the source of the generated client, formatted with go/format.
+var goClientTemplate = template.Must(template.New("client").Parse(`// Code generated by cms-builder. DO NOT EDIT.
+
+// Package {{.Package}} is a typed client of the {{.Title}} API.
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of the HTTP client created by New.
+const DefaultTimeout = 30 * time.Second
+
+{{- if .Paths}}
+
+// Paths of the other routes of the API, which can be called with Client.Do.
+const (
+{{- range .Paths}}
+	{{.Name}} = "{{.Path}}"
+{{- end}}
+)
+{{- end}}
+
+// TokenSource returns the token sent in the Authorization header of the requests.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc is a function that returns the token of the requests.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token returns the token of the requests.
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticToken is a TokenSource that always returns the same token.
+type StaticToken string
+
+// Token returns the token of the requests.
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Error is returned when the API responds with an error.
+type Error struct {
+	StatusCode int
+	Message    string
+	Data       json.RawMessage // Details of the error, e.g. the validation errors
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is reports whether the target is an Error with the same status code, so the errors can be
+// compared with errors.Is(err, ErrNotFound).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.StatusCode == e.StatusCode
+}
+
+var (
+	ErrBadRequest   = &Error{StatusCode: http.StatusBadRequest, Message: "bad request"}
+	ErrUnauthorized = &Error{StatusCode: http.StatusUnauthorized, Message: "unauthorized"}
+	ErrForbidden    = &Error{StatusCode: http.StatusForbidden, Message: "forbidden"}
+	ErrNotFound     = &Error{StatusCode: http.StatusNotFound, Message: "not found"}
+	ErrConflict     = &Error{StatusCode: http.StatusConflict, Message: "conflict"}
+)
+
+// Pagination is the page of the records returned by the lists.
+type Pagination struct {
+	Total int64 ` + "`json:\"total\"`" + `
+	Page  int   ` + "`json:\"page\"`" + `
+	Limit int   ` + "`json:\"limit\"`" + `
+}
+
+// response is the envelope of the responses of the API.
+type response struct {
+	Success    bool            ` + "`json:\"success\"`" + `
+	Data       json.RawMessage ` + "`json:\"data\"`" + `
+	Message    string          ` + "`json:\"message\"`" + `
+	Pagination *Pagination     ` + "`json:\"pagination\"`" + `
+}
+
+// ListOptions are the parameters of the lists.
+type ListOptions struct {
+	Page     int
+	Limit    int
+	Order    string            // e.g. "-createdAt,title"
+	Search   string
+	Locale   string
+	Tag      string            // Slug of a tag
+	Category string            // Slug of a category
+	Filters  map[string]string // Values of the list filters, by field
+}
+
+// values returns the query parameters of the options.
+func (o *ListOptions) values() url.Values {
+	values := url.Values{}
+	if o == nil {
+		return values
+	}
+
+	for field, value := range o.Filters {
+		values.Set(field, value)
+	}
+	if o.Page > 0 {
+		values.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	for key, value := range map[string]string{
+		"order":    o.Order,
+		"search":   o.Search,
+		"locale":   o.Locale,
+		"tag":      o.Tag,
+		"category": o.Category,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	return values
+}
+
+// Option configures the Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client of the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithTokenSource sets the source of the token of the requests.
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(c *Client) {
+		c.TokenSource = tokenSource
+	}
+}
+
+// Client calls the {{.Title}} API.
+type Client struct {
+	BaseURL     string
+	HTTPClient  *http.Client
+	TokenSource TokenSource
+{{range .Apps}}
+	{{.Field}} *{{.Service}}
+{{- end}}
+}
+
+// New returns a Client of the API served at the given base url, e.g. https://cms.example.com.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, option := range options {
+		option(c)
+	}
+{{range .Apps}}
+	c.{{.Field}} = &{{.Service}}{client: c}
+{{- end}}
+	return c
+}
+
+// Do sends a request to the given path of the API, and decodes the data of the response into out.
+//
+// Returns the pagination of the response, if any, or an *Error if the API responds with an error.
+func (c *Client) Do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) (*Pagination, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.TokenSource != nil {
+		token, err := c.TokenSource.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting token: %w", err)
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	res, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope response
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		if res.StatusCode >= http.StatusBadRequest {
+			return nil, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest || !envelope.Success {
+		return nil, &Error{StatusCode: res.StatusCode, Message: envelope.Message, Data: envelope.Data}
+	}
+
+	if out != nil && len(envelope.Data) > 0 {
+		err = json.Unmarshal(envelope.Data, out)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding data: %w", err)
+		}
+	}
+
+	return envelope.Pagination, nil
+}
+
+// withID returns the given path with the id of a record.
+func withID(path string, id uint) string {
+	return strings.Replace(path, "{id}", strconv.FormatUint(uint64(id), 10), 1)
+}
+{{range .Apps}}
+// {{.Service}} calls the endpoints of the {{.Plural}}.
+type {{.Service}} struct {
+	client *Client
+}
+{{- if .List}}
+
+// List returns a page of {{.Plural}}.
+func (s *{{.Service}}) List(ctx context.Context, options *ListOptions) ([]{{.Name}}, *Pagination, error) {
+	var output []{{.Name}}
+	pagination, err := s.client.Do(ctx, "{{.List.Method}}", "{{.List.Path}}", options.values(), nil, &output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, pagination, nil
+}
+{{- end}}
+{{- if .Get}}
+
+// Get returns the {{.Name}} with the given id.
+func (s *{{.Service}}) Get(ctx context.Context, id uint) (*{{.Name}}, error) {
+	var output {{.Name}}
+	_, err := s.client.Do(ctx, "{{.Get.Method}}", withID("{{.Get.Path}}", id), nil, nil, &output)
+	if err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+{{- end}}
+{{- if .Create}}
+
+// Create creates a {{.Name}}.
+func (s *{{.Service}}) Create(ctx context.Context, input *{{.Input}}) (*{{.Name}}, error) {
+	var output {{.Name}}
+	_, err := s.client.Do(ctx, "{{.Create.Method}}", "{{.Create.Path}}", nil, input, &output)
+	if err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+{{- end}}
+{{- if .Update}}
+
+// Update updates the fields of the {{.Name}} with the given id that are set in the input.
+func (s *{{.Service}}) Update(ctx context.Context, id uint, input *{{.Input}}) (*{{.Name}}, error) {
+	var output {{.Name}}
+	_, err := s.client.Do(ctx, "{{.Update.Method}}", withID("{{.Update.Path}}", id), nil, input, &output)
+	if err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+{{- end}}
+{{- if .Delete}}
+
+// Delete deletes the {{.Name}} with the given id.
+func (s *{{.Service}}) Delete(ctx context.Context, id uint) error {
+	_, err := s.client.Do(ctx, "{{.Delete.Method}}", withID("{{.Delete.Path}}", id), nil, nil, nil)
+	return err
+}
+{{- end}}
+{{end}}
+{{- range .Types}}
+{{.}}
+{{end}}`))
@@ -0,0 +1,52 @@
+package builder_test
+
+import (
+	"os"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockGoClientStruct struct {
+	*builder.SystemData
+	Title   string `json:"title"`
+	Summary string `json:"summary" jsonschema_description:"Shown in the lists.\nUp to 200 characters."`
+}
+
+// TestGetGoClient tests that the client has the types and the CRUD methods of the Apps.
+func TestGetGoClient(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockGoClientStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	source, err := e.Engine.GetGoClient("cms")
+	assert.NoError(t, err, "GetGoClient should not return an error")
+
+	code := string(source)
+	assert.Contains(t, code, "package cms")
+	assert.Contains(t, code, "type MockGoClientStruct struct")
+	assert.Contains(t, code, "\t// Shown in the lists.\n\t// Up to 200 characters.\n", "Descriptions should be a comment per line")
+	assert.Contains(t, code, "Title *string `json:\"title,omitempty\"`", "Inputs should only send the fields that are set")
+	assert.Contains(t, code, "func (s *MockGoClientStructService) List(ctx context.Context, options *ListOptions)")
+	assert.Contains(t, code, "\"PUT\", withID(\"/private/api/"+app.KebabPluralName()+"/{id}\", id)")
+	assert.Contains(t, code, "func (s *MockGoClientStructService) Delete(ctx context.Context, id uint) error")
+}
+
+// TestExportGoClient tests that the client is written to its file.
+func TestExportGoClient(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	err = e.Engine.ExportGoClient(builder.DefaultGoClientPackage)
+	assert.NoError(t, err, "ExportGoClient should not return an error")
+	defer os.Remove(builder.GoClientFilePath)
+
+	assert.FileExists(t, builder.GoClientFilePath, "GoClientFilePath should exist")
+}
@@ -0,0 +1,1020 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/invopop/jsonschema"
+)
+
+// GraphQLRoute is the path of the GraphQL endpoint.
+const GraphQLRoute = "/graphql"
+
+// graphQLRequestKey is the key of the GraphQL request in the context of the resolvers.
+const graphQLRequestKey requestContextKey = "graphql-request"
+
+// GraphQLRequest is the body of the requests to the GraphQL endpoint.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+var graphQLNameRegex = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// GraphQLJSON is the scalar of the values without a GraphQL type, e.g. the objects of the
+// content types and the dynamic fields of the models.
+var GraphQLJSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: parseGraphQLLiteral,
+})
+
+var graphQLPagination = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Pagination",
+	Fields: graphql.Fields{
+		"total": &graphql.Field{Type: graphql.Int},
+		"page":  &graphql.Field{Type: graphql.Int},
+		"limit": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+// parseGraphQLLiteral returns the Go value of a literal of the JSON scalar.
+func parseGraphQLLiteral(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.StringValue:
+		return value.Value
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.IntValue:
+		if n, err := strconv.ParseInt(value.Value, 10, 64); err == nil {
+			return n
+		}
+		return nil
+	case *ast.FloatValue:
+		if n, err := strconv.ParseFloat(value.Value, 64); err == nil {
+			return n
+		}
+		return nil
+	case *ast.EnumValue:
+		return value.Value
+	case *ast.ListValue:
+		output := make([]interface{}, 0, len(value.Values))
+		for _, item := range value.Values {
+			output = append(output, parseGraphQLLiteral(item))
+		}
+		return output
+	case *ast.ObjectValue:
+		output := make(map[string]interface{}, len(value.Fields))
+		for _, field := range value.Fields {
+			output[field.Name.Value] = parseGraphQLLiteral(field.Value)
+		}
+		return output
+	}
+	return nil
+}
+
+// graphQLSchemaBuilder builds the GraphQL types from the JSON schemas of the Apps.
+type graphQLSchemaBuilder struct {
+	admin   *Admin
+	db      *Database
+	apps    map[string]App             // Apps by type name
+	objects map[string]*graphql.Object // Object types by name
+}
+
+// GetGraphQLSchema returns the GraphQL schema of the registered Apps, with:
+//   - a type for each App, built from its JSON schema.
+//   - the queries {app}(id) and {apps}(page, limit, order, search, locale, tag, category, filter).
+//   - the mutations create{App}(input), update{App}(id, input) and delete{App}(id).
+//
+// The schema is built on the first request, and rebuilt after an App is registered or unregistered.
+// Concurrent requests wait for the schema being built instead of building it again.
+func (a *Admin) GetGraphQLSchema() (*graphql.Schema, error) {
+	a.mu.RLock()
+	schema := a.graphQLSchema
+	a.mu.RUnlock()
+
+	if schema != nil {
+		return schema, nil
+	}
+
+	a.graphQLMu.Lock()
+	defer a.graphQLMu.Unlock()
+
+	// another request may have built it while this one waited
+	a.mu.RLock()
+	schema, version := a.graphQLSchema, a.version
+	a.mu.RUnlock()
+
+	if schema != nil {
+		return schema, nil
+	}
+
+	schema, err := a.buildGraphQLSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	// the schema is left out if an App was registered or unregistered while it was built
+	a.mu.Lock()
+	if a.version == version {
+		a.graphQLSchema = schema
+	}
+	a.mu.Unlock()
+
+	return schema, nil
+}
+
+// buildGraphQLSchema builds the GraphQL schema of the registered Apps.
+func (a *Admin) buildGraphQLSchema() (*graphql.Schema, error) {
+	apps := a.GetApps()
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name() < apps[j].Name()
+	})
+
+	b := &graphQLSchemaBuilder{
+		admin:   a,
+		db:      a.Builder.DB,
+		apps:    make(map[string]App),
+		objects: make(map[string]*graphql.Object),
+	}
+
+	// the types of the Apps are created first, so the relations can point to them
+	schemas := make(map[string]*jsonschema.Schema)
+	for _, app := range apps {
+		name := app.Name()
+		if !graphQLNameRegex.MatchString(name) {
+			log.Warn().Str("app", name).Msg("App name is not a valid GraphQL name, skipping")
+			continue
+		}
+
+		schema := app.GetSchema()
+		definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+		if !ok {
+			continue
+		}
+
+		b.apps[name] = app
+		schemas[name] = schema
+		b.objects[name] = b.newObject(name, app.appFields(b, definition, schema.Definitions))
+	}
+
+	queries := graphql.Fields{}
+	mutations := graphql.Fields{}
+	for _, app := range apps {
+		schema, ok := schemas[app.Name()]
+		if !ok {
+			continue
+		}
+		app.addGraphQLQueries(b, queries)
+		app.addGraphQLMutations(b, mutations, schema)
+	}
+
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no apps registered")
+	}
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queries}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutations}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+// newObject returns an Object type whose fields are computed when the schema is built.
+func (b *graphQLSchemaBuilder) newObject(name string, fields func() graphql.Fields) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:   name,
+		Fields: graphql.FieldsThunk(fields),
+	})
+}
+
+// objectFields returns the fields of the given JSON schema object.
+func (b *graphQLSchemaBuilder) objectFields(name string, definition *jsonschema.Schema, defs jsonschema.Definitions) graphql.Fields {
+	fields := graphql.Fields{}
+	if definition.Properties == nil {
+		return fields
+	}
+
+	for pair := definition.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		if !graphQLNameRegex.MatchString(pair.Key) {
+			continue
+		}
+		fields[pair.Key] = &graphql.Field{
+			Type:        b.outputType(name+upperFirst(pair.Key), pair.Value, defs),
+			Description: pair.Value.Description,
+		}
+	}
+
+	// an object needs at least one field
+	if len(fields) == 0 {
+		fields["_empty"] = &graphql.Field{Type: graphql.Boolean}
+	}
+
+	return fields
+}
+
+// outputType returns the GraphQL type of the given JSON schema. Objects are named after
+// their definition, or after the given name if they are inlined.
+func (b *graphQLSchemaBuilder) outputType(name string, schema *jsonschema.Schema, defs jsonschema.Definitions) graphql.Output {
+	if schema.Ref != "" {
+		defName := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		if object, ok := b.objects[defName]; ok {
+			return object
+		}
+
+		definition, ok := defs[defName]
+		if !ok || !graphQLNameRegex.MatchString(defName) {
+			return GraphQLJSON
+		}
+		return b.outputType(defName, definition, defs)
+	}
+
+	switch schema.Type {
+	case "string":
+		return graphql.String
+	case "integer":
+		return graphql.Int
+	case "number":
+		return graphql.Float
+	case "boolean":
+		return graphql.Boolean
+	case "array":
+		if schema.Items == nil {
+			return graphql.NewList(GraphQLJSON)
+		}
+		return graphql.NewList(b.outputType(name, schema.Items, defs))
+	case "object":
+		if schema.Properties == nil || schema.Properties.Len() == 0 {
+			return GraphQLJSON
+		}
+		if object, ok := b.objects[name]; ok {
+			return object
+		}
+		object := b.newObject(name, func() graphql.Fields {
+			return b.objectFields(name, schema, defs)
+		})
+		b.objects[name] = object
+		return object
+	}
+
+	return GraphQLJSON
+}
+
+// inputType returns the GraphQL input type of the given JSON schema. Objects are read as JSON.
+func (b *graphQLSchemaBuilder) inputType(schema *jsonschema.Schema, defs jsonschema.Definitions) graphql.Input {
+	if schema.Ref != "" {
+		definition, ok := defs[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+		if !ok {
+			return GraphQLJSON
+		}
+		return b.inputType(definition, defs)
+	}
+
+	switch schema.Type {
+	case "string":
+		return graphql.String
+	case "integer":
+		return graphql.Int
+	case "number":
+		return graphql.Float
+	case "boolean":
+		return graphql.Boolean
+	case "array":
+		if schema.Items == nil {
+			return graphql.NewList(GraphQLJSON)
+		}
+		return graphql.NewList(b.inputType(schema.Items, defs))
+	}
+
+	return GraphQLJSON
+}
+
+// appFields returns the fields of the type of the App: the fields of its model, and the
+// records it references, which are fetched from the Apps they belong to.
+func (a *App) appFields(b *graphQLSchemaBuilder, definition *jsonschema.Schema, defs jsonschema.Definitions) func() graphql.Fields {
+	return func() graphql.Fields {
+		fields := b.objectFields(a.Name(), definition, defs)
+
+		for _, relation := range a.GetRelationsInfo(b.db.DB) {
+			related, ok := b.apps[relation.App]
+			if !ok || relation.ForeignKey == "" {
+				continue
+			}
+
+			switch relation.Type {
+			case "belongs_to":
+				fields[relation.Field] = &graphql.Field{
+					Type:    b.objects[related.Name()],
+					Resolve: related.resolveRelated(b.db, relation.Field, relation.ForeignKey),
+				}
+			case "parent":
+				fields["parent"] = &graphql.Field{
+					Type:    b.objects[related.Name()],
+					Resolve: related.resolveRelated(b.db, "parent", relation.ForeignKey),
+				}
+				fields["children"] = &graphql.Field{
+					Type:    graphql.NewList(b.objects[related.Name()]),
+					Resolve: related.resolveChildren(b.db),
+				}
+			}
+		}
+
+		return fields
+	}
+}
+
+// inputFields returns the fields of the input of the mutations of the App, which are the
+// fields of its model that can be written.
+func (a *App) inputFields(b *graphQLSchemaBuilder, schema *jsonschema.Schema) graphql.InputObjectConfigFieldMap {
+	fields := graphql.InputObjectConfigFieldMap{}
+
+	definition := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	if definition == nil || definition.Properties == nil {
+		return fields
+	}
+
+	for _, key := range a.GetInputFields(b.db.DB) {
+		property, ok := definition.Properties.Get(key)
+		if !ok || !graphQLNameRegex.MatchString(key) {
+			continue
+		}
+		fields[key] = &graphql.InputObjectFieldConfig{
+			Type:        b.inputType(property, schema.Definitions),
+			Description: property.Description,
+		}
+	}
+
+	return fields
+}
+
+// addGraphQLQueries adds the detail and list queries of the App.
+func (a *App) addGraphQLQueries(b *graphQLSchemaBuilder, queries graphql.Fields) {
+	object := b.objects[a.Name()]
+	detailName := lowerFirst(a.Name())
+	listName := lowerFirst(a.PluralName())
+	if listName == detailName {
+		listName += "List"
+	}
+
+	queries[detailName] = &graphql.Field{
+		Type:        object,
+		Description: "Returns the " + a.Name() + " with the given id",
+		Args: graphql.FieldConfigArgument{
+			"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			"locale": &graphql.ArgumentConfig{Type: graphql.String},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphQLId(p.Args["id"])
+			if err != nil {
+				return nil, err
+			}
+
+			query := url.Values{}
+			if locale, ok := p.Args["locale"].(string); ok {
+				query.Set("locale", locale)
+			}
+
+			response, err := callGraphQLHandler(p.Context, a.ApiDetail(b.db), http.MethodGet, map[string]string{"id": id}, query, nil)
+			if err != nil {
+				return nil, err
+			}
+			return response.Data, nil
+		},
+	}
+
+	page := graphql.NewObject(graphql.ObjectConfig{
+		Name: a.Name() + "Page",
+		Fields: graphql.Fields{
+			"items":      &graphql.Field{Type: graphql.NewList(object)},
+			"pagination": &graphql.Field{Type: graphQLPagination},
+		},
+	})
+
+	queries[listName] = &graphql.Field{
+		Type:        page,
+		Description: "Returns a page of " + a.PluralName(),
+		Args: graphql.FieldConfigArgument{
+			"page":     &graphql.ArgumentConfig{Type: graphql.Int},
+			"limit":    &graphql.ArgumentConfig{Type: graphql.Int},
+			"order":    &graphql.ArgumentConfig{Type: graphql.String},
+			"search":   &graphql.ArgumentConfig{Type: graphql.String},
+			"locale":   &graphql.ArgumentConfig{Type: graphql.String},
+			"tag":      &graphql.ArgumentConfig{Type: graphql.String},
+			"category": &graphql.ArgumentConfig{Type: graphql.String},
+			"filter":   &graphql.ArgumentConfig{Type: GraphQLJSON, Description: "Values of the list filters, e.g. {published: true}"},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if limit, ok := p.Args["limit"].(int); ok {
+				err := checkGraphQLLimit(limit)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			query := url.Values{}
+			if filter, ok := p.Args["filter"].(map[string]interface{}); ok {
+				for key, value := range filter {
+					query.Set(key, fmt.Sprint(value))
+				}
+			}
+			for key, value := range p.Args {
+				if key != "filter" {
+					query.Set(key, fmt.Sprint(value))
+				}
+			}
+
+			response, err := callGraphQLHandler(p.Context, a.ApiList(b.db), http.MethodGet, nil, query, nil)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"items":      response.Data,
+				"pagination": response.Pagination,
+			}, nil
+		},
+	}
+}
+
+// addGraphQLMutations adds the create, update and delete mutations of the App.
+func (a *App) addGraphQLMutations(b *graphQLSchemaBuilder, mutations graphql.Fields, schema *jsonschema.Schema) {
+	object := b.objects[a.Name()]
+
+	var input graphql.Input = GraphQLJSON
+	if fields := a.inputFields(b, schema); len(fields) > 0 {
+		input = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:   a.Name() + "Input",
+			Fields: fields,
+		})
+	}
+
+	mutations["create"+a.Name()] = &graphql.Field{
+		Type:        object,
+		Description: "Creates a " + a.Name(),
+		Args: graphql.FieldConfigArgument{
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			response, err := callGraphQLHandler(p.Context, a.ApiCreate(b.db), http.MethodPost, nil, nil, p.Args["input"])
+			if err != nil {
+				return nil, err
+			}
+			return response.Data, nil
+		},
+	}
+
+	mutations["update"+a.Name()] = &graphql.Field{
+		Type:        object,
+		Description: "Updates the given fields of a " + a.Name(),
+		Args: graphql.FieldConfigArgument{
+			"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphQLId(p.Args["id"])
+			if err != nil {
+				return nil, err
+			}
+
+			response, err := callGraphQLHandler(p.Context, a.ApiUpdate(b.db), http.MethodPut, map[string]string{"id": id}, nil, p.Args["input"])
+			if err != nil {
+				return nil, err
+			}
+			return response.Data, nil
+		},
+	}
+
+	mutations["delete"+a.Name()] = &graphql.Field{
+		Type:        graphql.Boolean,
+		Description: "Deletes a " + a.Name(),
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphQLId(p.Args["id"])
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = callGraphQLHandler(p.Context, a.ApiDelete(b.db), http.MethodDelete, map[string]string{"id": id}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return true, nil
+		},
+	}
+}
+
+// resolveRelated returns a resolver of the record of the App referenced by the given foreign
+// key. Records already in the response are not fetched again.
+func (a *App) resolveRelated(db *Database, field string, foreignKey string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		source, ok := p.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+
+		if record, ok := source[field].(map[string]interface{}); ok && len(record) > 0 {
+			return record, nil
+		}
+
+		id, err := graphQLId(source[foreignKey])
+		if err != nil || id == "0" {
+			return nil, nil
+		}
+
+		response, err := callGraphQLHandler(p.Context, a.ApiDetail(db), http.MethodGet, map[string]string{"id": id}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return response.Data, nil
+	}
+}
+
+// resolveChildren returns a resolver of the children of the records of a tree.
+func (a *App) resolveChildren(db *Database) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		source, ok := p.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+
+		id, err := graphQLId(source["ID"])
+		if err != nil {
+			return nil, nil
+		}
+
+		response, err := callGraphQLHandler(p.Context, a.ApiChildren(db), http.MethodGet, map[string]string{"id": id}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return response.Data, nil
+	}
+}
+
+// graphQLId returns the given id as a string, or an error if it is not a number.
+func graphQLId(value interface{}) (string, error) {
+	var id string
+	switch value := value.(type) {
+	case string:
+		id = value
+	case float64:
+		id = strconv.FormatFloat(value, 'f', -1, 64)
+	case int, int64, uint:
+		id = fmt.Sprint(value)
+	default:
+		return "", fmt.Errorf("invalid id")
+	}
+
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid id: %s", id)
+	}
+	return id, nil
+}
+
+// callGraphQLHandler calls the given handler of an App with a request made from the GraphQL
+// request, so permissions, ownership, validations and history are the ones of the REST API.
+//
+// Returns the response of the handler, or an error with its message if it failed.
+func callGraphQLHandler(ctx context.Context, handler HandlerFunc, method string, vars map[string]string, query url.Values, body interface{}) (*Response, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, GraphQLRoute, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if original, ok := ctx.Value(graphQLRequestKey).(*http.Request); ok {
+		for _, header := range []string{"Authorization", "Accept-Language"} {
+			if value := original.Header.Get(header); value != "" {
+				request.Header.Set(header, value)
+			}
+		}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if query != nil {
+		request.URL.RawQuery = query.Encode()
+	}
+	if vars != nil {
+		request = mux.SetURLVars(request, vars)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+
+	var response Response
+	err = json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, fmt.Errorf("%s", response.Message)
+	}
+
+	return &response, nil
+}
+
+// upperFirst returns the given string with its first letter uppercased.
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// lowerFirst returns the given string with its first letter lowercased.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// graphQLDefaultLimit is the number of records of the pages queried without a limit, see ApiList.
+const graphQLDefaultLimit = 10
+
+// graphQLMaxLimit is the number of records the pages can have at most.
+const graphQLMaxLimit = 100
+
+// ErrGraphQLLimit is returned when a page is queried with a limit out of bounds.
+var ErrGraphQLLimit = fmt.Errorf("limit must be between 1 and %d", graphQLMaxLimit)
+
+// checkGraphQLLimit returns ErrGraphQLLimit if the given limit of a page is out of bounds.
+func checkGraphQLLimit(limit int) error {
+	if limit < 1 || limit > graphQLMaxLimit {
+		return ErrGraphQLLimit
+	}
+	return nil
+}
+
+// GraphQLLimits bounds the cost of the queries sent to the GraphQL endpoint.
+type GraphQLLimits struct {
+	MaxDepth      int // MaxDepth is the number of levels of nested fields, e.g. 2 for { posts { items } }.
+	MaxComplexity int // MaxComplexity is the number of fields, each field of a page counts once per record.
+}
+
+// graphQLCost measures the depth and the complexity of the selections of an operation.
+type graphQLCost struct {
+	limits     GraphQLLimits
+	variables  map[string]interface{}
+	fragments  map[string]*ast.FragmentDefinition
+	listFields map[string]bool   // listFields are the queries with a limit, which return pages
+	measured   map[string][2]int // measured are the depth and complexity of the fragments
+	visiting   map[string]bool   // visiting are the fragments being measured, to reject cycles
+}
+
+// CheckGraphQLOperation parses the query of the given request and returns the operation to
+// execute, or an error if the query is invalid, or deeper or more complex than the limits.
+//
+// The complexity is the number of fields, and the fields of the pages count once per record,
+// e.g. { posts(limit: 20) { items { id title } } } has a complexity of 1 + 20 * (1 + 2). Pages
+// with a limit out of bounds are rejected, see checkGraphQLLimit.
+func CheckGraphQLOperation(schema *graphql.Schema, request *GraphQLRequest, limits GraphQLLimits) (*ast.OperationDefinition, error) {
+	document, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return nil, err
+	}
+
+	cost := &graphQLCost{
+		limits:     limits,
+		variables:  make(map[string]interface{}),
+		fragments:  make(map[string]*ast.FragmentDefinition),
+		listFields: make(map[string]bool),
+		measured:   make(map[string][2]int),
+		visiting:   make(map[string]bool),
+	}
+
+	var operation *ast.OperationDefinition
+	operations := 0
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			cost.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			operations++
+			if request.OperationName == "" || (definition.Name != nil && definition.Name.Value == request.OperationName) {
+				operation = definition
+			}
+		}
+	}
+
+	if operation == nil {
+		return nil, fmt.Errorf("operation not found: %s", request.OperationName)
+	}
+	if request.OperationName == "" && operations > 1 {
+		return nil, fmt.Errorf("operationName is required when the query has several operations")
+	}
+
+	// the variables that are not sent take their default value
+	for _, definition := range operation.VariableDefinitions {
+		if value, ok := definition.DefaultValue.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				cost.variables[definition.Variable.Name.Value] = n
+			}
+		}
+	}
+	for name, value := range request.Variables {
+		cost.variables[name] = value
+	}
+
+	for name, field := range schema.QueryType().Fields() {
+		for _, arg := range field.Args {
+			if arg.Name() == "limit" {
+				cost.listFields[name] = true
+			}
+		}
+	}
+
+	depth, complexity, err := cost.measure(operation.SelectionSet)
+	if err != nil {
+		return nil, err
+	}
+	if depth > limits.MaxDepth {
+		return nil, fmt.Errorf("query is %d levels deep, the limit is %d", depth, limits.MaxDepth)
+	}
+	if complexity > limits.MaxComplexity {
+		return nil, fmt.Errorf("query has a complexity of %d, the limit is %d", complexity, limits.MaxComplexity)
+	}
+
+	return operation, nil
+}
+
+// measure returns the depth and the complexity of the given selections. It stops as soon as
+// they are over the limits, so fragments spread many times can't make it slow.
+func (c *graphQLCost) measure(selectionSet *ast.SelectionSet) (int, int, error) {
+	if selectionSet == nil {
+		return 0, 0, nil
+	}
+
+	depth, complexity := 0, 0
+	for _, selection := range selectionSet.Selections {
+		var d, cx int
+		var err error
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			var multiplier int
+			multiplier, err = c.multiplier(selection)
+			if err != nil {
+				return 0, 0, err
+			}
+			d, cx, err = c.measure(selection.SelectionSet)
+			d, cx = d+1, addGraphQLCost(1, multiplyGraphQLCost(multiplier, cx))
+		case *ast.InlineFragment:
+			d, cx, err = c.measure(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			d, cx, err = c.measureFragment(selection.Name.Value)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		depth = max(depth, d)
+		complexity = addGraphQLCost(complexity, cx)
+		if depth > c.limits.MaxDepth || complexity > c.limits.MaxComplexity {
+			return depth, complexity, nil
+		}
+	}
+
+	return depth, complexity, nil
+}
+
+// measureFragment returns the depth and the complexity of the fragment with the given name.
+func (c *graphQLCost) measureFragment(name string) (int, int, error) {
+	if measured, ok := c.measured[name]; ok {
+		return measured[0], measured[1], nil
+	}
+
+	fragment, ok := c.fragments[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("fragment not found: %s", name)
+	}
+	if c.visiting[name] {
+		return 0, 0, fmt.Errorf("fragment %s spreads itself", name)
+	}
+
+	c.visiting[name] = true
+	depth, complexity, err := c.measure(fragment.SelectionSet)
+	c.visiting[name] = false
+	if err != nil {
+		return 0, 0, err
+	}
+
+	c.measured[name] = [2]int{depth, complexity}
+	return depth, complexity, nil
+}
+
+// multiplier returns the number of records the given field returns, the limit of the pages
+// or 1 for the other fields. It returns ErrGraphQLLimit if the limit is out of bounds.
+func (c *graphQLCost) multiplier(field *ast.Field) (int, error) {
+	if !c.listFields[field.Name.Value] {
+		return 1, nil
+	}
+
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+
+		limit, ok := 0, false
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(value.Value)
+			limit, ok = n, err == nil
+		case *ast.Variable:
+			switch n := c.variables[value.Name.Value].(type) {
+			case nil:
+				return graphQLDefaultLimit, nil
+			case int:
+				limit, ok = n, true
+			case float64:
+				// the value is checked before it's converted, so it can't overflow
+				limit, ok = int(n), n == math.Trunc(n) && n >= 1 && n <= graphQLMaxLimit
+			}
+		}
+		if !ok {
+			return 0, ErrGraphQLLimit
+		}
+
+		err := checkGraphQLLimit(limit)
+		if err != nil {
+			return 0, err
+		}
+		return limit, nil
+	}
+
+	return graphQLDefaultLimit, nil
+}
+
+// addGraphQLCost returns a + b, or math.MaxInt if it overflows. Costs are never negative.
+func addGraphQLCost(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// multiplyGraphQLCost returns a * b, or math.MaxInt if it overflows. Costs are never negative.
+func multiplyGraphQLCost(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// getGraphQLLimits returns the limits of the GraphQL queries, from GRAPHQL_MAX_DEPTH and
+// GRAPHQL_MAX_COMPLEXITY.
+func getGraphQLLimits() GraphQLLimits {
+	limits := GraphQLLimits{
+		MaxDepth:      config.GetInt(EnvKeys.GraphQLMaxDepth),
+		MaxComplexity: config.GetInt(EnvKeys.GraphQLMaxComplexity),
+	}
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth, _ = strconv.Atoi(DefaultEnvValues.GraphQLMaxDepth)
+	}
+	if limits.MaxComplexity <= 0 {
+		limits.MaxComplexity, _ = strconv.Atoi(DefaultEnvValues.GraphQLMaxComplexity)
+	}
+	return limits
+}
+
+// graphQLUserMiddleware verifies the user once per request, for the rate limit and the
+// resolvers. Requests without a valid token are served as anonymous.
+func (a *Admin) graphQLUserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAccessTokenFromRequest(r) != "" {
+			if user := GetRequestUser(r, a.Builder); user != nil {
+				setRequestUser(r, user)
+				r = r.WithContext(context.WithValue(r.Context(), requestUserKey, user))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AddGraphQLRoute adds the GraphQL endpoint of the registered Apps:
+//   - POST /graphql: Executes the query of the body, {"query": "...", "variables": {...}}.
+//   - GET /graphql?query=...: Executes the given query.
+//
+// The user is verified once per request, and the Authorization header is passed on to the
+// resolvers, which have the permissions of the REST API. The requests share the rate limits of
+// the /private routes, per IP before the token is verified and per user after, and the
+// queries are limited in depth and complexity, see GraphQLLimits.
+func (a *Admin) AddGraphQLRoute() {
+	limits := getGraphQLLimits()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request GraphQLRequest
+
+		switch r.Method {
+		case http.MethodGet:
+			request.Query = GetQueryParam("query", r)
+			request.OperationName = GetQueryParam("operationName", r)
+			if variables := GetQueryParam("variables", r); variables != "" {
+				err := json.Unmarshal([]byte(variables), &request.Variables)
+				if err != nil {
+					SendJsonResponse(w, http.StatusBadRequest, nil, "Invalid variables")
+					return
+				}
+			}
+		case http.MethodPost:
+			body, err := ReadRequestBody(r)
+			if err != nil {
+				SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+				return
+			}
+			err = json.Unmarshal(body, &request)
+			if err != nil {
+				SendJsonResponse(w, http.StatusBadRequest, nil, "Invalid request body")
+				return
+			}
+		default:
+			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+			return
+		}
+
+		if request.Query == "" {
+			SendJsonResponse(w, http.StatusBadRequest, nil, "Query is required")
+			return
+		}
+
+		schema, err := a.GetGraphQLSchema()
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		operation, err := CheckGraphQLOperation(schema, &request, limits)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		// GET requests can be sent by links and forms of other sites, so they can't change data
+		if r.Method == http.MethodGet && operation.Operation != ast.OperationTypeQuery {
+			w.Header().Set("Allow", http.MethodPost)
+			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, "Only queries can be sent with GET, use POST")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), graphQLRequestKey, r)
+
+		result := graphql.Do(graphql.Params{
+			Schema:         *schema,
+			RequestString:  request.Query,
+			VariableValues: request.Variables,
+			OperationName:  request.OperationName,
+			Context:        ctx,
+		})
+
+		// the result is sent as is, not in a Response, so GraphQL clients can read it
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			GetRequestLogger(r).Error().Err(err).Msg("Error writing GraphQL response")
+		}
+	}
+
+	svr := a.Builder.Server
+	middlewares := append([]Middleware{}, svr.PreAuth...)
+	middlewares = append(middlewares, a.graphQLUserMiddleware)
+	if svr.userRateLimit != nil {
+		middlewares = append(middlewares, svr.userRateLimit)
+	}
+
+	svr.AddRoute(GraphQLRoute, handler, "graphql", false, http.MethodPost, GraphQLRequest{}, middlewares...)
+	svr.AddRoute(GraphQLRoute, handler, "graphql-query", false, http.MethodGet, nil, middlewares...)
+}
@@ -0,0 +1,190 @@
+package builder_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockGraphQLStruct struct {
+	*builder.SystemData
+	Title string `json:"title"`
+}
+
+// TestGraphQL tests that the records of an App can be created, updated, listed and deleted
+// through the GraphQL endpoint, with the author fetched in the same query.
+func TestGraphQL(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockGraphQLStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	e.Admin.AddGraphQLRoute()
+	defer e.Server.RemoveRoutes(builder.GraphQLRoute)
+	e.Server.Reload()
+
+	authenticated, user, rollback := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollback()
+
+	execute := func(query string, variables map[string]interface{}) map[string]interface{} {
+		body, _ := json.Marshal(builder.GraphQLRequest{Query: query, Variables: variables})
+		request := httptest.NewRequest(http.MethodPost, builder.GraphQLRoute, strings.NewReader(string(body)))
+		request.Header.Set("Authorization", authenticated.Header.Get("Authorization"))
+
+		recorder := httptest.NewRecorder()
+		e.Server.Handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "GraphQL should respond")
+
+		var result map[string]interface{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &result)
+		assert.NoError(t, err, "GraphQL should return JSON")
+		return result
+	}
+
+	t.Log("Creating a record")
+	result := execute(`mutation { createMockGraphQLStruct(input: {title: "Hello"}) { ID title createdBy { email } } }`, nil)
+	assert.Nil(t, result["errors"], "Create should not return errors")
+	created := result["data"].(map[string]interface{})["createMockGraphQLStruct"].(map[string]interface{})
+	assert.Equal(t, "Hello", created["title"])
+	assert.Equal(t, user.Email, created["createdBy"].(map[string]interface{})["email"], "Author should be fetched")
+
+	variables := map[string]interface{}{"id": created["ID"]}
+
+	t.Log("Updating the record")
+	result = execute(`mutation($id: ID!) { updateMockGraphQLStruct(id: $id, input: {title: "World"}) { title } }`, variables)
+	assert.Nil(t, result["errors"], "Update should not return errors")
+
+	t.Log("Listing the records")
+	result = execute(`{ mockGraphQLStructs { items { title } pagination { total } } }`, nil)
+	assert.Nil(t, result["errors"], "List should not return errors")
+	page := result["data"].(map[string]interface{})["mockGraphQLStructs"].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"title": "World"}}, page["items"])
+
+	t.Log("Deleting the record")
+	result = execute(`mutation($id: ID!) { deleteMockGraphQLStruct(id: $id) }`, variables)
+	assert.Nil(t, result["errors"], "Delete should not return errors")
+
+	result = execute(`query($id: ID!) { mockGraphQLStruct(id: $id) { title } }`, variables)
+	assert.NotNil(t, result["errors"], "Deleted record should not be found")
+
+	t.Log("Sending a mutation with GET")
+	query := url.Values{"query": {`mutation { createMockGraphQLStruct(input: {title: "Hello"}) { ID } }`}}
+	request := httptest.NewRequest(http.MethodGet, builder.GraphQLRoute+"?"+query.Encode(), nil)
+	request.Header.Set("Authorization", authenticated.Header.Get("Authorization"))
+
+	recorder := httptest.NewRecorder()
+	e.Server.Handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code, "Mutations should not be sent with GET")
+}
+
+// TestCheckGraphQLOperation tests that the operation to execute is found, and that queries
+// over the depth and complexity limits are rejected.
+func TestCheckGraphQLOperation(t *testing.T) {
+	post := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.ID},
+			"title": &graphql.Field{Type: graphql.String},
+		},
+	})
+	page := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostPage",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{Type: graphql.NewList(post)},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"post":  &graphql.Field{Type: post},
+				"posts": &graphql.Field{Type: page, Args: graphql.FieldConfigArgument{"limit": &graphql.ArgumentConfig{Type: graphql.Int}}},
+			},
+		}),
+	})
+	assert.NoError(t, err, "NewSchema should not return an error")
+
+	limits := builder.GraphQLLimits{MaxDepth: 3, MaxComplexity: 100}
+
+	tests := []struct {
+		name      string
+		request   builder.GraphQLRequest
+		operation string
+		wantErr   bool
+	}{
+		{
+			name:      "query",
+			request:   builder.GraphQLRequest{Query: `{ post { id title } }`},
+			operation: "query",
+		},
+		{
+			name:      "named mutation",
+			request:   builder.GraphQLRequest{Query: `query A { post { id } } mutation B { post { id } }`, OperationName: "B"},
+			operation: "mutation",
+		},
+		{
+			name:    "several operations without a name",
+			request: builder.GraphQLRequest{Query: `query A { post { id } } query B { post { id } }`},
+			wantErr: true,
+		},
+		{
+			name:      "page within the complexity",
+			request:   builder.GraphQLRequest{Query: `{ posts { items { id title } } }`},
+			operation: "query",
+		},
+		{
+			name:    "page over the complexity",
+			request: builder.GraphQLRequest{Query: `query($limit: Int) { posts(limit: $limit) { items { id title } } }`, Variables: map[string]interface{}{"limit": float64(50)}},
+			wantErr: true,
+		},
+		{
+			name:    "fragments over the depth",
+			request: builder.GraphQLRequest{Query: `{ posts { ...Items } } fragment Items on PostPage { items { post { id } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "negative limit",
+			request: builder.GraphQLRequest{Query: `{ posts(limit: -1) { items { id } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "limit over the maximum",
+			request: builder.GraphQLRequest{Query: `query($limit: Int) { posts(limit: $limit) { items { id } } }`, Variables: map[string]interface{}{"limit": float64(1e18)}},
+			wantErr: true,
+		},
+		{
+			name:    "default limit over the maximum",
+			request: builder.GraphQLRequest{Query: `query($limit: Int = 100000) { posts(limit: $limit) { items { id } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "fragments spreading themselves",
+			request: builder.GraphQLRequest{Query: `{ post { ...A } } fragment A on Post { ...A }`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation, err := builder.CheckGraphQLOperation(&schema, &tt.request, limits)
+			if tt.wantErr {
+				assert.Error(t, err, "CheckGraphQLOperation should return an error")
+				return
+			}
+			assert.NoError(t, err, "CheckGraphQLOperation should not return an error")
+			assert.Equal(t, tt.operation, operation.Operation)
+		})
+	}
+}
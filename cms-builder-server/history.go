@@ -32,9 +32,9 @@ type HistoryEntry struct {
 // The HistoryEntry is generated by marshaling the object to JSON, and extracting the ID from it if it exists.
 // The object is expected to be a struct with a JSON tag for the ID field named "ID".
 // The function returns an error if the object cannot be marshaled or unmarshaled to JSON.
-// The function uses the GetStructName function to get the name of the struct from the object passed in.
+// The function uses the GetResourceName function to get the name of the resource from the object passed in.
 func NewLogHistoryEntry(action CRUDAction, user *User, object interface{}) (*HistoryEntry, error) {
-	name := GetStructName(object)
+	name := GetResourceName(object)
 	jsonData, err := json.Marshal(object)
 	if err != nil {
 		return nil, err
@@ -51,7 +51,8 @@ func NewLogHistoryEntry(action CRUDAction, user *User, object interface{}) (*His
 		resourceId = fmt.Sprintf("%v", objJson["ID"])
 	}
 
-	// TODO: maybe worth trying to store just the differences, specially for updates
+	// Full snapshots are stored so any revision can be restored, see ApiRevert.
+	// Differences between revisions are computed on read by DiffHistoryEntries.
 	detail := string(jsonData)
 
 	historyEntry := &HistoryEntry{
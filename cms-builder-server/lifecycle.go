@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is the time the requests in flight have to finish when the Builder stops.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// LifecycleHook is a function called when the Builder starts or stops, see OnStart and OnStop.
+type LifecycleHook func(ctx context.Context) error
+
+// lifecycle holds the hooks of the Builder.
+type lifecycle struct {
+	startHooks []LifecycleHook
+	stopHooks  []LifecycleHook
+}
+
+// OnStart adds a hook that is called by Run before the server starts, in the order they
+// are added. If a hook fails, the Builder stops and Run returns its error.
+func (b *Builder) OnStart(hook LifecycleHook) {
+	b.lifecycle.startHooks = append(b.lifecycle.startHooks, hook)
+}
+
+// OnStop adds a hook that is called when the Builder stops, after the requests in flight
+// and the scheduled jobs are done, and before the database is closed. The hooks are called
+// in the reverse order they are added.
+func (b *Builder) OnStop(hook LifecycleHook) {
+	b.lifecycle.stopHooks = append(b.lifecycle.stopHooks, hook)
+}
+
+// Run calls the start hooks and runs the server until the context is cancelled, or the
+// process receives SIGINT or SIGTERM. Then it stops the Builder, see Shutdown, giving the
+// requests in flight ShutdownTimeout to finish.
+//
+// A second signal while stopping kills the process.
+//
+// Returns:
+// - error: an error if the server fails to start, a start hook fails, or the Builder can't stop cleanly.
+func (b *Builder) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, hook := range b.lifecycle.startHooks {
+		err := hook(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Error running start hook")
+			return errors.Join(err, b.shutdownWithTimeout())
+		}
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- b.Server.Run()
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("Stopping builder")
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Error running server")
+			runErr = err
+		}
+	}
+
+	// restore the default behaviour of the signals, so a second one kills the process
+	stop()
+
+	return errors.Join(runErr, b.shutdownWithTimeout())
+}
+
+// shutdownWithTimeout stops the Builder, giving it ShutdownTimeout to finish.
+func (b *Builder) shutdownWithTimeout() error {
+	timeout := b.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return b.Shutdown(ctx)
+}
+
+// Shutdown stops the Builder:
+//   - the server stops accepting connections, and waits for the requests in flight until the
+//     context is done.
+//   - the scheduler stops, and waits for the running jobs.
+//   - the stop hooks are called.
+//   - the logs are flushed and the database is closed.
+//
+// Every step runs even if a previous one fails.
+//
+// Returns:
+// - error: the errors of the steps that failed, if any.
+func (b *Builder) Shutdown(ctx context.Context) error {
+	errs := make([]error, 0)
+
+	if b.Server != nil && b.Server.Server != nil {
+		err := b.Server.Shutdown(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Error stopping server")
+			errs = append(errs, err)
+		}
+	}
+
+	if b.Scheduler != nil {
+		err := b.Scheduler.Shutdown()
+		if err != nil {
+			log.Error().Err(err).Msg("Error stopping scheduler")
+			errs = append(errs, err)
+		}
+	}
+
+	for i := len(b.lifecycle.stopHooks) - 1; i >= 0; i-- {
+		err := b.lifecycle.stopHooks[i](ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Error running stop hook")
+			errs = append(errs, err)
+		}
+	}
+
+	log.Info().Msg("Builder stopped")
+
+	if b.Scheduler != nil {
+		errs = append(errs, schedulerLogger.Close())
+	}
+	errs = append(errs, b.Logger.Close())
+
+	if b.DB != nil && b.DB.DB != nil {
+		sqlDB, err := b.DB.DB.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
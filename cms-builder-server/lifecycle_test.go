@@ -0,0 +1,67 @@
+package builder_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLifecycleBuilder returns a Builder with its own server, so it can be stopped without
+// affecting the default engine.
+func newLifecycleBuilder(t *testing.T) *builder.Builder {
+	b := &builder.Builder{}
+	b.Admin = builder.NewAdmin(b)
+
+	server, err := builder.NewServer(&builder.ServerConfig{Host: "localhost", Port: "0", Builder: b})
+	assert.NoError(t, err, "NewServer should not return an error")
+	b.Server = server
+
+	return b
+}
+
+// TestRun tests that the hooks are called, and that Run returns once the context is cancelled.
+func TestRun(t *testing.T) {
+	b := newLifecycleBuilder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := make([]string, 0)
+	b.OnStart(func(ctx context.Context) error {
+		calls = append(calls, "start")
+		cancel()
+		return nil
+	})
+	b.OnStop(func(ctx context.Context) error {
+		calls = append(calls, "stop 1")
+		return nil
+	})
+	b.OnStop(func(ctx context.Context) error {
+		calls = append(calls, "stop 2")
+		return nil
+	})
+
+	err := b.Run(ctx)
+	assert.NoError(t, err, "Run should not return an error")
+	assert.Equal(t, []string{"start", "stop 2", "stop 1"}, calls, "Stop hooks should run in reverse order")
+}
+
+// TestRunStartHookError tests that the Builder stops if a start hook fails.
+func TestRunStartHookError(t *testing.T) {
+	b := newLifecycleBuilder(t)
+
+	hookErr := errors.New("start failed")
+	stopped := false
+	b.OnStart(func(ctx context.Context) error {
+		return hookErr
+	})
+	b.OnStop(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	err := b.Run(context.Background())
+	assert.ErrorIs(t, err, hookErr, "Run should return the error of the hook")
+	assert.True(t, stopped, "Stop hooks should run")
+}
@@ -0,0 +1,612 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Translation stores the value of a translatable field for a given locale.
+// The value stored in the model itself belongs to the default locale.
+type Translation struct {
+	*SystemData
+	ResourceName string `gorm:"index:idx_translation" json:"resourceName"`
+	ResourceId   string `gorm:"index:idx_translation" json:"resourceId"`
+	Field        string `gorm:"index:idx_translation" json:"field"`
+	Locale       string `gorm:"index:idx_translation" json:"locale"`
+	Value        string `json:"value"`
+}
+
+// MissingTranslation lists the translatable fields of a record that have no value for a locale.
+type MissingTranslation struct {
+	ResourceId string   `json:"resourceId"`
+	Locale     string   `json:"locale"`
+	Fields     []string `json:"fields"`
+}
+
+// NormalizeLocale lowercases the locale and uses dashes as separator, e.g. "pt_BR" becomes "pt-br".
+func NormalizeLocale(locale string) string {
+	locale = strings.TrimSpace(locale)
+	locale = strings.ReplaceAll(locale, "_", "-")
+	return strings.ToLower(locale)
+}
+
+// GetDefaultLocale returns the locale of the values stored in the models.
+func GetDefaultLocale() string {
+	locale := NormalizeLocale(config.GetString(EnvKeys.DefaultLocale))
+	if locale == "" {
+		locale = DefaultEnvValues.DefaultLocale
+	}
+	return locale
+}
+
+// GetSupportedLocales returns the locales editors are expected to translate, excluding the default locale.
+func GetSupportedLocales() []string {
+	value := config.GetString(EnvKeys.SupportedLocales)
+	if value == "" {
+		value = DefaultEnvValues.SupportedLocales
+	}
+
+	output := []string{}
+	for _, locale := range splitLocales(value) {
+		if locale != GetDefaultLocale() {
+			output = append(output, locale)
+		}
+	}
+	return output
+}
+
+// splitLocales splits a comma-separated list of locales and normalizes them.
+func splitLocales(value string) []string {
+	output := []string{}
+	for _, locale := range strings.Split(value, ",") {
+		locale = NormalizeLocale(locale)
+		if locale != "" {
+			output = append(output, locale)
+		}
+	}
+	return output
+}
+
+// parseAcceptLanguage returns the locales of an Accept-Language header ordered by quality.
+//
+// For example, "es-AR,es;q=0.9,en;q=0.8" returns ["es-ar", "es", "en"].
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale  string
+		quality float64
+	}
+
+	items := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		quality := 1.0
+		locale := part
+		if idx := strings.Index(part, ";"); idx >= 0 {
+			locale = part[:idx]
+			param := strings.TrimSpace(part[idx+1:])
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+
+		locale = NormalizeLocale(locale)
+		if locale == "" || locale == "*" || quality <= 0 {
+			continue
+		}
+		items = append(items, weighted{locale: locale, quality: quality})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].quality > items[j].quality
+	})
+
+	output := make([]string, 0, len(items))
+	for _, item := range items {
+		output = append(output, item.locale)
+	}
+	return output
+}
+
+// ResolveLocales returns the chain of locales to try for the given request.
+//
+// The chain is built in the following order, without duplicates:
+//   - the ?locale= query parameter, or the Accept-Language header if it is not provided.
+//   - the base language of each requested locale, e.g. "pt" for "pt-br".
+//   - the locales configured in LOCALE_FALLBACKS.
+//   - the default locale.
+func ResolveLocales(r *http.Request) []string {
+	requested := []string{}
+
+	if locale := NormalizeLocale(GetQueryParam("locale", r)); locale != "" {
+		requested = append(requested, locale)
+	} else if r.Header != nil {
+		requested = parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	chain := []string{}
+	seen := map[string]bool{}
+	add := func(locale string) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			chain = append(chain, locale)
+		}
+	}
+
+	for _, locale := range requested {
+		add(locale)
+		if idx := strings.Index(locale, "-"); idx > 0 {
+			add(locale[:idx])
+		}
+	}
+
+	for _, locale := range splitLocales(config.GetString(EnvKeys.LocaleFallbacks)) {
+		add(locale)
+	}
+
+	add(GetDefaultLocale())
+
+	return chain
+}
+
+// jsonifyRecords converts a model instance, or a slice of them, to a list of JSON maps.
+// Numbers are decoded as json.Number so IDs keep their original representation.
+//
+// Returns:
+//   - []map[string]interface{}: the records.
+//   - bool: true if the input was a single record.
+//   - error: an error if the input cannot be converted.
+func jsonifyRecords(records interface{}) ([]map[string]interface{}, bool, error) {
+	jsonData, err := json.Marshal(records)
+	if err != nil {
+		return nil, false, err
+	}
+
+	decode := func(v interface{}) error {
+		decoder := json.NewDecoder(bytes.NewReader(jsonData))
+		decoder.UseNumber()
+		return decoder.Decode(v)
+	}
+
+	var items []map[string]interface{}
+	if err := decode(&items); err == nil {
+		return items, false, nil
+	}
+
+	var item map[string]interface{}
+	if err := decode(&item); err != nil {
+		return nil, false, err
+	}
+
+	return []map[string]interface{}{item}, true, nil
+}
+
+// RegisterTranslatableField marks a field of the model as translatable. Values of translatable
+// fields can be stored per locale and are resolved on read based on the requested locale.
+//
+// Parameters:
+// - fieldName: the name of the field to be marked as translatable.
+//
+// Returns:
+// - error: an error if the field is not found in the model.
+func (a *App) RegisterTranslatableField(fieldName FieldName) error {
+	fieldNameLower := strings.ToLower(string(fieldName))
+
+	if !a.FieldExists(fieldNameLower) {
+		return fmt.Errorf("field %s not found in model", fieldName)
+	}
+
+	if a.TranslatableFields == nil {
+		a.TranslatableFields = make(map[string]bool)
+	}
+	a.TranslatableFields[fieldNameLower] = true
+
+	return nil
+}
+
+// IsTranslatable returns true if the App has at least one translatable field.
+func (a *App) IsTranslatable() bool {
+	return len(a.TranslatableFields) > 0
+}
+
+// IsTranslatableField returns true if the given field has been registered as translatable.
+func (a *App) IsTranslatableField(fieldName string) bool {
+	return a.TranslatableFields[strings.ToLower(fieldName)]
+}
+
+// GetTranslations returns the translations stored for the given records of the App.
+//
+// Parameters:
+//   - db: the database to query.
+//   - resourceIds: the IDs of the records.
+//   - locales: the locales to retrieve, all locales are returned if empty.
+func (a *App) GetTranslations(db *Database, resourceIds []string, locales []string) ([]Translation, error) {
+	translations := []Translation{}
+
+	q := db.DB.Where("resource_name = ? AND resource_id IN ?", a.Name(), resourceIds)
+	if len(locales) > 0 {
+		q = q.Where("locale IN ?", locales)
+	}
+
+	err := q.Find(&translations).Error
+	return translations, err
+}
+
+// Localize replaces the values of the translatable fields of the given records with the
+// first available translation in the locale chain.
+//
+// The records are returned as JSON maps. If the App has no translatable fields, or the
+// first locale of the chain is the default locale, the records are returned unchanged.
+//
+// Parameters:
+//   - db: the database to read translations from.
+//   - records: a pointer to a model instance or to a slice of model instances.
+//   - locales: the locale chain, as returned by ResolveLocales.
+func (a *App) Localize(db *Database, records interface{}, locales []string) (interface{}, error) {
+	if !a.IsTranslatable() || len(locales) == 0 || locales[0] == GetDefaultLocale() {
+		return records, nil
+	}
+
+	items, single, err := jsonifyRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceIds := []string{}
+	for _, item := range items {
+		resourceIds = append(resourceIds, fmt.Sprint(item["ID"]))
+	}
+
+	translations, err := a.GetTranslations(db, resourceIds, locales)
+	if err != nil {
+		return nil, err
+	}
+
+	// resourceId -> field -> locale -> value
+	values := map[string]map[string]map[string]string{}
+	for _, t := range translations {
+		if t.Value == "" {
+			continue
+		}
+		if values[t.ResourceId] == nil {
+			values[t.ResourceId] = map[string]map[string]string{}
+		}
+		field := strings.ToLower(t.Field)
+		if values[t.ResourceId][field] == nil {
+			values[t.ResourceId][field] = map[string]string{}
+		}
+		values[t.ResourceId][field][t.Locale] = t.Value
+	}
+
+	defaultLocale := GetDefaultLocale()
+	for _, item := range items {
+		recordValues := values[fmt.Sprint(item["ID"])]
+
+		for key := range item {
+			if !a.IsTranslatableField(key) {
+				continue
+			}
+
+			for _, locale := range locales {
+				// the value stored in the model belongs to the default locale
+				if locale == defaultLocale {
+					break
+				}
+				if value, ok := recordValues[strings.ToLower(key)][locale]; ok {
+					item[key] = value
+					break
+				}
+			}
+		}
+	}
+
+	if single {
+		return items[0], nil
+	}
+	return items, nil
+}
+
+// GetMissingTranslations returns, for each record and locale, the translatable fields that
+// have no value.
+//
+// Parameters:
+//   - db: the database to read translations from.
+//   - resourceIds: the IDs of the records to check.
+//   - locales: the locales to check.
+func (a *App) GetMissingTranslations(db *Database, resourceIds []string, locales []string) ([]MissingTranslation, error) {
+	output := []MissingTranslation{}
+	if !a.IsTranslatable() || len(resourceIds) == 0 || len(locales) == 0 {
+		return output, nil
+	}
+
+	translations, err := a.GetTranslations(db, resourceIds, locales)
+	if err != nil {
+		return nil, err
+	}
+
+	// resourceId|locale|field
+	existing := map[string]bool{}
+	for _, t := range translations {
+		if t.Value != "" {
+			existing[t.ResourceId+"|"+t.Locale+"|"+strings.ToLower(t.Field)] = true
+		}
+	}
+
+	fields := make([]string, 0, len(a.TranslatableFields))
+	for field := range a.TranslatableFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, resourceId := range resourceIds {
+		for _, locale := range locales {
+			missing := []string{}
+			for _, field := range fields {
+				if !existing[resourceId+"|"+locale+"|"+field] {
+					missing = append(missing, field)
+				}
+			}
+
+			if len(missing) > 0 {
+				output = append(output, MissingTranslation{
+					ResourceId: resourceId,
+					Locale:     locale,
+					Fields:     missing,
+				})
+			}
+		}
+	}
+
+	return output, nil
+}
+
+/*
+	TRANSLATION HANDLERS
+*/
+
+// ApiTranslations returns a handler function that responds to GET requests on the
+// translations endpoint, e.g. /api/posts/{id}/translations.
+//
+// The handler returns every translation stored for the record.
+func (a *App) ApiTranslations(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		_, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		translations, err := a.GetTranslations(db, []string{instanceId}, nil)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, translations, a.Name()+" translations")
+	}
+}
+
+// ApiUpdateTranslation returns a handler function that responds to PUT requests on the
+// locale translations endpoint, e.g. /api/posts/{id}/translations/{locale}.
+//
+// The request body is a JSON object with the translatable fields as keys. Values for the
+// default locale must be written through the regular update endpoint.
+func (a *App) ApiUpdateTranslation(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationUpdate)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to update this resource")
+			return
+		}
+
+		locale := NormalizeLocale(GetUrlParam("locale", r))
+		if locale == "" {
+			SendJsonResponse(w, http.StatusBadRequest, nil, "Locale is required")
+			return
+		}
+
+		if locale == GetDefaultLocale() {
+			SendJsonResponse(w, http.StatusBadRequest, nil, "Use the update endpoint to write values for the default locale")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		_, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		body, err := FormatRequestBody(r, filterKeys)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		validationErrors := ValidationResult{}
+		for key := range body {
+			if !a.IsTranslatableField(key) {
+				validationErrors.Errors = append(validationErrors.Errors, ValidationError{
+					Field: key,
+					Error: fmt.Sprintf("%s is not translatable", key),
+				})
+				continue
+			}
+			if _, ok := body[key].(string); !ok {
+				validationErrors.Errors = append(validationErrors.Errors, ValidationError{
+					Field: key,
+					Error: fmt.Sprintf("%s must be a string", key),
+				})
+			}
+		}
+		if len(validationErrors.Errors) > 0 {
+			SendJsonResponse(w, http.StatusBadRequest, validationErrors, "Validation failed")
+			return
+		}
+
+		existing, err := a.GetTranslations(db, []string{instanceId}, []string{locale})
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		byField := map[string]Translation{}
+		for _, t := range existing {
+			byField[strings.ToLower(t.Field)] = t
+		}
+
+		output := []Translation{}
+		for key, value := range body {
+			field := strings.ToLower(key)
+
+			translation, ok := byField[field]
+			if ok {
+				translation.Value = value.(string)
+				translation.UpdatedByID = params.User.ID
+				res := db.Save(&translation, params.User)
+				if res.Error != nil {
+					SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+					return
+				}
+			} else {
+				translation = Translation{
+					SystemData: &SystemData{
+						CreatedByID: params.User.ID,
+						UpdatedByID: params.User.ID,
+					},
+					ResourceName: a.Name(),
+					ResourceId:   instanceId,
+					Field:        field,
+					Locale:       locale,
+					Value:        value.(string),
+				}
+				res := db.Create(&translation, params.User)
+				if res.Error != nil {
+					SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+					return
+				}
+			}
+
+			output = append(output, translation)
+		}
+
+		SendJsonResponse(w, http.StatusOK, output, a.Name()+" translations updated")
+	}
+}
+
+// DeleteTranslations deletes the translations of the records with the given IDs, once the
+// records are deleted.
+func (a *App) DeleteTranslations(db *Database, resourceIds []string) error {
+	if !a.IsTranslatable() || len(resourceIds) == 0 {
+		return nil
+	}
+
+	return db.DB.Where("resource_name = ? AND resource_id IN ?", a.Name(), resourceIds).Delete(&Translation{}).Error
+}
+
+// ApiMissingTranslations returns a handler function that responds to GET requests on the
+// missing translations endpoint, e.g. /api/posts/translations/missing?locale=es.
+//
+// If no locale is provided, every locale in SUPPORTED_LOCALES is checked. Only the records
+// the user has access to are taken into account.
+func (a *App) ApiMissingTranslations(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		locales := GetSupportedLocales()
+		if locale := NormalizeLocale(GetQueryParam("locale", r)); locale != "" {
+			locales = []string{locale}
+		}
+
+		query := ""
+		if !a.SkipUserBinding && !params.IsAdmin() {
+			query = "created_by_id = '" + params.RequestedById + "'"
+		}
+
+		instances, err := CreateSliceForUndeterminedType(a.Model)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		res := db.Find(instances, query, nil, "")
+		if res.Error != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, res.Error.Error())
+			return
+		}
+
+		records, _, err := jsonifyRecords(instances)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		resourceIds := []string{}
+		for _, record := range records {
+			resourceIds = append(resourceIds, fmt.Sprint(record["ID"]))
+		}
+
+		missing, err := a.GetMissingTranslations(db, resourceIds, locales)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, missing, a.Name()+" missing translations")
+	}
+}
+
+// SendLocalizedJsonResponse localizes the given records with the locale chain of the request,
+// renders their rich text and media fields and writes them as a JSON response. The first locale of the
+// chain is sent back in the Content-Language header when the App has translatable fields.
+func (a *App) SendLocalizedJsonResponse(w http.ResponseWriter, r *http.Request, db *Database, records interface{}, msg string, pagination *Pagination) {
+	output := records
+
+	if a.IsTranslatable() {
+		locales := ResolveLocales(r)
+
+		var err error
+		output, err = a.Localize(db, records, locales)
+		if err != nil {
+			log.Error().Err(err).Msg("Error localizing records")
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Language", locales[0])
+	}
+
+	output, err := a.RenderRecords(db, output)
+	if err != nil {
+		log.Error().Err(err).Msg("Error rendering records")
+		SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+
+	SendJsonResponseWithPagination(w, http.StatusOK, output, msg, pagination)
+}
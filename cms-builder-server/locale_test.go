@@ -0,0 +1,152 @@
+package builder_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLocales(t *testing.T) {
+	t.Setenv(builder.EnvKeys.DefaultLocale, "en")
+	t.Setenv(builder.EnvKeys.LocaleFallbacks, "es")
+
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           []string
+	}{
+		{
+			name: "nothing requested",
+			want: []string{"es", "en"},
+		},
+		{
+			name:  "query parameter",
+			query: "locale=pt_BR",
+			want:  []string{"pt-br", "pt", "es", "en"},
+		},
+		{
+			name:           "query parameter has priority over header",
+			query:          "locale=fr",
+			acceptLanguage: "de",
+			want:           []string{"fr", "es", "en"},
+		},
+		{
+			name:           "accept language ordered by quality",
+			acceptLanguage: "en;q=0.5,de-AT,fr;q=0.8",
+			want:           []string{"de-at", "de", "fr", "en", "es"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{
+				URL:    &url.URL{RawQuery: tt.query},
+				Header: http.Header{},
+			}
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			assert.Equal(t, tt.want, builder.ResolveLocales(r))
+		})
+	}
+}
+
+// TestTranslatableFieldIsLocalized tests that the detail endpoint returns the value of a
+// translatable field for the requested locale, and that missing translations are reported.
+func TestTranslatableFieldIsLocalized(t *testing.T) {
+	t.Setenv(builder.EnvKeys.DefaultLocale, "en")
+	t.Setenv(builder.EnvKeys.SupportedLocales, "en,es")
+
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	err = e.App.RegisterTranslatableField("field")
+	assert.NoError(t, err, "RegisterTranslatableField should not return an error")
+
+	err = e.App.RegisterTranslatableField("unknown")
+	assert.Error(t, err, "RegisterTranslatableField should return an error for unknown fields")
+
+	instance, user, userRollback := th.CreateMockResource(t, e.DB, e.App, nil)
+	defer userRollback()
+
+	t.Log("Checking missing translations")
+	missingRequest, _, _ := th.NewRequest(http.MethodGet, "", true, user, nil)
+
+	var missing []builder.MissingTranslation
+	response, err := th.ExecuteApiCall(t, e.App.ApiMissingTranslations(e.DB), missingRequest, &missing)
+	assert.NoError(t, err, "ApiMissingTranslations should not return an error")
+	assert.True(t, response.Success, "ApiMissingTranslations should return a success response")
+	assert.Equal(t, 1, len(missing), "There should be one record with missing translations")
+	assert.Equal(t, "es", missing[0].Locale, "Missing locale should be es")
+	assert.Equal(t, []string{"field"}, missing[0].Fields, "Missing field should be field")
+
+	t.Log("Writing the spanish translation")
+	updateRequest, _, _ := th.NewRequest(
+		http.MethodPut,
+		`{"field": "campo"}`,
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString(), "locale": "es"},
+	)
+
+	response, err = th.ExecuteApiCall(t, e.App.ApiUpdateTranslation(e.DB), updateRequest, nil)
+	assert.NoError(t, err, "ApiUpdateTranslation should not return an error")
+	assert.True(t, response.Success, "ApiUpdateTranslation should return a success response")
+
+	t.Log("Getting the detail in spanish")
+	detailRequest, _, _ := th.NewRequest(
+		http.MethodGet,
+		"",
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString()},
+	)
+	detailRequest.Header.Set("Accept-Language", "es-AR,es;q=0.9")
+
+	var result th.MockStruct
+	response, err = th.ExecuteApiCall(t, e.App.ApiDetail(e.DB), detailRequest, &result)
+	assert.NoError(t, err, "ApiDetail should not return an error")
+	assert.Equal(t, "campo", result.Field, "Field should be translated")
+
+	t.Log("Getting the detail in the default locale")
+	detailRequest.Header.Set("Accept-Language", "en")
+
+	response, err = th.ExecuteApiCall(t, e.App.ApiDetail(e.DB), detailRequest, &result)
+	assert.NoError(t, err, "ApiDetail should not return an error")
+	assert.Equal(t, instance.Field, result.Field, "Field should not be translated")
+
+	t.Log("Writing a translation that is not a string")
+	invalidRequest, _, _ := th.NewRequest(
+		http.MethodPut,
+		`{"field": {"value": "campo"}}`,
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString(), "locale": "es"},
+	)
+
+	response, _ = th.ExecuteApiCall(t, e.App.ApiUpdateTranslation(e.DB), invalidRequest, nil)
+	assert.False(t, response.Success, "ApiUpdateTranslation should reject values that are not strings")
+
+	t.Log("Deleting the record")
+	deleteRequest, _, _ := th.NewRequest(
+		http.MethodDelete,
+		"",
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString()},
+	)
+
+	response, err = th.ExecuteApiCall(t, e.App.ApiDelete(e.DB), deleteRequest, nil)
+	assert.NoError(t, err, "ApiDelete should not return an error")
+	assert.True(t, response.Success, "ApiDelete should return a success response")
+
+	translations, err := e.App.GetTranslations(e.DB, []string{instance.GetIDString()}, []string{"es"})
+	assert.NoError(t, err, "GetTranslations should not return an error")
+	assert.Empty(t, translations, "The translations should be deleted with the record")
+}
@@ -12,6 +12,7 @@ import (
 // Logger wraps a zerolog.Logger instance with additional convenience methods
 type Logger struct {
 	*zerolog.Logger
+	file *os.File // file is the log file, if the logs are written to a file
 }
 
 // LoggerConfig defines the configuration options for the logger
@@ -66,7 +67,7 @@ func NewLogger(config *LoggerConfig) (*Logger, error) {
 			Timestamp().
 			Logger()
 
-		return &Logger{&logger}, nil
+		return &Logger{Logger: &logger}, nil
 	}
 
 	// FILE MODE (if WriteToFile is true)
@@ -100,5 +101,19 @@ func NewLogger(config *LoggerConfig) (*Logger, error) {
 		Timestamp().
 		Logger()
 
-	return &Logger{&logger}, nil
+	return &Logger{Logger: &logger, file: logFile}, nil
+}
+
+// Close flushes the log file to disk and closes it, once nothing else is going to be logged.
+func (l *Logger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	err := l.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	return l.file.Close()
 }
@@ -0,0 +1,451 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"gorm.io/gorm"
+)
+
+// MediaDeletePolicy defines what happens to the records that reference an upload when it is deleted.
+type MediaDeletePolicy string
+
+const (
+	MediaDeleteBlock MediaDeletePolicy = "block" // The upload can't be deleted while it is referenced
+	MediaDeleteNull  MediaDeletePolicy = "null"  // The references are set to null
+)
+
+// MediaFieldConfig defines the constraints of a media field.
+type MediaFieldConfig struct {
+	MimeTypes   []string          `json:"mimeTypes,omitempty"`   // Supported mime types, e.g. "image/*", all types are supported if empty
+	MaxSize     int64             `json:"maxSize,omitempty"`     // Maximum size of the file in bytes, no limit if 0
+	OnDelete    MediaDeletePolicy `json:"onDelete,omitempty"`    // What happens when the upload is deleted, MediaDeleteBlock by default
+	ExpandField string            `json:"expandField,omitempty"` // Key of the expanded upload in responses, e.g. "cover" for "coverId"
+}
+
+// MediaField is a field of an App that references an upload by ID.
+type MediaField struct {
+	Field string // JSON name of the field
+	MediaFieldConfig
+}
+
+// MediaInfo is the upload referenced by a media field, as sent in responses.
+type MediaInfo struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Url         string `json:"url"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+// MediaReference is a record that references an upload.
+type MediaReference struct {
+	App        string `json:"app"`
+	Field      string `json:"field"`
+	ResourceId string `json:"resourceId"`
+	MediaId    uint   `json:"mediaId"`
+}
+
+// MediaInUseError is returned when an upload can't be deleted because it is referenced by
+// fields with the MediaDeleteBlock policy.
+type MediaInUseError struct {
+	References []MediaReference
+}
+
+func (e *MediaInUseError) Error() string {
+	return fmt.Sprintf("file is referenced by %d records", len(e.References))
+}
+
+// NewMediaInfo returns the info of the given upload. The content type is guessed from the
+// name of the file if it wasn't stored.
+func NewMediaInfo(upload *Upload) *MediaInfo {
+	info := &MediaInfo{}
+	if upload.SystemData != nil {
+		info.ID = upload.SystemData.ID
+	}
+	if upload.FileData != nil {
+		info.Name = upload.Name
+		info.Url = upload.Url
+		info.Size = upload.Size
+		info.ContentType = upload.ContentType
+	}
+	if info.ContentType == "" {
+		info.ContentType = mime.TypeByExtension(filepath.Ext(info.Name))
+	}
+	return info
+}
+
+// RegisterMediaField declares a field of the model that references an upload by ID.
+//
+// Uploads are checked against the constraints of the field when records are created or
+// updated, and they are expanded in responses with their URL, size and content type.
+//
+// Parameters:
+// - field: the name of the field, it must be a *uint.
+// - cfg: the constraints of the field, nil means any file and MediaDeleteBlock.
+//
+// Returns:
+// - error: an error if the field is not found in the model, is not a *uint or the policy is invalid.
+func (a *App) RegisterMediaField(field FieldName, cfg *MediaFieldConfig) error {
+	structField, err := GetStructFieldByJsonName(a.Model, field.S())
+	if err != nil {
+		return err
+	}
+	if structField.Type != reflect.TypeOf((*uint)(nil)) {
+		return fmt.Errorf("field %s must be a *uint", field)
+	}
+
+	if cfg == nil {
+		cfg = &MediaFieldConfig{}
+	}
+
+	mediaField := &MediaField{Field: field.S(), MediaFieldConfig: *cfg}
+
+	switch mediaField.OnDelete {
+	case "":
+		mediaField.OnDelete = MediaDeleteBlock
+	case MediaDeleteBlock, MediaDeleteNull:
+	default:
+		return fmt.Errorf("invalid delete policy %q", cfg.OnDelete)
+	}
+
+	if mediaField.ExpandField == "" {
+		mediaField.ExpandField = strings.TrimSuffix(field.S(), "Id")
+		if mediaField.ExpandField == field.S() || mediaField.ExpandField == "" {
+			mediaField.ExpandField = field.S() + "Media"
+		}
+	}
+
+	if a.Media == nil {
+		a.Media = make(map[string]*MediaField)
+	}
+	a.Media[field.S()] = mediaField
+
+	return nil
+}
+
+// HasMedia returns true if the App has at least one media field.
+func (a *App) HasMedia() bool {
+	return len(a.Media) > 0
+}
+
+// getMediaFieldNames returns the names of the media fields, sorted so errors are reported
+// in the same order every time.
+func (a *App) getMediaFieldNames() []string {
+	names := make([]string, 0, len(a.Media))
+	for name := range a.Media {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateMedia checks that the uploads referenced by the media fields of the given instance
+// exist, can be accessed by the user and match the constraints of their field.
+//
+// Returns:
+// - []ValidationError: a validation error for each field that doesn't pass the checks.
+// - error: an error if the uploads can't be queried.
+func (a *App) ValidateMedia(db *Database, instance interface{}, params *RequestParameters) ([]ValidationError, error) {
+	errors := make([]ValidationError, 0)
+
+	for _, name := range a.getMediaFieldNames() {
+		field := a.Media[name]
+
+		value, err := GetFieldValueByJsonName(instance, name)
+		if err != nil {
+			return nil, err
+		}
+		if value.IsNil() {
+			continue
+		}
+
+		var upload Upload
+		q := db.DB.Where("id = ?", value.Elem().Uint())
+		if !params.IsAdmin() {
+			q = q.Where("created_by_id = ?", params.RequestedById)
+		}
+
+		res := q.Limit(1).Find(&upload)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			errors = append(errors, ValidationError{Field: name, Error: "file not found"})
+			continue
+		}
+
+		info := NewMediaInfo(&upload)
+
+		if len(field.MimeTypes) > 0 {
+			valid := false
+			if strings.Contains(info.ContentType, "/") {
+				valid, _ = ValidateContentType(info.ContentType, field.MimeTypes)
+			}
+			if !valid {
+				errors = append(errors, ValidationError{
+					Field: name,
+					Error: fmt.Sprintf("file type %s is not supported, expected %s", info.ContentType, strings.Join(field.MimeTypes, ", ")),
+				})
+			}
+		}
+
+		if field.MaxSize > 0 && info.Size > field.MaxSize {
+			errors = append(errors, ValidationError{
+				Field: name,
+				Error: fmt.Sprintf("file is larger than %d bytes", field.MaxSize),
+			})
+		}
+	}
+
+	return errors, nil
+}
+
+// ExpandMedia adds the uploads referenced by the media fields of the given records.
+//
+// Parameters:
+//   - db: the database to look the uploads up.
+//   - records: a record or a slice of records of the App.
+//
+// Returns:
+//   - interface{}: the records as maps, or the given records if the App has no media fields.
+//   - error: an error if the records can't be converted or the uploads can't be queried.
+func (a *App) ExpandMedia(db *Database, records interface{}) (interface{}, error) {
+	if !a.HasMedia() {
+		return records, nil
+	}
+
+	items, single, err := jsonifyRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	for _, item := range items {
+		for name := range a.Media {
+			if id, ok := item[name].(json.Number); ok {
+				ids = append(ids, id.String())
+			}
+		}
+	}
+
+	uploads := make(map[string]*MediaInfo)
+	if len(ids) > 0 {
+		var found []Upload
+		err = db.DB.Where("id IN ?", ids).Find(&found).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			info := NewMediaInfo(&found[i])
+			uploads[fmt.Sprint(info.ID)] = info
+		}
+	}
+
+	for _, item := range items {
+		for name, field := range a.Media {
+			id, ok := item[name].(json.Number)
+			if !ok {
+				item[field.ExpandField] = nil
+				continue
+			}
+			if info, ok := uploads[id.String()]; ok {
+				item[field.ExpandField] = info
+			} else {
+				item[field.ExpandField] = nil
+			}
+		}
+	}
+
+	if single {
+		return items[0], nil
+	}
+	return items, nil
+}
+
+// RenderRecords prepares the given records to be sent in a response, rendering their rich
+// text fields and expanding their media fields.
+func (a *App) RenderRecords(db *Database, records interface{}) (interface{}, error) {
+	output, err := a.RenderRichText(db, records)
+	if err != nil {
+		return nil, err
+	}
+	return a.ExpandMedia(db, output)
+}
+
+// FindMediaReferences returns the records of every App that reference the uploads with the given IDs.
+func (a *Admin) FindMediaReferences(db *Database, ids []uint) ([]MediaReference, error) {
+	references := make([]MediaReference, 0)
+	if len(ids) == 0 {
+		return references, nil
+	}
+
+	for _, app := range a.GetApps() {
+		for _, name := range app.getMediaFieldNames() {
+			column, err := db.GetColumnName(app.Model, name)
+			if err != nil {
+				return nil, err
+			}
+
+			var rows []struct {
+				ID      uint
+				MediaId uint
+			}
+			err = db.DB.Model(app.Model).
+				Select("id", column+" AS media_id").
+				Where(column+" IN ?", ids).
+				Scan(&rows).Error
+			if err != nil {
+				return nil, err
+			}
+
+			for _, row := range rows {
+				references = append(references, MediaReference{
+					App:        app.Name(),
+					Field:      name,
+					ResourceId: fmt.Sprint(row.ID),
+					MediaId:    row.MediaId,
+				})
+			}
+		}
+	}
+
+	return references, nil
+}
+
+// ReleaseMedia applies the delete policy of the media fields that reference the uploads with
+// the given IDs. References of MediaDeleteNull fields are set to null, unless a field with
+// the MediaDeleteBlock policy references them, in which case a *MediaInUseError is returned
+// and nothing is changed.
+func (a *Admin) ReleaseMedia(db *Database, ids []uint) error {
+	references, err := a.FindMediaReferences(db, ids)
+	if err != nil {
+		return err
+	}
+
+	blocking := make([]MediaReference, 0)
+	nulling := make([]MediaReference, 0)
+	for _, reference := range references {
+		app, err := a.GetApp(reference.App)
+		if err != nil {
+			return err
+		}
+		if app.Media[reference.Field].OnDelete == MediaDeleteNull {
+			nulling = append(nulling, reference)
+		} else {
+			blocking = append(blocking, reference)
+		}
+	}
+
+	if len(blocking) > 0 {
+		return &MediaInUseError{References: blocking}
+	}
+
+	for _, reference := range nulling {
+		app, err := a.GetApp(reference.App)
+		if err != nil {
+			return err
+		}
+
+		column, err := db.GetColumnName(app.Model, reference.Field)
+		if err != nil {
+			return err
+		}
+
+		err = db.DB.Model(app.Model).
+			Where("id = ?", reference.ResourceId).
+			UpdateColumn(column, nil).Error
+		if err != nil {
+			return err
+		}
+
+		log.Info().
+			Str("app", reference.App).
+			Str("field", reference.Field).
+			Str("resourceId", reference.ResourceId).
+			Uint("mediaId", reference.MediaId).
+			Msg("Media reference removed")
+	}
+
+	return nil
+}
+
+// registerMediaDeleteCallback applies the delete policy of the media fields every time
+// uploads are deleted, whichever route deletes them.
+func (a *Admin) registerMediaDeleteCallback(db *Database) error {
+	return db.DB.Callback().Delete().Before("gorm:delete").Register("builder:release_media", func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || tx.Statement.Schema.Name != "Upload" {
+			return
+		}
+
+		primaryField := tx.Statement.Schema.PrioritizedPrimaryField
+		if primaryField == nil {
+			return
+		}
+
+		ids := make([]uint, 0)
+		addId := func(rv reflect.Value) {
+			value, isZero := primaryField.ValueOf(tx.Statement.Context, rv)
+			if id, ok := value.(uint); ok && !isZero {
+				ids = append(ids, id)
+			}
+		}
+
+		rv := reflect.Indirect(tx.Statement.ReflectValue)
+		switch rv.Kind() {
+		case reflect.Struct:
+			addId(rv)
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				addId(reflect.Indirect(rv.Index(i)))
+			}
+		}
+
+		// deletes run in a transaction, so nulled references are rolled back if the delete fails
+		err := a.ReleaseMedia(&Database{DB: tx.Session(&gorm.Session{NewDB: true})}, ids)
+		if err != nil {
+			tx.AddError(err)
+		}
+	})
+}
+
+// annotateMediaSchema describes the constraints of the media fields in the given schema, and
+// adds the expanded uploads as read only properties.
+func (a *App) annotateMediaSchema(schema *jsonschema.Schema) {
+	if !a.HasMedia() {
+		return
+	}
+
+	definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	if !ok || definition.Properties == nil {
+		return
+	}
+
+	for name, field := range a.Media {
+		property, ok := definition.Properties.Get(name)
+		if !ok {
+			continue
+		}
+
+		if property.Extras == nil {
+			property.Extras = make(map[string]interface{})
+		}
+		property.Extras["x-media"] = map[string]interface{}{
+			"mimeTypes":   field.MimeTypes,
+			"maxSize":     field.MaxSize,
+			"onDelete":    field.OnDelete,
+			"expandField": field.ExpandField,
+		}
+
+		expanded := jsonschema.Reflect(&MediaInfo{})
+		mediaInfo := expanded.Definitions["MediaInfo"]
+		mediaInfo.ReadOnly = true
+		definition.Properties.Set(field.ExpandField, mediaInfo)
+	}
+}
@@ -0,0 +1,80 @@
+package builder_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockMediaStruct struct {
+	*builder.SystemData
+	CoverId *uint `json:"coverId"`
+}
+
+// TestMediaFields tests that media fields are checked against their constraints, expanded in
+// responses and that referenced uploads can't be deleted.
+func TestMediaFields(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockMediaStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.RegisterMediaField("coverId", &builder.MediaFieldConfig{
+		MimeTypes: []string{"image/*"},
+		MaxSize:   1024,
+	})
+	assert.NoError(t, err, "RegisterMediaField should not return an error")
+
+	request, user, rollback := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollback()
+
+	image := builder.Upload{
+		SystemData: &builder.SystemData{CreatedByID: user.ID},
+		FileData:   &builder.FileData{Name: "cover.png", Path: "cover.png", Url: "http://localhost/cover.png", Size: 512, ContentType: "image/png"},
+	}
+	err = e.DB.DB.Create(&image).Error
+	assert.NoError(t, err, "Creating the image should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&image)
+
+	document := builder.Upload{
+		SystemData: &builder.SystemData{CreatedByID: user.ID},
+		FileData:   &builder.FileData{Name: "doc.pdf", Path: "doc.pdf", Url: "http://localhost/doc.pdf", Size: 512, ContentType: "application/pdf"},
+	}
+	err = e.DB.DB.Create(&document).Error
+	assert.NoError(t, err, "Creating the document should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&document)
+
+	t.Log("Referencing a file of an unsupported type")
+	request, _, _ = th.NewRequest(http.MethodPost, fmt.Sprintf(`{"coverId": %d}`, document.SystemData.ID), true, user, nil)
+	response, err := th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, nil)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+	assert.False(t, response.Success, "ApiCreate should fail validation")
+
+	t.Log("Referencing an image")
+	request, _, _ = th.NewRequest(http.MethodPost, fmt.Sprintf(`{"coverId": %d}`, image.SystemData.ID), true, user, nil)
+
+	var record map[string]interface{}
+	response, err = th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &record)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+	assert.True(t, response.Success, "ApiCreate should return a success response")
+
+	cover, ok := record["cover"].(map[string]interface{})
+	assert.True(t, ok, "Cover should be expanded")
+	assert.Equal(t, image.Url, cover["url"], "Cover should have the URL of the image")
+	assert.Equal(t, "image/png", cover["contentType"], "Cover should have the content type of the image")
+
+	t.Log("Deleting the referenced image")
+	res := e.DB.DB.Delete(&image)
+	var inUse *builder.MediaInUseError
+	assert.True(t, errors.As(res.Error, &inUse), "Deleting a referenced image should be blocked")
+	assert.Equal(t, 1, len(inUse.References), "The image should have one reference")
+}
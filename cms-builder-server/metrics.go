@@ -0,0 +1,421 @@
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MetricsRoute is the path of the metrics, in the Prometheus text format.
+const MetricsRoute = "/metrics"
+
+// DefaultMetricBuckets are the upper bounds, in seconds, of the buckets of the latency histograms.
+var DefaultMetricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects the metrics of the server and serves them in the Prometheus text format.
+// A nil Metrics records nothing, so the metrics can be recorded whether they are enabled or not.
+//
+// Other metrics can be added next to the ones of the builder:
+//
+//	orders := engine.Metrics.NewCounter("shop_orders_total", "Orders placed.", "country")
+//	orders.Inc("ar")
+type Metrics struct {
+	mu       sync.Mutex
+	families []*metricFamily
+
+	httpRequests           *MetricCounter
+	httpDuration           *MetricHistogram
+	dbDuration             *MetricHistogram
+	uploads                *MetricCounter
+	uploadBytes            *MetricCounter
+	jobRuns                *MetricCounter
+	jobFailures            *MetricCounter
+	jobDuration            *MetricHistogram
+	firebaseVerifyDuration *MetricHistogram
+}
+
+// NewMetrics creates a Metrics with the metrics of the builder.
+func NewMetrics() *Metrics {
+	m := &Metrics{}
+
+	m.httpRequests = m.NewCounter("cms_http_requests_total", "HTTP requests served, by route and status.", "route", "method", "status")
+	m.httpDuration = m.NewHistogram("cms_http_request_duration_seconds", "Time to serve the HTTP requests, by route and status.", DefaultMetricBuckets, "route", "method", "status")
+	m.dbDuration = m.NewHistogram("cms_db_query_duration_seconds", "Time to run the database queries, by operation and table.", DefaultMetricBuckets, "operation", "table")
+	m.uploads = m.NewCounter("cms_uploads_total", "Files uploaded, by store type.", "store")
+	m.uploadBytes = m.NewCounter("cms_upload_bytes_total", "Bytes uploaded, by store type.", "store")
+	m.jobRuns = m.NewCounter("cms_scheduler_job_runs_total", "Runs of the scheduled jobs.", "job")
+	m.jobFailures = m.NewCounter("cms_scheduler_job_failures_total", "Runs of the scheduled jobs that failed.", "job")
+	m.jobDuration = m.NewHistogram("cms_scheduler_job_duration_seconds", "Time to run the scheduled jobs.", DefaultMetricBuckets, "job")
+	m.firebaseVerifyDuration = m.NewHistogram("cms_firebase_verify_duration_seconds", "Time to verify the Firebase tokens, by result.", DefaultMetricBuckets, "result")
+
+	return m
+}
+
+// metricFamily is a metric with all its series, one per combination of label values.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string // counter or histogram
+	labels  []string
+	buckets []float64 // buckets are the upper bounds of the buckets of a histogram
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries is the value of a metric for some label values.
+type metricSeries struct {
+	labelValues []string
+	value       float64  // value of a counter, or sum of a histogram
+	count       uint64   // count of the observations of a histogram
+	buckets     []uint64 // buckets counts the observations of a histogram in each bucket, not cumulative
+}
+
+// getSeries returns the series of the given label values, creating it if needed. It must be
+// called with the lock of the family.
+func (f *metricFamily) getSeries(labelValues []string) *metricSeries {
+	if len(labelValues) != len(f.labels) {
+		log.Error().Str("metric", f.name).Strs("labels", labelValues).Msg("Wrong number of metric labels")
+		labelValues = make([]string, len(f.labels))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: append([]string{}, labelValues...)}
+		if f.kind == "histogram" {
+			series.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = series
+	}
+	return series
+}
+
+// register adds a family to the metrics.
+func (m *Metrics) register(family *metricFamily) *metricFamily {
+	family.series = make(map[string]*metricSeries)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families = append(m.families, family)
+
+	return family
+}
+
+// MetricCounter is a metric that only goes up, e.g. the number of requests.
+type MetricCounter struct {
+	family *metricFamily
+}
+
+// NewCounter adds a counter with the given name, description and labels. It returns nil if
+// the metrics are disabled.
+func (m *Metrics) NewCounter(name string, help string, labels ...string) *MetricCounter {
+	if m == nil {
+		return nil
+	}
+	return &MetricCounter{family: m.register(&metricFamily{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// Add adds the given value to the counter of the given label values, in the order of the labels.
+func (c *MetricCounter) Add(value float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	c.family.getSeries(labelValues).value += value
+}
+
+// Inc adds one to the counter of the given label values.
+func (c *MetricCounter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// MetricHistogram is a metric that counts observations in buckets, e.g. the latency of requests.
+type MetricHistogram struct {
+	family *metricFamily
+}
+
+// NewHistogram adds a histogram with the given name, description, bucket upper bounds and
+// labels. It returns nil if the metrics are disabled.
+func (m *Metrics) NewHistogram(name string, help string, buckets []float64, labels ...string) *MetricHistogram {
+	if m == nil {
+		return nil
+	}
+
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &MetricHistogram{family: m.register(&metricFamily{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// Observe adds a value to the histogram of the given label values, in the order of the labels.
+func (h *MetricHistogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+
+	series := h.family.getSeries(labelValues)
+	series.value += value
+	series.count++
+	for i, bound := range h.family.buckets {
+		if value <= bound {
+			series.buckets[i]++
+			break
+		}
+	}
+}
+
+// ObserveDuration adds the given duration, in seconds, to the histogram of the given label values.
+func (h *MetricHistogram) ObserveDuration(duration time.Duration, labelValues ...string) {
+	h.Observe(duration.Seconds(), labelValues...)
+}
+
+// WriteTo writes the metrics in the Prometheus text format. The series are sorted by their labels.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+
+	m.mu.Lock()
+	families := append([]*metricFamily{}, m.families...)
+	m.mu.Unlock()
+
+	buffer := bufio.NewWriter(w)
+	var written int64
+	write := func(format string, args ...interface{}) {
+		n, _ := fmt.Fprintf(buffer, format, args...)
+		written += int64(n)
+	}
+
+	for _, family := range families {
+		write("# HELP %s %s\n", family.name, family.help)
+		write("# TYPE %s %s\n", family.name, family.kind)
+
+		family.mu.Lock()
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			series := family.series[key]
+			labels := formatMetricLabels(family.labels, series.labelValues)
+
+			if family.kind == "counter" {
+				write("%s%s %s\n", family.name, wrapMetricLabels(labels), formatMetricValue(series.value))
+				continue
+			}
+
+			var cumulative uint64
+			for i, bound := range family.buckets {
+				cumulative += series.buckets[i]
+				write("%s_bucket%s %d\n", family.name, wrapMetricLabels(appendMetricLabel(labels, "le", formatMetricValue(bound))), cumulative)
+			}
+			write("%s_bucket%s %d\n", family.name, wrapMetricLabels(appendMetricLabel(labels, "le", "+Inf")), series.count)
+			write("%s_sum%s %s\n", family.name, wrapMetricLabels(labels), formatMetricValue(series.value))
+			write("%s_count%s %d\n", family.name, wrapMetricLabels(labels), series.count)
+		}
+		family.mu.Unlock()
+	}
+
+	return written, buffer.Flush()
+}
+
+// Handler serves the metrics in the Prometheus text format, see MetricsRoute.
+func (m *Metrics) Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := m.WriteTo(w)
+	if err != nil {
+		GetRequestLogger(r).Error().Err(err).Msg("Error writing metrics")
+	}
+}
+
+// formatMetricLabels returns the labels with the given values, e.g. route="post-list".
+func formatMetricLabels(names []string, values []string) string {
+	labels := make([]string, 0, len(names))
+	for i, name := range names {
+		labels = append(labels, name+`="`+escapeMetricLabel(values[i])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+// appendMetricLabel appends a label to the formatted labels.
+func appendMetricLabel(labels string, name string, value string) string {
+	label := name + `="` + escapeMetricLabel(value) + `"`
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+// wrapMetricLabels wraps the formatted labels in braces, if there are any.
+func wrapMetricLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var metricLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeMetricLabel escapes the backslashes, quotes and line breaks of a label value.
+func escapeMetricLabel(value string) string {
+	return metricLabelReplacer.Replace(value)
+}
+
+// formatMetricValue formats a value as Prometheus expects it, e.g. +Inf.
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsMethods are the methods counted by name, the others are counted as OTHER so clients
+// can't create a series for every method they make up.
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// MetricsMiddleware counts the requests and their latency by route name, method and status.
+// Requests that don't match a route, e.g. a 404, are counted with an empty route name, and
+// nonstandard methods are counted as OTHER.
+func (m *Metrics) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		routeName := ""
+		if info := getRequestInfo(r); info != nil {
+			routeName = info.route
+		}
+
+		method := r.Method
+		if !metricsMethods[method] {
+			method = "OTHER"
+		}
+
+		m.observeHTTPRequest(routeName, method, status, time.Since(start))
+	})
+}
+
+// observeHTTPRequest records a request served by the given route.
+func (m *Metrics) observeHTTPRequest(route string, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequests.Inc(route, method, strconv.Itoa(status))
+	m.httpDuration.ObserveDuration(duration, route, method, strconv.Itoa(status))
+}
+
+// observeUpload records a file uploaded to the given store.
+func (m *Metrics) observeUpload(store string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.uploads.Inc(store)
+	m.uploadBytes.Add(float64(bytes), store)
+}
+
+// observeJobRun records a run of a scheduled job, which failed if err is not nil.
+func (m *Metrics) observeJobRun(job string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.jobRuns.Inc(job)
+	if err != nil {
+		m.jobFailures.Inc(job)
+	}
+	m.jobDuration.ObserveDuration(duration, job)
+}
+
+// observeFirebaseVerification records the verification of a Firebase token, which failed if err is not nil.
+func (m *Metrics) observeFirebaseVerification(duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.firebaseVerifyDuration.ObserveDuration(duration, result)
+}
+
+// metricsStartKey is the key of the time the statement started, in the instance of the statement.
+const metricsStartKey = "builder:metrics_start"
+
+// registerDBCallbacks times every statement run by GORM, by operation and table.
+func (m *Metrics) registerDBCallbacks(db *Database) error {
+	start := func(tx *gorm.DB) {
+		tx.InstanceSet(metricsStartKey, time.Now())
+	}
+	observe := func(operation string) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			if started, ok := value.(time.Time); ok {
+				m.dbDuration.ObserveDuration(time.Since(started), operation, tx.Statement.Table)
+			}
+		}
+	}
+
+	callbacks := db.DB.Callback()
+	errs := []error{
+		callbacks.Create().Before("gorm:create").Register(metricsStartKey, start),
+		callbacks.Create().After("gorm:create").Register("builder:metrics_create", observe("create")),
+		callbacks.Query().Before("gorm:query").Register(metricsStartKey, start),
+		callbacks.Query().After("gorm:query").Register("builder:metrics_query", observe("query")),
+		callbacks.Update().Before("gorm:update").Register(metricsStartKey, start),
+		callbacks.Update().After("gorm:update").Register("builder:metrics_update", observe("update")),
+		callbacks.Delete().Before("gorm:delete").Register(metricsStartKey, start),
+		callbacks.Delete().After("gorm:delete").Register("builder:metrics_delete", observe("delete")),
+		callbacks.Row().Before("gorm:row").Register(metricsStartKey, start),
+		callbacks.Row().After("gorm:row").Register("builder:metrics_row", observe("row")),
+		callbacks.Raw().Before("gorm:raw").Register(metricsStartKey, start),
+		callbacks.Raw().After("gorm:raw").Register("builder:metrics_raw", observe("raw")),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package builder_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMetricsWriteTo tests that counters and histograms are written in the Prometheus text format.
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := &builder.Metrics{}
+
+	orders := metrics.NewCounter("shop_orders_total", "Orders placed.", "country")
+	orders.Inc("ar")
+	orders.Add(2, "ar")
+	orders.Inc(`"uy"`)
+
+	latency := metrics.NewHistogram("shop_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	output := &strings.Builder{}
+	_, err := metrics.WriteTo(output)
+	assert.NoError(t, err)
+
+	expected := `# HELP shop_orders_total Orders placed.
+# TYPE shop_orders_total counter
+shop_orders_total{country="\"uy\""} 1
+shop_orders_total{country="ar"} 3
+# HELP shop_latency_seconds Latency.
+# TYPE shop_latency_seconds histogram
+shop_latency_seconds_bucket{le="0.1"} 1
+shop_latency_seconds_bucket{le="1"} 2
+shop_latency_seconds_bucket{le="+Inf"} 3
+shop_latency_seconds_sum 5.55
+shop_latency_seconds_count 3
+`
+	assert.Equal(t, expected, output.String())
+}
+
+// TestMetricsDisabled tests that a nil Metrics records nothing, without failing.
+func TestMetricsDisabled(t *testing.T) {
+	var metrics *builder.Metrics
+
+	counter := metrics.NewCounter("shop_orders_total", "Orders placed.")
+	assert.Nil(t, counter)
+	counter.Inc()
+
+	_, err := metrics.WriteTo(&strings.Builder{})
+	assert.NoError(t, err)
+}
+
+// TestMetricsMiddleware tests that the requests are counted by route name, method and status,
+// including the ones that don't match a route.
+func TestMetricsMiddleware(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+
+	server.Metrics = builder.NewMetrics()
+	server.AddRoute(builder.MetricsRoute, server.Metrics.Handler, "metrics", false, http.MethodGet, nil)
+	server.AddRoute("/missing", func(w http.ResponseWriter, r *http.Request) {
+		builder.SendJsonResponse(w, http.StatusNotFound, nil, "not found")
+	}, "missing", false, http.MethodGet, nil)
+	server.Reload()
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder
+	}
+
+	serve(http.MethodGet, "/")
+	serve(http.MethodGet, "/")
+	serve(http.MethodGet, "/missing")
+	serve(http.MethodGet, "/unknown")
+	serve("MADEUP", "/unknown")
+
+	recorder := serve(http.MethodGet, builder.MetricsRoute)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `cms_http_requests_total{route="healthz",method="GET",status="200"} 2`)
+	assert.Contains(t, body, `cms_http_requests_total{route="missing",method="GET",status="404"} 1`)
+	assert.Contains(t, body, `cms_http_requests_total{route="",method="GET",status="404"} 1`, "Requests that don't match a route should be counted")
+	assert.Contains(t, body, `cms_http_requests_total{route="",method="OTHER",status="404"} 1`, "Nonstandard methods should be counted as OTHER")
+	assert.NotContains(t, body, "MADEUP")
+	assert.Contains(t, body, `cms_http_request_duration_seconds_count{route="healthz",method="GET",status="200"} 2`)
+	assert.Contains(t, body, "# TYPE cms_db_query_duration_seconds histogram")
+}
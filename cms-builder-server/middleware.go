@@ -0,0 +1,165 @@
+package builder
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Middleware wraps a handler to run before or after it, e.g. to check the request or log the response.
+type Middleware = func(http.Handler) http.Handler
+
+// RouteGroup adds routes under a common prefix, behind a common chain of middlewares.
+//
+// Example:
+//
+//	files := svr.Group("/files", builder.MaxBodySize(10<<20))
+//	files.AddRoute("/upload", handler, "file-upload", true, http.MethodPost, nil)
+//	files.AddRoute("/purge", handler, "file-purge", true, http.MethodPost, nil, engine.RequireRoles(builder.AdminRole))
+type RouteGroup struct {
+	server      *Server
+	prefix      string
+	middlewares []Middleware
+}
+
+// Group creates a group of routes under the given prefix, behind the given middlewares.
+func (s *Server) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		server:      s,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		middlewares: middlewares,
+	}
+}
+
+// Group creates a group of routes under the prefix of the group followed by the given one,
+// behind the middlewares of the group followed by the given ones.
+func (g *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	chain := make([]Middleware, 0, len(g.middlewares)+len(middlewares))
+	chain = append(chain, g.middlewares...)
+	chain = append(chain, middlewares...)
+
+	return g.server.Group(g.prefix+prefix, chain...)
+}
+
+// Use adds middlewares to the group. Only the routes added afterwards go through them.
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// AddRoute adds a route under the prefix of the group, behind the middlewares of the group
+// followed by the given ones. See Server.AddRoute.
+func (g *RouteGroup) AddRoute(route string, handler HandlerFunc, name string, requiresAuth bool, method string, schema interface{}, middlewares ...Middleware) {
+	chain := make([]Middleware, 0, len(g.middlewares)+len(middlewares))
+	chain = append(chain, g.middlewares...)
+	chain = append(chain, middlewares...)
+
+	g.server.AddRoute(g.prefix+route, handler, name, requiresAuth, method, schema, chain...)
+}
+
+// chainMiddlewares wraps the handler with the given middlewares, the first one runs first.
+func chainMiddlewares(handler http.Handler, middlewares []Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+var closureSuffixRegex = regexp.MustCompile(`(\.func\d+)+$`)
+
+// GetMiddlewareName returns the name of the given middleware, e.g. "AuthMiddleware" for
+// Builder.AuthMiddleware. Middlewares built by other functions are named after the
+// function that built them, e.g. "MaxBodySize".
+func GetMiddlewareName(middleware Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(middleware).Pointer())
+	if fn == nil {
+		return "custom"
+	}
+
+	// e.g. github.com/user/app/builder.(*Builder).RequireRoles.func1
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = name[strings.Index(name, ".")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	name = closureSuffixRegex.ReplaceAllString(name, "")
+
+	// methods are named after the method only
+	if strings.HasPrefix(name, "(") {
+		name = name[strings.Index(name, ").")+2:]
+	}
+
+	if name == "" {
+		return "custom"
+	}
+	return name
+}
+
+// GetMiddlewareChain returns the names of the middlewares a request to the route goes
+// through after the middlewares of every route, in the order they run.
+func (s *Server) GetMiddlewareChain(route RouteHandler) []string {
+	output := make([]string, 0)
+	if route.RequiresAuth {
+		for _, middleware := range s.PreAuth {
+			output = append(output, GetMiddlewareName(middleware))
+		}
+		if s.Builder != nil {
+			output = append(output, "AuthMiddleware")
+		}
+		for _, middleware := range s.Private {
+			output = append(output, GetMiddlewareName(middleware))
+		}
+	}
+	for _, middleware := range route.Middlewares {
+		output = append(output, GetMiddlewareName(middleware))
+	}
+	return output
+}
+
+// getGlobalMiddlewareChain returns the names of the middlewares every request goes through,
+// in the order they run.
+func (s *Server) getGlobalMiddlewareChain() []string {
+	output := make([]string, 0)
+
+	// the middlewares added last wrap the others, see Run
+	for i := len(s.Middlewares) - 1; i >= 0; i-- {
+		output = append(output, GetMiddlewareName(s.Middlewares[i]))
+	}
+	for _, middleware := range s.getRouterMiddlewares() {
+		output = append(output, GetMiddlewareName(middleware))
+	}
+
+	return output
+}
+
+// MaxBodySize returns a middleware that limits the size of the body of the requests to the
+// given number of bytes. Handlers get an error reading a larger body, and respond with a 400.
+func MaxBodySize(bytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, bytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles returns a middleware that only lets through the users with at least one of
+// the given roles, and responds with a 403 otherwise. It's meant for routes that require
+// authentication, so the user has been verified already.
+func (b *Builder) RequireRoles(roles ...Role) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params := FormatRequestParameters(r, b)
+			for _, userRole := range params.Roles {
+				for _, role := range roles {
+					if userRole == role {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to access this resource")
+		})
+	}
+}
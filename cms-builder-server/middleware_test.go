@@ -0,0 +1,123 @@
+package builder_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordMiddleware returns a middleware that appends its name to the calls.
+func recordMiddleware(calls *[]string, name string) builder.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TestRouteGroup tests that the routes of a group go through the middlewares of the group,
+// of its parents and of the route, in order.
+func TestRouteGroup(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+
+	calls := make([]string, 0)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	}
+
+	api := server.Group("/v2", recordMiddleware(&calls, "api"))
+	reports := api.Group("/reports", recordMiddleware(&calls, "reports"))
+	reports.AddRoute("/{id}", handler, "report-get", false, http.MethodGet, nil, recordMiddleware(&calls, "route"))
+	api.AddRoute("/status", handler, "status", false, http.MethodGet, nil)
+	server.Reload()
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/v2/reports/1"), "Routes should be served under the prefix of the group")
+	assert.Equal(t, []string{"api", "reports", "route", "handler"}, calls, "Middlewares should run in the order they are declared")
+
+	calls = calls[:0]
+	assert.Equal(t, http.StatusOK, serve("/v2/status"))
+	assert.Equal(t, []string{"api", "handler"}, calls, "Routes should only go through the middlewares of their group")
+
+	for _, route := range server.GetRoutes() {
+		if route.Name == "report-get" {
+			assert.Equal(t, "/v2/reports/{id}", route.Route)
+			assert.Equal(t, []string{"recordMiddleware", "recordMiddleware", "recordMiddleware"}, server.GetMiddlewareChain(route))
+		}
+	}
+}
+
+// TestPrivateMiddlewares tests that the routes that require authentication go through the
+// middlewares added before and after the authentication, in order, and the public ones don't.
+func TestPrivateMiddlewares(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+
+	calls := make([]string, 0)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	}
+
+	server.AddPrivateMiddleware(recordMiddleware(&calls, "private"))
+	server.AddPreAuthMiddleware(recordMiddleware(&calls, "preAuth"))
+	server.AddRoute("/reports", handler, "reports", true, http.MethodGet, nil)
+	server.AddRoute("/status", handler, "status", false, http.MethodGet, nil)
+	server.Reload()
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/private/reports"))
+	assert.Equal(t, []string{"preAuth", "private", "handler"}, calls, "Pre-auth middlewares should run before the private ones")
+
+	calls = calls[:0]
+	assert.Equal(t, http.StatusOK, serve("/status"))
+	assert.Equal(t, []string{"handler"}, calls, "Public routes should not go through the private middlewares")
+}
+
+// TestGetMiddlewareName tests that middlewares are named after their function, or the function that built them.
+func TestGetMiddlewareName(t *testing.T) {
+	b := &builder.Builder{}
+
+	assert.Equal(t, "CORS", builder.GetMiddlewareName(builder.CORS))
+	assert.Equal(t, "AuthMiddleware", builder.GetMiddlewareName(b.AuthMiddleware))
+	assert.Equal(t, "MaxBodySize", builder.GetMiddlewareName(builder.MaxBodySize(10)))
+	assert.Equal(t, "RequireRoles", builder.GetMiddlewareName(b.RequireRoles(builder.AdminRole)))
+}
+
+// TestMaxBodySize tests that handlers can't read bodies larger than the limit.
+func TestMaxBodySize(t *testing.T) {
+	handler := builder.MaxBodySize(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			builder.SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	assert.Equal(t, http.StatusOK, recorder.Code, "Bodies within the limit should be read")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("123456")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "Bodies over the limit should not be read")
+}
@@ -0,0 +1,574 @@
+package builder
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/invopop/jsonschema"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+const (
+	OpenAPIFilePath = "openapi/openapi.json"
+	OpenAPIVersion  = "3.1.0"
+
+	// OpenAPIRoute serves the document and OpenAPIDocsRoute the API explorer.
+	OpenAPIRoute     = "/openapi.json"
+	OpenAPIDocsRoute = "/docs"
+
+	openAPISecurityScheme = "bearerAuth"
+	openAPISchemaPrefix   = "#/components/schemas/"
+)
+
+// OpenAPIQueryParams are the query parameters documented for the routes, by route name. Routes
+// of the Apps are matched by the name without the App prefix, e.g. "list" for "posts-list".
+//
+// Custom routes reading query parameters can be added before the document is generated.
+var OpenAPIQueryParams = map[string][]OpenAPIParameter{
+	"list": {
+		{Name: "page", In: "query", Description: "Page number, starting at 1", Schema: &jsonschema.Schema{Type: "integer", Default: 1}},
+		{Name: "limit", In: "query", Description: "Number of records per page", Schema: &jsonschema.Schema{Type: "integer", Default: 10}},
+		{Name: "order", In: "query", Description: "Comma-separated fields to sort by, prefixed with - for descending order", Schema: &jsonschema.Schema{Type: "string"}},
+		{Name: SearchParam, In: "query", Description: "Text the search fields of the App must contain", Schema: &jsonschema.Schema{Type: "string"}},
+		{Name: "locale", In: "query", Description: "Locale of the translatable fields", Schema: &jsonschema.Schema{Type: "string"}},
+		{Name: "tag", In: "query", Description: "Slug of a tag the records must have", Schema: &jsonschema.Schema{Type: "string"}},
+		{Name: "category", In: "query", Description: "ID or slug of a category the records must be in, including its descendants", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"get": {
+		{Name: "locale", In: "query", Description: "Locale of the translatable fields", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"get-by-slug": {
+		{Name: "locale", In: "query", Description: "Locale of the translatable fields", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"revisions": {
+		{Name: "page", In: "query", Description: "Page number, starting at 1", Schema: &jsonschema.Schema{Type: "integer", Default: 1}},
+		{Name: "limit", In: "query", Description: "Number of snapshots per page", Schema: &jsonschema.Schema{Type: "integer", Default: 10}},
+	},
+	"revisions-diff": {
+		{Name: "from", In: "query", Required: true, Description: "ID of the older snapshot", Schema: &jsonschema.Schema{Type: "integer"}},
+		{Name: "to", In: "query", Required: true, Description: "ID of the newer snapshot", Schema: &jsonschema.Schema{Type: "integer"}},
+	},
+	"file-delete": {
+		{Name: "file", In: "query", Required: true, Description: "Path of the file", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"file-download": {
+		{Name: "file", In: "query", Required: true, Description: "Path of the file", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"file-info": {
+		{Name: "file", In: "query", Required: true, Description: "Path of the file", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+	"taxonomy-tags-usage": {
+		{Name: "app", In: "query", Description: "Name of the App to count the records of", Schema: &jsonschema.Schema{Type: "string"}},
+	},
+}
+
+// openAPIPathParamPattern matches the variables of the routes, e.g. {id} or {id:[0-9]+}
+var openAPIPathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// OpenAPI is an OpenAPI 3.1 document.
+type OpenAPI struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+	Tags       []OpenAPITag               `json:"tags,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIServer struct {
+	Url string `json:"url"`
+}
+
+type OpenAPITag struct {
+	Name string `json:"name"`
+}
+
+// OpenAPIPathItem holds the operations of a path by lowercased HTTP method.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type OpenAPIParameter struct {
+	Name        string             `json:"name"`
+	In          string             `json:"in"` // path or query
+	Description string             `json:"description,omitempty"`
+	Required    bool               `json:"required,omitempty"`
+	Schema      *jsonschema.Schema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Description string                      `json:"description,omitempty"`
+	Required    bool                        `json:"required"`
+	Content     map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *jsonschema.Schema `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*jsonschema.Schema    `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// openAPIRef returns a schema that references the component with the given name.
+func openAPIRef(name string) *jsonschema.Schema {
+	return &jsonschema.Schema{Ref: openAPISchemaPrefix + name}
+}
+
+// addSchema adds the definitions of the given schema to the components of the document, and
+// returns the schema without them. References are pointed to the components when encoding.
+func (o *OpenAPI) addSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	for name, definition := range schema.Definitions {
+		o.Components.Schemas[name] = definition
+	}
+
+	output := *schema
+	output.Version = ""
+	output.ID = ""
+	output.Definitions = nil
+	return &output
+}
+
+// reflectSchema returns the schema of the given value, e.g. the input of a route, with its
+// definitions added to the components of the document.
+func (o *OpenAPI) reflectSchema(value interface{}) *jsonschema.Schema {
+	return o.addSchema(jsonschema.Reflect(value))
+}
+
+// rewriteRefs points the references of the JSON Schemas to the components of the document,
+// as jsonschema.Reflect references "#/$defs/".
+func rewriteRefs(data []byte) []byte {
+	return []byte(strings.ReplaceAll(string(data), `"#/$defs/`, `"`+openAPISchemaPrefix))
+}
+
+// MarshalJSON encodes the document with the references of the schemas pointing to the components.
+func (o OpenAPI) MarshalJSON() ([]byte, error) {
+	type document OpenAPI
+	data, err := json.Marshal(document(o))
+	if err != nil {
+		return nil, err
+	}
+	return rewriteRefs(data), nil
+}
+
+// envelope returns the schema of a Response holding the given data.
+func envelope(data *jsonschema.Schema, paginated bool) *jsonschema.Schema {
+	if data == nil && !paginated {
+		return openAPIRef("Response")
+	}
+
+	properties := jsonschema.NewProperties()
+	if data != nil {
+		properties.Set("data", data)
+	}
+	if paginated {
+		properties.Set("pagination", openAPIRef("Pagination"))
+	}
+
+	return &jsonschema.Schema{
+		AllOf: []*jsonschema.Schema{
+			openAPIRef("Response"),
+			{Type: "object", Properties: properties},
+		},
+	}
+}
+
+// jsonContent returns the content of a body with the given JSON schema.
+func jsonContent(schema *jsonschema.Schema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
+
+// appResponse returns the schema of the data of the responses of the routes of the Apps,
+// by route name without the App prefix. Routes not listed respond with any data.
+func appResponse(name string, model *jsonschema.Schema) (*jsonschema.Schema, bool) {
+	switch name {
+	case "list":
+		return &jsonschema.Schema{Type: "array", Items: model}, true
+	case "children", "descendants", "ancestors":
+		return &jsonschema.Schema{Type: "array", Items: model}, false
+	case "get", "get-by-slug", "new", "update", "patch", "revert":
+		return model, false
+	case "delete":
+		return &jsonschema.Schema{Type: "null"}, false
+	}
+	return nil, false
+}
+
+// GetOpenAPI returns the OpenAPI 3.1 document of the routes of the server.
+//
+// Routes of the Apps are described with the JSON Schema of their models, and responses with
+// the Response and Pagination envelopes. Routes requiring authentication are served under
+// /private and require a bearer token.
+//
+// Parameters:
+// - serverUrl: the url the API is served from, e.g. the BaseUrl or the host of a request.
+func (b *Builder) GetOpenAPI(serverUrl string) (*OpenAPI, error) {
+	doc := &OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   GetAppName(),
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]OpenAPIPathItem),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*jsonschema.Schema),
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				openAPISecurityScheme: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+			},
+		},
+	}
+
+	if serverUrl != "" {
+		doc.Servers = []OpenAPIServer{{Url: serverUrl}}
+	}
+
+	// envelopes
+	doc.reflectSchema(&Pagination{})
+	responseProperties := jsonschema.NewProperties()
+	responseProperties.Set("success", &jsonschema.Schema{Type: "boolean"})
+	responseProperties.Set("message", &jsonschema.Schema{Type: "string"})
+	responseProperties.Set("data", &jsonschema.Schema{})
+	responseProperties.Set("pagination", &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{openAPIRef("Pagination"), {Type: "null"}},
+	})
+	doc.Components.Schemas["Response"] = &jsonschema.Schema{
+		Type:       "object",
+		Properties: responseProperties,
+		Required:   []string{"success", "data", "message"},
+	}
+
+	// the Apps a route belongs to, by base route
+	apps := make(map[string]App)
+	models := make(map[string]*jsonschema.Schema)
+	if b.Admin != nil {
+		for _, app := range b.Admin.GetApps() {
+			baseRoute := "/api/" + app.KebabPluralName()
+			apps[baseRoute] = app
+			models[baseRoute] = doc.addSchema(app.GetSchema())
+		}
+	}
+
+	tags := make(map[string]bool)
+	for _, route := range b.Server.GetRoutes() {
+		// legacy routes are kept for the existing clients, new ones use the documented routes
+		if route.Legacy {
+			continue
+		}
+
+		operation := &OpenAPIOperation{
+			OperationID: route.Name,
+			Summary:     route.Name,
+			Parameters:  make([]OpenAPIParameter, 0),
+			Responses:   make(map[string]OpenAPIResponse),
+			Security:    []map[string][]string{},
+		}
+
+		path := route.Route
+		if route.RequiresAuth {
+			path = privatePrefix + path
+			operation.Security = []map[string][]string{{openAPISecurityScheme: {}}}
+		}
+
+		// mux variables may have a pattern, which is not part of the OpenAPI path
+		path = openAPIPathParamPattern.ReplaceAllString(path, "{$1}")
+		for _, match := range openAPIPathParamPattern.FindAllStringSubmatch(route.Route, -1) {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &jsonschema.Schema{Type: "string"},
+			})
+		}
+
+		// find the App of the route, if any
+		var app *App
+		var model *jsonschema.Schema
+		name := route.Name
+		for baseRoute, candidate := range apps {
+			if route.Route == baseRoute || strings.HasPrefix(route.Route, baseRoute+"/") {
+				candidate := candidate
+				app = &candidate
+				model = models[baseRoute]
+				name = strings.TrimPrefix(route.Name, candidate.KebabPluralName()+"-")
+				break
+			}
+		}
+
+		if app != nil {
+			operation.Tags = []string{app.Name()}
+		} else {
+			segments := strings.Split(strings.Trim(route.Route, "/"), "/")
+			tag := segments[0]
+			if tag == "" {
+				tag = "default"
+			}
+			operation.Tags = []string{tag}
+		}
+		tags[operation.Tags[0]] = true
+
+		operation.Parameters = append(operation.Parameters, OpenAPIQueryParams[name]...)
+
+		// request body
+		switch route.Schema.(type) {
+		case nil:
+		case string:
+			// some routes describe their input, e.g. "form with file"
+			description := route.Schema.(string)
+			if strings.Contains(description, "file") && route.Method != http.MethodGet {
+				properties := jsonschema.NewProperties()
+				properties.Set("file", &jsonschema.Schema{Type: "string", ContentEncoding: "binary"})
+				operation.RequestBody = &OpenAPIRequestBody{
+					Description: description,
+					Required:    true,
+					Content: map[string]OpenAPIMediaType{
+						"multipart/form-data": {Schema: &jsonschema.Schema{Type: "object", Properties: properties}},
+					},
+				}
+			} else {
+				operation.Summary = description
+			}
+		default:
+			if !isStruct(route.Schema) {
+				break
+			}
+
+			input := model
+			if app == nil || (name != "new" && name != "update" && name != "patch") {
+				input = doc.reflectSchema(route.Schema)
+			}
+			operation.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content:  jsonContent(input),
+			}
+		}
+
+		// responses
+		var data *jsonschema.Schema
+		paginated := false
+		if app != nil {
+			data, paginated = appResponse(name, model)
+		}
+		operation.Responses["200"] = OpenAPIResponse{
+			Description: "Success",
+			Content:     jsonContent(envelope(data, paginated)),
+		}
+		if operation.RequestBody != nil {
+			operation.Responses["400"] = OpenAPIResponse{Description: "Invalid input", Content: jsonContent(openAPIRef("Response"))}
+		}
+		if route.RequiresAuth {
+			operation.Responses["401"] = OpenAPIResponse{Description: "Not authenticated", Content: jsonContent(openAPIRef("Response"))}
+			operation.Responses["403"] = OpenAPIResponse{Description: "Not allowed", Content: jsonContent(openAPIRef("Response"))}
+		}
+		if len(operation.Parameters) > 0 && operation.Parameters[0].In == "path" {
+			operation.Responses["404"] = OpenAPIResponse{Description: "Not found", Content: jsonContent(openAPIRef("Response"))}
+		}
+
+		method := strings.ToLower(route.Method)
+		if method == "" {
+			method = "get"
+		}
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(OpenAPIPathItem)
+			doc.Paths[path] = item
+		}
+		item[method] = operation
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, OpenAPITag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool {
+		return doc.Tags[i].Name < doc.Tags[j].Name
+	})
+
+	return doc, nil
+}
+
+// openAPICache keeps the OpenAPI document between requests, until the routes change.
+type openAPICache struct {
+	mu      sync.Mutex
+	doc     *OpenAPI
+	version uint64 // version is the version of the routes the document was built from
+}
+
+// getCachedOpenAPI returns the OpenAPI document with the given server url. The document is
+// built once, and again when a route or an App is registered or removed.
+func (b *Builder) getCachedOpenAPI(serverUrl string) (*OpenAPI, error) {
+	b.openAPI.mu.Lock()
+	defer b.openAPI.mu.Unlock()
+
+	version := b.Server.routesVersion()
+	if b.openAPI.doc == nil || b.openAPI.version != version {
+		doc, err := b.GetOpenAPI("")
+		if err != nil {
+			return nil, err
+		}
+		b.openAPI.doc = doc
+		b.openAPI.version = version
+	}
+
+	// the cached document is shared, only the servers of the copy change
+	doc := *b.openAPI.doc
+	if serverUrl != "" {
+		doc.Servers = []OpenAPIServer{{Url: serverUrl}}
+	}
+
+	return &doc, nil
+}
+
+// ExportOpenAPI writes the OpenAPI document to OpenAPIFilePath, with the BaseUrl as server.
+func (b *Builder) ExportOpenAPI() error {
+	doc, err := b.GetOpenAPI(config.GetString(EnvKeys.BaseUrl))
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(OpenAPIFilePath, doc)
+}
+
+// openAPIDocsTemplate is the page of the API explorer. The assets are embedded in the binary,
+// so the explorer works offline.
+var openAPIDocsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="{{.Assets}}/swagger-ui.css" />
+  <link rel="icon" type="image/png" href="{{.Assets}}/favicon-32x32.png" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.Assets}}/swagger-ui-bundle.js"></script>
+  <script src="{{.Assets}}/swagger-ui-standalone-preset.js"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({
+        url: "{{.Document}}",
+        dom_id: "#swagger-ui",
+        deepLinking: true,
+        persistAuthorization: true,
+        presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+        layout: "StandaloneLayout",
+      });
+    };
+  </script>
+</body>
+</html>
+`))
+
+// AddOpenAPIRoutes adds the routes that serve the OpenAPI document and the API explorer:
+//   - GET /openapi.json: Returns the OpenAPI document, with the host of the request as server.
+//   - GET /docs: Returns the API explorer page.
+//   - GET /docs/{file}: Returns the assets of the API explorer.
+func (b *Builder) AddOpenAPIRoutes() {
+	b.Server.AddRoute(
+		OpenAPIRoute,
+		func(w http.ResponseWriter, r *http.Request) {
+			doc, err := b.getCachedOpenAPI(GetRequestBaseUrl(r))
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+
+			// the document is sent as is, not in a Response, so tools can read it
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(doc)
+			if err != nil {
+				log.Error().Err(err).Msg("Error writing OpenAPI document")
+			}
+		},
+		"openapi",
+		false,
+		http.MethodGet,
+		nil,
+	)
+
+	b.Server.AddRoute(
+		OpenAPIDocsRoute,
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err := openAPIDocsTemplate.Execute(w, map[string]string{
+				"Title":    GetAppName(),
+				"Assets":   OpenAPIDocsRoute,
+				"Document": OpenAPIRoute,
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Error writing API explorer")
+			}
+		},
+		"docs",
+		false,
+		http.MethodGet,
+		nil,
+	)
+
+	assets := http.StripPrefix(OpenAPIDocsRoute+"/", http.FileServer(http.FS(swaggerFiles.FS)))
+	b.Server.AddRoute(
+		OpenAPIDocsRoute+"/{file}",
+		func(w http.ResponseWriter, r *http.Request) {
+			// the page of the explorer is served by /docs
+			if GetUrlParam("file", r) == "index.html" {
+				http.Redirect(w, r, OpenAPIDocsRoute, http.StatusMovedPermanently)
+				return
+			}
+
+			assets.ServeHTTP(w, r)
+		},
+		"docs-assets",
+		false,
+		http.MethodGet,
+		nil,
+	)
+}
+
+// isStruct returns true if the given value is a struct or a pointer to a struct.
+func isStruct(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && t.Kind() == reflect.Struct
+}
@@ -0,0 +1,82 @@
+package builder_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockOpenAPIStruct struct {
+	*builder.SystemData
+	Title string `json:"title"`
+}
+
+// TestGetOpenAPI tests that the routes of the Apps are described with their models, envelopes and auth.
+func TestGetOpenAPI(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockOpenAPIStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	doc, err := e.Engine.GetOpenAPI("http://localhost:8080")
+	assert.NoError(t, err, "GetOpenAPI should not return an error")
+	assert.Equal(t, builder.OpenAPIVersion, doc.OpenAPI)
+
+	basePath := "/private/api/" + app.KebabPluralName()
+
+	list := doc.Paths[basePath]["get"]
+	assert.NotNil(t, list, "List operation should be described")
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, list.Security, "Protected routes should require a token")
+
+	params := make([]string, 0)
+	for _, param := range list.Parameters {
+		params = append(params, param.Name)
+	}
+	assert.Contains(t, params, "page", "List should document the page query parameter")
+	assert.Contains(t, params, "limit", "List should document the limit query parameter")
+
+	update := doc.Paths[basePath+"/{id}"]["put"]
+	assert.NotNil(t, update, "Update operation should be described")
+	assert.Equal(t, "id", update.Parameters[0].Name, "Update should document the id path parameter")
+	assert.Equal(t, "path", update.Parameters[0].In)
+	assert.NotNil(t, update.RequestBody, "Update should document the request body")
+	assert.NotNil(t, doc.Paths[basePath+"/{id}"]["patch"], "Patch operation should be described")
+	assert.Nil(t, doc.Paths[basePath+"/{id}/update"], "Legacy routes should not be described")
+
+	schema := doc.Paths["/api/"+app.KebabPluralName()+"/schema"]["get"]
+	assert.NotNil(t, schema, "Schema operation should be described")
+	assert.Empty(t, schema.Security, "Public routes should not require a token")
+
+	data, err := json.Marshal(doc)
+	assert.NoError(t, err, "Marshal should not return an error")
+	assert.False(t, strings.Contains(string(data), "#/$defs/"), "References should point to the components")
+	assert.Contains(t, string(data), "#/components/schemas/"+app.Name())
+}
+
+// TestOpenAPIRoutes tests that the document and the explorer are served.
+func TestOpenAPIRoutes(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	e.Engine.AddOpenAPIRoutes()
+	defer e.Server.RemoveRoutes(builder.OpenAPIRoute)
+	defer e.Server.RemoveRoutes(builder.OpenAPIDocsRoute)
+	e.Server.Reload()
+
+	for _, path := range []string{builder.OpenAPIRoute, builder.OpenAPIDocsRoute, builder.OpenAPIDocsRoute + "/swagger-ui-bundle.js"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		e.Server.Handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, path+" should be served")
+	}
+}
@@ -375,13 +375,13 @@ func (b *Builder) GetPostmanCollection() (*PostmanCollection, error) {
 	})
 
 	// Iterate over apps to build the collection
-	for _, app := range b.Admin.apps {
+	for _, app := range b.Admin.GetApps() {
 		path := GetAppPath(&app)
 		body := GetBody(&app)
 		appId := app.Name() + "Id"
 		appIdExpr := "{{" + appId + "}}"
 
-		collection.Item = append(collection.Item, PostmanCollectionItem{
+		item := PostmanCollectionItem{
 			Name: app.Name(),
 			Item: []PostmanCollectionItemItem{
 				{
@@ -410,11 +410,11 @@ func (b *Builder) GetPostmanCollection() (*PostmanCollection, error) {
 							},
 						},
 						URL: PostmanRequestURL{
-							Raw: strings.Join(path, "/") + "/new",
+							Raw: strings.Join(path, "/"),
 							Host: []string{
 								"{{" + keyBaseUrl + "}}",
 							},
-							Path:  append(path[1:], "new"),
+							Path:  path[1:],
 							Query: make([]PostmanQuery, 0),
 						},
 					},
@@ -458,13 +458,12 @@ func (b *Builder) GetPostmanCollection() (*PostmanCollection, error) {
 							},
 						},
 						URL: PostmanRequestURL{
-							Raw: strings.Join(path, "/") + "/" + appIdExpr + "/update",
+							Raw: strings.Join(path, "/") + "/" + appIdExpr,
 							Host: []string{
 								"{{" + keyBaseUrl + "}}",
 							},
 							Path: append(path[1:], []string{
 								appIdExpr,
-								"update",
 							}...),
 						},
 					},
@@ -491,19 +490,53 @@ func (b *Builder) GetPostmanCollection() (*PostmanCollection, error) {
 						Method: "DELETE",
 						Header: []PostmanHeader{},
 						URL: PostmanRequestURL{
-							Raw: strings.Join(path, "/") + "/" + appIdExpr + "/delete",
+							Raw: strings.Join(path, "/") + "/" + appIdExpr,
 							Host: []string{
 								"{{" + keyBaseUrl + "}}",
 							},
 							Path: append(path[1:], []string{
 								appIdExpr,
-								"delete",
 							}...),
 						},
 					},
 				},
 			},
-		})
+		}
+
+		for _, action := range app.GetActions() {
+			actionPath := append([]string{}, path[1:]...)
+			if action.Scope == ActionScopeRecord {
+				actionPath = append(actionPath, appIdExpr)
+			}
+			actionPath = append(actionPath, "actions", action.Name)
+
+			item.Item = append(item.Item, PostmanCollectionItemItem{
+				Name: "Action " + action.Name,
+				Request: PostmanCollectionItemItemRequest{
+					Method: "POST",
+					Header: []PostmanHeader{},
+					Body: PostmanRequestBody{
+						Mode: "raw",
+						Raw:  GetActionBody(action),
+						Options: PostmanRequestOptions{
+							Raw: PostmanRequestOptionsRaw{
+								Language: "json",
+							},
+						},
+					},
+					URL: PostmanRequestURL{
+						Raw: strings.Join(append([]string{path[0]}, actionPath...), "/"),
+						Host: []string{
+							"{{" + keyBaseUrl + "}}",
+						},
+						Path:  actionPath,
+						Query: make([]PostmanQuery, 0),
+					},
+				},
+			})
+		}
+
+		collection.Item = append(collection.Item, item)
 	}
 
 	return &collection, nil
@@ -619,7 +652,31 @@ func GetAppPath(app *App) []string {
 
 func GetBody(app *App) string {
 
-	data, err := JsonifyInterface(app.Model)
+	model := app.Model
+	if app.IsContentType() {
+		model = app.ContentType.NewEntry().Data
+	}
+
+	data, err := JsonifyInterface(model)
+	if err != nil {
+		return ""
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "   ")
+	if err != nil {
+		return ""
+	}
+
+	return string(jsonData)
+}
+
+// GetActionBody returns an example body for the given action, built from its input schema.
+func GetActionBody(action *Action) string {
+	if action.InputSchema == nil {
+		return ""
+	}
+
+	data, err := JsonifyInterface(action.InputSchema)
 	if err != nil {
 		return ""
 	}
@@ -0,0 +1,366 @@
+package builder
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invopop/jsonschema"
+)
+
+// WidgetType is the input the admin UI renders for a field.
+type WidgetType string
+
+const (
+	WidgetText     WidgetType = "text"
+	WidgetTextarea WidgetType = "textarea"
+	WidgetNumber   WidgetType = "number"
+	WidgetCheckbox WidgetType = "checkbox"
+	WidgetDate     WidgetType = "date"
+	WidgetDateTime WidgetType = "datetime"
+	WidgetSelect   WidgetType = "select"
+	WidgetMedia    WidgetType = "media"
+	WidgetRichText WidgetType = "richtext"
+	WidgetMarkdown WidgetType = "markdown"
+	WidgetHidden   WidgetType = "hidden"
+)
+
+// SearchParam is the query parameter used to search the records of the Apps, e.g. ?search=term
+const SearchParam = "search"
+
+// listParams are the query parameters of the list, which can't be used as filters.
+var listParams = map[string]bool{
+	SearchParam: true,
+	"page":      true,
+	"limit":     true,
+	"order":     true,
+	"locale":    true,
+	"tag":       true,
+	"category":  true,
+}
+
+var widgetTypes = map[WidgetType]bool{
+	WidgetText:     true,
+	WidgetTextarea: true,
+	WidgetNumber:   true,
+	WidgetCheckbox: true,
+	WidgetDate:     true,
+	WidgetDateTime: true,
+	WidgetSelect:   true,
+	WidgetMedia:    true,
+	WidgetRichText: true,
+	WidgetMarkdown: true,
+	WidgetHidden:   true,
+}
+
+// WidgetOption is a choice of a select widget.
+type WidgetOption struct {
+	Value interface{} `json:"value"`
+	Label string      `json:"label"`
+}
+
+// Widget is the hint of the input the admin UI renders for a field.
+type Widget struct {
+	Type    WidgetType     `json:"type"`
+	Options []WidgetOption `json:"options,omitempty"` // Choices of select widgets
+}
+
+// Fieldset groups fields in the forms of the admin UI.
+type Fieldset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Fields      []string `json:"fields"`
+}
+
+// AdminConfig defines how the admin UI presents the records of an App. Fields are referred
+// to by JSON name.
+type AdminConfig struct {
+	ListDisplay  []string           // Columns of the list, e.g. "title", "createdAt"
+	SearchFields []string           // Fields matched by ?search=, which must be stored in the database
+	Ordering     []string           // Default order of the list, e.g. "-createdAt", in the format of ?order=
+	ListFilter   []string           // Fields of the filter sidebar, which can be filtered by ?field=value
+	Fieldsets    []Fieldset         // Groups of fields of the forms
+	Widgets      map[string]*Widget // Input of the fields, by JSON name
+	ReadOnly     []string           // Fields shown but not editable in the forms
+}
+
+// SetAdminConfig sets how the admin UI presents the records of the App. The configuration
+// is published in the /schema output as JSON Schema extensions.
+//
+// Parameters:
+// - cfg: the presentation of the App.
+//
+// Returns:
+// - error: an error if a field is not found in the model, or a widget is invalid.
+func (a *App) SetAdminConfig(cfg AdminConfig) error {
+	fields := make([]string, 0)
+	fields = append(fields, cfg.ListDisplay...)
+	fields = append(fields, cfg.ReadOnly...)
+	for _, fieldset := range cfg.Fieldsets {
+		if fieldset.Name == "" {
+			return fmt.Errorf("fieldsets must have a name")
+		}
+		fields = append(fields, fieldset.Fields...)
+	}
+	for _, field := range cfg.Ordering {
+		fields = append(fields, strings.TrimPrefix(field, "-"))
+	}
+	for field, widget := range cfg.Widgets {
+		if widget == nil || !widgetTypes[widget.Type] {
+			return fmt.Errorf("invalid widget for field %s", field)
+		}
+		if widget.Type == WidgetSelect && len(widget.Options) == 0 {
+			return fmt.Errorf("select widget for field %s has no options", field)
+		}
+		fields = append(fields, field)
+	}
+
+	for _, field := range fields {
+		if !a.hasPresentableField(field) {
+			return fmt.Errorf("field %s not found in %s", field, a.Name())
+		}
+	}
+
+	// search and filters are applied in the query, so the fields must be columns
+	if a.IsContentType() && (len(cfg.SearchFields) > 0 || len(cfg.ListFilter) > 0) {
+		return fmt.Errorf("search and filters are not supported for content types")
+	}
+
+	for _, field := range cfg.ListFilter {
+		if listParams[field] {
+			return fmt.Errorf("field %s can't be used as a filter", field)
+		}
+	}
+
+	db := a.getDatabase()
+	for _, field := range append(append([]string{}, cfg.SearchFields...), cfg.ListFilter...) {
+		if db == nil {
+			continue
+		}
+		if _, err := db.GetColumnName(a.Model, field); err != nil {
+			return err
+		}
+	}
+
+	if a.Presentation == nil {
+		a.Presentation = &AdminConfig{}
+	}
+	*a.Presentation = cfg
+
+	return nil
+}
+
+// getDatabase returns the database of the Builder of the App, if any.
+func (a *App) getDatabase() *Database {
+	if a.Admin == nil || a.Admin.Builder == nil {
+		return nil
+	}
+	return a.Admin.Builder.DB
+}
+
+// hasPresentableField returns true if the App has a field with the given JSON name, or the
+// field is added to the responses, e.g. an expanded media field.
+func (a *App) hasPresentableField(field string) bool {
+	if _, err := GetStructFieldByJsonName(a.Model, field); err == nil {
+		return true
+	}
+
+	if a.IsContentType() {
+		for _, contentField := range a.ContentType.Fields {
+			if contentField.Name == field {
+				return true
+			}
+		}
+	}
+
+	for _, media := range a.Media {
+		if media.ExpandField == field {
+			return true
+		}
+	}
+
+	for _, richText := range a.RichText {
+		if richText.RenderHTML && richText.RenderedField() == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetDefaultOrder returns the order of the list when no ?order= is given, or an empty string.
+func (a *App) GetDefaultOrder() string {
+	if a.Presentation == nil {
+		return ""
+	}
+	return strings.Join(a.Presentation.Ordering, ",")
+}
+
+// GetWidgets returns the widgets of the fields of the App: the configured ones, and the ones
+// inferred from the media, rich text and date fields.
+func (a *App) GetWidgets() map[string]*Widget {
+	widgets := make(map[string]*Widget)
+
+	for field := range a.Media {
+		widgets[field] = &Widget{Type: WidgetMedia}
+	}
+
+	for field, richText := range a.RichText {
+		widgetType := WidgetRichText
+		if richText.Format == RichTextMarkdown {
+			widgetType = WidgetMarkdown
+		}
+		widgets[field] = &Widget{Type: widgetType}
+	}
+
+	if a.IsContentType() {
+		for _, field := range a.ContentType.Fields {
+			switch field.Type {
+			case ContentFieldText:
+				widgets[field.Name] = &Widget{Type: WidgetTextarea}
+			case ContentFieldBoolean:
+				widgets[field.Name] = &Widget{Type: WidgetCheckbox}
+			case ContentFieldDateTime:
+				widgets[field.Name] = &Widget{Type: WidgetDateTime}
+			}
+		}
+	} else {
+		t := reflect.TypeOf(a.Model)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		timeType := reflect.TypeOf(time.Time{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous || fieldType != timeType {
+				continue
+			}
+			widgets[getJsonName(field)] = &Widget{Type: WidgetDateTime}
+		}
+	}
+
+	if a.Presentation != nil {
+		for field, widget := range a.Presentation.Widgets {
+			widgets[field] = widget
+		}
+	}
+
+	return widgets
+}
+
+// annotateAdminSchema adds the presentation of the App to the given schema as extensions:
+//   - x-list-display, x-search-fields, x-ordering, x-list-filter and x-fieldsets on the model.
+//   - x-widget on the properties, and readOnly on the read-only fields.
+func (a *App) annotateAdminSchema(schema *jsonschema.Schema) {
+	definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	if !ok || definition.Properties == nil {
+		return
+	}
+
+	if cfg := a.Presentation; cfg != nil {
+		if definition.Extras == nil {
+			definition.Extras = make(map[string]interface{})
+		}
+
+		extras := map[string]interface{}{
+			"x-list-display":  cfg.ListDisplay,
+			"x-search-fields": cfg.SearchFields,
+			"x-ordering":      cfg.Ordering,
+			"x-list-filter":   cfg.ListFilter,
+			"x-fieldsets":     cfg.Fieldsets,
+		}
+		for key, value := range extras {
+			if reflect.ValueOf(value).Len() > 0 {
+				definition.Extras[key] = value
+			}
+		}
+
+		for _, field := range cfg.ReadOnly {
+			if property, ok := definition.Properties.Get(field); ok {
+				property.ReadOnly = true
+			}
+		}
+	}
+
+	for field, widget := range a.GetWidgets() {
+		property, ok := definition.Properties.Get(field)
+		if !ok {
+			continue
+		}
+		if property.Extras == nil {
+			property.Extras = make(map[string]interface{})
+		}
+		property.Extras["x-widget"] = widget
+	}
+}
+
+// ListFilters returns the query that filters the records of the App by the ?search= parameter
+// and the ?field=value parameters of the list filters, with its arguments, or an empty
+// string if there is nothing to filter.
+func (a *App) ListFilters(db *Database, r *http.Request) (string, []interface{}, error) {
+	if a.Presentation == nil {
+		return "", nil, nil
+	}
+
+	queries := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if search := strings.TrimSpace(GetQueryParam(SearchParam, r)); search != "" && len(a.Presentation.SearchFields) > 0 {
+		pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+
+		conditions := make([]string, 0, len(a.Presentation.SearchFields))
+		for _, field := range a.Presentation.SearchFields {
+			column, err := db.GetColumnName(a.Model, field)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, "LOWER(CAST("+column+" AS TEXT)) LIKE ? ESCAPE '\\'")
+			args = append(args, pattern)
+		}
+		queries = append(queries, strings.Join(conditions, " OR "))
+	}
+
+	for _, field := range a.Presentation.ListFilter {
+		value := GetQueryParam(field, r)
+		if value == "" {
+			continue
+		}
+
+		column, err := db.GetColumnName(a.Model, field)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// booleans are stored as numbers by some drivers, so they are parsed
+		var arg interface{} = value
+		if structField, err := GetStructFieldByJsonName(a.Model, field); err == nil {
+			kind := structField.Type.Kind()
+			if kind == reflect.Ptr {
+				kind = structField.Type.Elem().Kind()
+			}
+			if kind == reflect.Bool {
+				arg, err = strconv.ParseBool(value)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid value for %s: %s", field, value)
+				}
+			}
+		}
+
+		queries = append(queries, column+" = ?")
+		args = append(args, arg)
+	}
+
+	return JoinQueries(queries...), args, nil
+}
+
+// escapeLike escapes the wildcards of the given LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,84 @@
+package builder_test
+
+import (
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockPresentationStruct struct {
+	*builder.SystemData
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Published bool   `json:"published"`
+}
+
+// TestAdminConfig tests that the presentation of an App is published in its schema, and that
+// its records can be searched and filtered.
+func TestAdminConfig(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockPresentationStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.SetAdminConfig(builder.AdminConfig{ListDisplay: []string{"missing"}})
+	assert.Error(t, err, "SetAdminConfig should fail for unknown fields")
+
+	err = app.SetAdminConfig(builder.AdminConfig{
+		ListDisplay:  []string{"title", "published"},
+		SearchFields: []string{"title", "body"},
+		ListFilter:   []string{"published"},
+		Widgets: map[string]*builder.Widget{
+			"body": {Type: builder.WidgetTextarea},
+		},
+		ReadOnly: []string{"published"},
+	})
+	assert.NoError(t, err, "SetAdminConfig should not return an error")
+
+	t.Log("Checking the schema")
+	schema := app.GetSchema()
+	definition := schema.Definitions[app.Name()]
+	assert.Equal(t, []string{"title", "published"}, definition.Extras["x-list-display"])
+
+	body, _ := definition.Properties.Get("body")
+	assert.Equal(t, &builder.Widget{Type: builder.WidgetTextarea}, body.Extras["x-widget"])
+
+	published, _ := definition.Properties.Get("published")
+	assert.True(t, published.ReadOnly, "Published should be read-only")
+
+	t.Log("Creating records")
+	_, user, rollback := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollback()
+
+	for _, record := range []string{
+		`{"title": "Hello", "body": "first", "published": true}`,
+		`{"title": "World", "body": "hello again", "published": false}`,
+		`{"title": "Other", "body": "third", "published": true}`,
+	} {
+		request, _, _ := th.NewRequest(http.MethodPost, record, true, user, nil)
+		response, err := th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, nil)
+		assert.NoError(t, err, "ApiCreate should not return an error")
+		assert.True(t, response.Success, "ApiCreate should return a success response")
+	}
+
+	list := func(query string) []MockPresentationStruct {
+		request, _, _ := th.NewRequest(http.MethodGet, "", true, user, nil)
+		request.URL.RawQuery = query
+
+		var result []MockPresentationStruct
+		_, err := th.ExecuteApiCall(t, app.ApiList(e.DB), request, &result)
+		assert.NoError(t, err, "ApiList should not return an error")
+		return result
+	}
+
+	assert.Equal(t, 2, len(list("search=HELLO")), "Search should match the title and body")
+	assert.Equal(t, 1, len(list("search=hello&published=true")), "Filters should be combined with the search")
+	assert.Equal(t, 1, len(list("published=false")), "List should be filtered")
+}
@@ -0,0 +1,381 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidRateLimit = errors.New("invalid rate limit, expected <requests>/<period>, e.g. 100/1m")
+
+// APIKeyHeader is the header clients identify themselves with when they are not authenticated.
+const APIKeyHeader = "X-API-Key"
+
+// requestAPIKeyKey is the key of the authenticated API key in the context of the requests.
+const requestAPIKeyKey requestContextKey = "apiKey"
+
+// TrustedProxies are the networks of the proxies in front of the server, the X-Forwarded-For
+// header is only honored in their requests, see GetRequestIP. InitServer sets them from
+// SERVER_TRUSTED_PROXIES.
+var TrustedProxies []*net.IPNet
+
+// RateLimit is a token bucket: clients can send Burst requests at once, and get Requests
+// requests back every Period.
+type RateLimit struct {
+	Requests int           // Requests is the number of requests allowed every Period.
+	Period   time.Duration // Period is the time it takes to refill the bucket.
+	Burst    int           // Burst is the size of the bucket. Defaults to Requests.
+}
+
+// capacity returns the size of the bucket.
+func (l RateLimit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseRateLimit parses a rate limit in the form <requests>/<period>, e.g. 100/1m is 100
+// requests per minute. It returns false if the value is "off", which disables the limit.
+func ParseRateLimit(value string) (RateLimit, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return RateLimit{}, false, nil
+	}
+
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, false, fmt.Errorf("%w: %s", ErrInvalidRateLimit, value)
+	}
+
+	limit := RateLimit{}
+	var err error
+
+	limit.Requests, err = strconv.Atoi(requests)
+	if err != nil || limit.Requests <= 0 {
+		return RateLimit{}, false, fmt.Errorf("%w: %s", ErrInvalidRateLimit, value)
+	}
+
+	limit.Period, err = time.ParseDuration(period)
+	if err != nil || limit.Period <= 0 {
+		return RateLimit{}, false, fmt.Errorf("%w: %s", ErrInvalidRateLimit, value)
+	}
+
+	return limit, true, nil
+}
+
+// RateLimitResult is the state of a bucket after taking a token from it.
+type RateLimitResult struct {
+	Allowed    bool          // Allowed is true if there was a token left for the request.
+	Limit      int           // Limit is the size of the bucket.
+	Remaining  int           // Remaining is the number of tokens left.
+	Reset      time.Duration // Reset is the time until the bucket is full again.
+	RetryAfter time.Duration // RetryAfter is the time until the next token, if the request wasn't allowed.
+}
+
+// RateLimitStore holds the buckets of the clients. The buckets are in memory by default,
+// see MemoryRateLimitStore, a shared store lets several instances of the server share them.
+type RateLimitStore interface {
+	// Take takes a token from the bucket with the given key, creating it if needed.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// DefaultRateLimitStore is the store of the rate limits that don't set one.
+var DefaultRateLimitStore RateLimitStore = NewMemoryRateLimitStore()
+
+// memoryBucket is a token bucket of the MemoryRateLimitStore.
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+// refill adds the tokens earned since the bucket was last updated.
+func (b *memoryBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limit.capacity(), b.tokens+now.Sub(b.updated).Seconds()*b.limit.rate())
+	b.updated = now
+}
+
+// MemoryRateLimitStore holds the buckets in memory, so they are not shared between the
+// instances of the server.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryBucketSweepInterval is how often the full buckets are removed from memory.
+const memoryBucketSweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Take takes a token from the bucket with the given key. See RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: limit.capacity(), updated: now}
+		s.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	bucket.refill(now)
+
+	result := RateLimitResult{Limit: int(limit.capacity())}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / limit.rate() * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((limit.capacity() - bucket.tokens) / limit.rate() * float64(time.Second))
+
+	return result, nil
+}
+
+// sweep removes the buckets that are full again, which are the same as new ones.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryBucketSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= bucket.limit.capacity() {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimitKeyFunc returns the key of the client that sent the request, requests with the
+// same key share a bucket.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitKey identifies the client by the ID of the user if the route requires
+// authentication, by the API key if it was authenticated, see APIKeyMiddleware, or by its
+// IP otherwise. Keys that weren't authenticated are ignored, so clients can't get a new
+// bucket by sending a new key.
+func RateLimitKey(r *http.Request) string {
+	if user, ok := r.Context().Value(requestUserKey).(*User); ok && user != nil {
+		return "user:" + user.GetIDString()
+	}
+
+	if apiKey, ok := r.Context().Value(requestAPIKeyKey).(string); ok && apiKey != "" {
+		return "key:" + apiKey
+	}
+
+	return RateLimitIPKey(r)
+}
+
+// RateLimitIPKey identifies the client by its IP only, e.g. to limit the requests before
+// the user is verified.
+func RateLimitIPKey(r *http.Request) string {
+	return "ip:" + GetRequestIP(r)
+}
+
+// APIKeyMiddleware returns a middleware that authenticates the API key of the requests, in
+// the X-API-Key header, with the given function. Requests with a valid key are rate limited
+// by the key instead of the IP, and the ones with an invalid key get a 401.
+//
+// Example:
+//
+//	svr.AddMiddleware(builder.APIKeyMiddleware(func(r *http.Request, key string) bool {
+//		return subtle.ConstantTimeCompare([]byte(key), []byte(partnerKey)) == 1
+//	}))
+func APIKeyMiddleware(authenticate func(r *http.Request, key string) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.Header.Get(APIKeyHeader)
+			if apiKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !authenticate(r, apiKey) {
+				SendJsonResponse(w, http.StatusUnauthorized, nil, "Invalid API key")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), requestAPIKeyKey, apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetRequestIP returns the IP of the client that sent the request.
+//
+// The X-Forwarded-For header is only honored if the request comes from one of the
+// TrustedProxies. Each proxy appends the address it got the request from, so the client is
+// the right-most address that is not a trusted proxy, the ones before it can be forged.
+func GetRequestIP(r *http.Request) string {
+	host := getRemoteHost(r)
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+
+	// every hop is a trusted proxy, the first one is the closest to the client
+	return host
+}
+
+// getRemoteHost returns the address the request was sent from, without the port.
+func getRemoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isTrustedProxy returns true if the given IP is in one of the TrustedProxies.
+func isTrustedProxy(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of IPs and networks in CIDR notation,
+// e.g. 10.0.0.0/8,192.168.1.10.
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", item)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", item)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// RateLimitConfig defines a rate limit of a route or a group of routes.
+type RateLimitConfig struct {
+	Name  string           // Name scopes the buckets, the routes of rate limits with the same name share them.
+	Limit RateLimit        // Limit is the token bucket of each client.
+	Key   RateLimitKeyFunc // Key identifies the clients. Defaults to RateLimitKey.
+	Store RateLimitStore   // Store holds the buckets. Defaults to DefaultRateLimitStore.
+}
+
+// RateLimitMiddleware returns a middleware that limits the requests of each client, see Server.Group.
+//
+// Responses have the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers, and requests over the limit get a 429 with a Retry-After header. If the store
+// fails, the requests are let through.
+func RateLimitMiddleware(cfg RateLimitConfig) Middleware {
+	if cfg.Key == nil {
+		cfg.Key = RateLimitKey
+	}
+	if cfg.Store == nil {
+		cfg.Store = DefaultRateLimitStore
+	}
+	policy := fmt.Sprintf("%d;w=%d", int(cfg.Limit.capacity()), int(math.Ceil(cfg.Limit.Period.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := cfg.Store.Take(r.Context(), cfg.Name+":"+cfg.Key(r), cfg.Limit)
+			if err != nil {
+				log.Error().Err(err).Str("rateLimit", cfg.Name).Msg("Error taking rate limit token")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			w.Header().Set("RateLimit-Policy", policy)
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+				SendJsonResponse(w, http.StatusTooManyRequests, nil, "Too many requests")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds returns the given duration in seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// getConfigRateLimit returns the rate limit of the given configuration key, or the default
+// value if it's not set. It returns false if the limit is disabled, and an error if it's invalid.
+func getConfigRateLimit(key string, defaultValue string) (RateLimit, bool, error) {
+	value := config.GetString(key)
+	if value == "" {
+		value = defaultValue
+	}
+
+	limit, ok, err := ParseRateLimit(value)
+	if err != nil {
+		return RateLimit{}, false, fmt.Errorf("%s: %w", key, err)
+	}
+	return limit, ok, nil
+}
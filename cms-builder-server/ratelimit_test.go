@@ -0,0 +1,130 @@
+package builder_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseRateLimit tests that rate limits are parsed from <requests>/<period>.
+func TestParseRateLimit(t *testing.T) {
+	limit, ok, err := builder.ParseRateLimit("100/1m")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, builder.RateLimit{Requests: 100, Period: time.Minute}, limit)
+
+	_, ok, err = builder.ParseRateLimit("off")
+	assert.NoError(t, err)
+	assert.False(t, ok, "off should disable the limit")
+
+	for _, value := range []string{"", "100", "0/1m", "abc/1m", "100/abc", "100/0s"} {
+		_, _, err = builder.ParseRateLimit(value)
+		assert.ErrorIs(t, err, builder.ErrInvalidRateLimit, value)
+	}
+}
+
+// TestRateLimitMiddleware tests that clients over the limit get a 429, and that every
+// client has its own bucket.
+func TestRateLimitMiddleware(t *testing.T) {
+	rateLimit := builder.RateLimitMiddleware(builder.RateLimitConfig{
+		Name:  "test",
+		Limit: builder.RateLimit{Requests: 2, Period: time.Minute},
+		Store: builder.NewMemoryRateLimitStore(),
+	})
+	apiKey := builder.APIKeyMiddleware(func(r *http.Request, key string) bool {
+		return key == "key"
+	})
+	handler := apiKey(rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	})))
+
+	serve := func(ip string, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			request.Header.Set(builder.APIKeyHeader, apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("10.0.0.1", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", recorder.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", "").Code)
+
+	recorder = serve("10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code, "Requests over the limit should be rejected")
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", recorder.Header().Get("Retry-After"), "Clients should retry when the next token is added")
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2", "").Code, "Other IPs should have their own bucket")
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", "key").Code, "Authenticated API keys should have their own bucket")
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", "other").Code, "Invalid API keys should be rejected")
+}
+
+// TestRateLimitKey tests that clients are identified by the IP, and that API keys are only
+// used once they are authenticated.
+func TestRateLimitKey(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "ip:10.0.0.1", builder.RateLimitKey(request))
+
+	request.Header.Set(builder.APIKeyHeader, "key")
+	assert.Equal(t, "ip:10.0.0.1", builder.RateLimitKey(request), "API keys should be ignored until they are authenticated")
+
+	var key string
+	builder.APIKeyMiddleware(func(r *http.Request, key string) bool {
+		return true
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = builder.RateLimitKey(r)
+	})).ServeHTTP(httptest.NewRecorder(), request)
+	assert.Equal(t, "key:key", key)
+	assert.Equal(t, "ip:10.0.0.1", builder.RateLimitIPKey(request), "The IP key should ignore the API key")
+}
+
+// TestGetRequestIP tests that the X-Forwarded-For header is only honored behind the trusted
+// proxies, and that the client is the right-most address that is not a proxy.
+func TestGetRequestIP(t *testing.T) {
+	proxies, err := builder.ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	assert.NoError(t, err, "ParseTrustedProxies should not return an error")
+
+	builder.TrustedProxies = proxies
+	defer func() { builder.TrustedProxies = nil }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct client", "203.0.113.1:1234", "", "203.0.113.1"},
+		{"untrusted proxy", "203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"forged hops", "10.0.0.1:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of proxies", "192.168.1.10:1234", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"only proxies", "10.0.0.1:1234", "10.0.0.2", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			assert.Equal(t, tt.want, builder.GetRequestIP(request))
+		})
+	}
+
+	_, err = builder.ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err, "Invalid networks should be rejected")
+}
@@ -25,6 +25,16 @@ type RequestParameters struct {
 	Roles         []Role
 }
 
+// IsAdmin returns true if the requesting user has the AdminRole.
+func (p *RequestParameters) IsAdmin() bool {
+	for _, role := range p.Roles {
+		if role == AdminRole {
+			return true
+		}
+	}
+	return false
+}
+
 type RequestParamKey string
 
 func (r RequestParamKey) S() string {
@@ -86,12 +96,23 @@ func FormatRequestParameters(r *http.Request, b *Builder) RequestParameters {
 	return params
 }
 
+// requestContextKey is the type of the keys of the values stored in the context of the requests.
+type requestContextKey string
+
+// requestUserKey is the key of the verified user in the context of the requests.
+const requestUserKey requestContextKey = "user"
+
 // getRequestUserId validates the access token in the Authorization header of the request.
 //
 // The function first retrieves the access token from the request header, then verifies it
 // by calling VerifyUser on the App's admin instance. If the verification fails, it returns
 // an empty string. Otherwise, it returns the ID of the verified user as a string.
 func GetRequestUser(r *http.Request, b *Builder) *User {
+	// the user may have been verified already, e.g. once for all the resolvers of a GraphQL query
+	if user, ok := r.Context().Value(requestUserKey).(*User); ok {
+		return user
+	}
+
 	accessToken := GetAccessTokenFromRequest(r)
 	user, err := b.VerifyUser(accessToken)
 	if err != nil {
@@ -162,6 +183,9 @@ func FormatRequestBody(r *http.Request, filterKeys map[string]bool) (map[string]
 
 // ValidateRequestMethod returns an error if the request method does not match the given
 // method string. The error message will include the actual request method.
+//
+// Deprecated: the routes of the server only match their method, see Server.AddRoute, so
+// handlers no longer need to validate it.
 func ValidateRequestMethod(r *http.Request, method string) error {
 	if r.Method != method {
 		return fmt.Errorf("invalid request method: %s", r.Method)
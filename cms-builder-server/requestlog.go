@@ -0,0 +1,181 @@
+package builder
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header with the ID of the request. Clients and proxies can set it
+// to correlate their logs with the logs of the server, and it's echoed in the responses.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDRegex matches the request IDs accepted from the clients, other values are replaced.
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestInfoKey is the key of the requestInfo in the context of the requests.
+const requestInfoKey requestContextKey = "requestInfo"
+
+// requestInfo is what the server knows about a request, filled as it goes through the middlewares.
+// It's shared by pointer, so the middlewares that run first can read what the ones after them learned.
+type requestInfo struct {
+	id     string  // id is the ID of the request, see RequestIDHeader
+	userID string  // userID is the ID of the user, once verified
+	route  string  // route is the name of the route, once matched
+	logger *Logger // logger carries the ID of the request and of the user in every line
+}
+
+// RequestIDMiddleware takes the ID of the request from the X-Request-ID header, or generates
+// one, and echoes it in the response. Handlers get the ID with GetRequestID, and a logger
+// that includes it with GetRequestLogger.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRegex.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := log.With().Str("requestId", id).Logger()
+		info := &requestInfo{id: id, logger: &Logger{Logger: &logger}}
+
+		ctx := context.WithValue(r.Context(), requestInfoKey, info)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getRequestInfo returns the requestInfo of the request, or nil if it didn't go through RequestIDMiddleware.
+func getRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// GetRequestID returns the ID of the request, or an empty string if it has none.
+func GetRequestID(r *http.Request) string {
+	if info := getRequestInfo(r); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// GetRequestLogger returns the logger of the request, which adds the ID of the request, and
+// the ID of the user once verified, to every line. It returns the global logger if the request
+// has no ID.
+//
+// Example:
+//
+//	builder.GetRequestLogger(r).Error().Err(err).Msg("Error creating report")
+func GetRequestLogger(r *http.Request) *Logger {
+	if info := getRequestInfo(r); info != nil {
+		return info.logger
+	}
+	return log
+}
+
+// setRequestUser records the verified user in the access log and the logger of the request.
+func setRequestUser(r *http.Request, user *User) {
+	info := getRequestInfo(r)
+	if info == nil || user == nil {
+		return
+	}
+
+	info.userID = user.GetIDString()
+	logger := info.logger.With().Str("userId", info.userID).Logger()
+	info.logger = &Logger{Logger: &logger}
+}
+
+// recordRouteName records the name of the matched route in the requestInfo, for the access
+// log and the metrics. The router middlewares wrap the router, so they can't see the route otherwise.
+func recordRouteName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := getRequestInfo(r); info != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.route = route.GetName()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseRecorder records the status and the size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader records the status before writing it.
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body, and the status if it wasn't written yet.
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap returns the underlying writer, see http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush sends the buffered data to the client, if the underlying writer supports it.
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// LoggingMiddleware writes an access log line for every request once it's served, with the
+// method, path, name of the route, status, size of the body, latency, and the IDs of the
+// request and of the user. Server errors are logged as errors.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		event := log.Info()
+		if status >= http.StatusInternalServerError {
+			event = log.Error()
+		}
+
+		routeName, userID := "", ""
+		if info := getRequestInfo(r); info != nil {
+			event = event.Str("requestId", info.id)
+			routeName = info.route
+			userID = info.userID
+		}
+
+		event.
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("route", routeName).
+			Int("status", status).
+			Int("bytes", recorder.bytes).
+			Dur("latency", time.Since(start)).
+			Str("userId", userID).
+			Msg("Request")
+	})
+}
@@ -0,0 +1,80 @@
+package builder_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRequestIDMiddleware tests that requests get an ID, taken from the header if valid, which
+// is echoed in the response and reachable from the handlers.
+func TestRequestIDMiddleware(t *testing.T) {
+	var handlerID string
+	handler := builder.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerID = builder.GetRequestID(r)
+		assert.NotNil(t, builder.GetRequestLogger(r), "Handlers should get the logger of the request")
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	}))
+
+	serve := func(id string) string {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			request.Header.Set(builder.RequestIDHeader, id)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Header().Get(builder.RequestIDHeader)
+	}
+
+	id := serve("")
+	assert.NotEmpty(t, id, "An ID should be generated if the request has none")
+	assert.Equal(t, id, handlerID)
+	assert.NotEqual(t, id, serve(""), "Every request should get its own ID")
+
+	assert.Equal(t, "abc-123", serve("abc-123"), "The ID sent by the client should be kept")
+	assert.Equal(t, "abc-123", handlerID)
+
+	id = serve("not valid\n")
+	assert.NotEqual(t, "not valid\n", id, "Invalid IDs should be replaced")
+	assert.NotEmpty(t, id)
+}
+
+// TestServerRequestID tests that every request of the server echoes its ID, including the
+// ones that don't match a route.
+func TestServerRequestID(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+	server.Reload()
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(builder.RequestIDHeader, "abc-123")
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "abc-123", recorder.Header().Get(builder.RequestIDHeader))
+
+	unmatched := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound},
+		{http.MethodDelete, "/", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range unmatched {
+		request = httptest.NewRequest(tt.method, tt.path, nil)
+		recorder = httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+
+		assert.Equal(t, tt.status, recorder.Code)
+		assert.NotEmpty(t, recorder.Header().Get(builder.RequestIDHeader), "Requests that don't match a route should get an ID")
+		assert.NotEmpty(t, recorder.Header().Get("Access-Control-Allow-Origin"), "Requests that don't match a route should get the CORS headers")
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(t, builder.GetRequestID(request), "Requests that didn't go through the server have no ID")
+}
@@ -0,0 +1,313 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// these keys are removed from a snapshot before it is sent back through the update endpoint
+var revertFilterKeys = map[string]bool{
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// FieldDiff represents the change of a single field between two revisions.
+type FieldDiff struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// RevisionsDiff is the output of the revisions diff endpoint.
+type RevisionsDiff struct {
+	From    HistoryEntry `json:"from"`
+	To      HistoryEntry `json:"to"`
+	Changes []FieldDiff  `json:"changes"`
+}
+
+// GetHistoryEntriesForInstance returns the history entries recorded for the given resource,
+// newest first.
+//
+// Parameters:
+//   - db: the database to query.
+//   - resourceName: the name of the resource, as stored by NewLogHistoryEntry.
+//   - resourceId: the ID of the resource.
+//   - pagination: optional pagination information.
+//
+// Returns:
+//   - []HistoryEntry: the history entries for the resource.
+//   - error: an error if the query fails.
+func GetHistoryEntriesForInstance(db *Database, resourceName string, resourceId string, pagination *Pagination) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	query := "resource_name = ? AND resource_id = ?"
+
+	if pagination == nil {
+		err := db.DB.Where(query, resourceName, resourceId).Order("id desc").Find(&entries).Error
+		return entries, err
+	}
+
+	// Retrieve total number of records
+	db.DB.Model(&HistoryEntry{}).Where(query, resourceName, resourceId).Count(&pagination.Total)
+
+	// Apply pagination
+	offset := (pagination.Page - 1) * pagination.Limit
+	err := db.DB.Where(query, resourceName, resourceId).
+		Order("id desc").
+		Limit(pagination.Limit).
+		Offset(offset).
+		Find(&entries).Error
+
+	return entries, err
+}
+
+// GetHistoryEntryForInstance returns a single history entry for the given resource.
+//
+// It returns an error if the entry does not exist or does not belong to the resource.
+func GetHistoryEntryForInstance(db *Database, resourceName string, resourceId string, historyId string) (*HistoryEntry, error) {
+	var entry HistoryEntry
+
+	err := db.DB.
+		Where("id = ? AND resource_name = ? AND resource_id = ?", historyId, resourceName, resourceId).
+		First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Snapshot returns the JSON snapshot stored in the Detail field as a map.
+func (h *HistoryEntry) Snapshot() (map[string]interface{}, error) {
+	var snapshot map[string]interface{}
+	err := json.Unmarshal([]byte(h.Detail), &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling history detail: %w", err)
+	}
+	return snapshot, nil
+}
+
+// DiffHistoryEntries computes the field-level differences between two history entries.
+//
+// Only top-level fields are compared. Fields that exist in only one of the snapshots are
+// reported with a nil value on the other side. The result is sorted by field name.
+//
+// Parameters:
+//   - from: the older history entry.
+//   - to: the newer history entry.
+//
+// Returns:
+//   - []FieldDiff: the fields whose values differ.
+//   - error: an error if any of the snapshots cannot be parsed.
+func DiffHistoryEntries(from HistoryEntry, to HistoryEntry) ([]FieldDiff, error) {
+	before, err := from.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := to.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for key := range before {
+		fields[key] = true
+	}
+	for key := range after {
+		fields[key] = true
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	diffs := make([]FieldDiff, 0)
+	for _, key := range keys {
+		if reflect.DeepEqual(before[key], after[key]) {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{
+			Field:  key,
+			Before: before[key],
+			After:  after[key],
+		})
+	}
+
+	return diffs, nil
+}
+
+/*
+	REVISIONS HANDLERS
+*/
+
+// ApiRevisions returns a handler function that responds to GET requests on the
+// revisions endpoint, e.g. /api/users/{id}/revisions.
+//
+// The handler lists the snapshots stored in the history for the given record,
+// newest first. The user needs read access to the record.
+func (a *App) ApiRevisions(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		_, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		limit, err := strconv.Atoi(GetQueryParam("limit", r))
+		if err != nil {
+			limit = 10
+		}
+
+		page, err := strconv.Atoi(GetQueryParam("page", r))
+		if err != nil {
+			page = 1
+		}
+
+		pagination := &Pagination{
+			Total: 0,
+			Page:  page,
+			Limit: limit,
+		}
+
+		entries, err := GetHistoryEntriesForInstance(db, a.Name(), instanceId, pagination)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponseWithPagination(w, http.StatusOK, entries, a.Name()+" revisions", pagination)
+	}
+}
+
+// ApiRevisionsDiff returns a handler function that responds to GET requests on the
+// revisions diff endpoint, e.g. /api/users/{id}/revisions/diff?from=1&to=2.
+//
+// The from and to query parameters are the IDs of two history entries of the record.
+func (a *App) ApiRevisionsDiff(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		_, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		fromId := GetQueryParam("from", r)
+		toId := GetQueryParam("to", r)
+		if fromId == "" || toId == "" {
+			SendJsonResponse(w, http.StatusBadRequest, nil, "from and to parameters are required")
+			return
+		}
+
+		from, err := GetHistoryEntryForInstance(db, a.Name(), instanceId, fromId)
+		if err != nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Revision not found: "+fromId)
+			return
+		}
+
+		to, err := GetHistoryEntryForInstance(db, a.Name(), instanceId, toId)
+		if err != nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Revision not found: "+toId)
+			return
+		}
+
+		changes, err := DiffHistoryEntries(*from, *to)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		output := RevisionsDiff{
+			From:    *from,
+			To:      *to,
+			Changes: changes,
+		}
+
+		SendJsonResponse(w, http.StatusOK, output, a.Name()+" revisions diff")
+	}
+}
+
+// ApiRevert returns a handler function that responds to POST requests on the
+// revert endpoint, e.g. /api/users/{id}/revert/{historyId}.
+//
+// The snapshot stored in the history entry is sent through the App's update
+// handler, so the same permissions, validations and history logging apply as
+// for a regular update. The user must be allowed to update the record before
+// the history entry is looked up.
+func (a *App) ApiRevert(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationUpdate)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to update this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		_, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		historyId := GetUrlParam("historyId", r)
+		entry, err := GetHistoryEntryForInstance(db, a.Name(), instanceId, historyId)
+		if err != nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Revision not found")
+			return
+		}
+
+		snapshot, err := entry.Snapshot()
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		for key := range revertFilterKeys {
+			delete(snapshot, key)
+		}
+
+		body, err := json.Marshal(snapshot)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		request := &http.Request{
+			Method: http.MethodPut,
+			Header: r.Header,
+			URL:    r.URL,
+			Body:   io.NopCloser(bytes.NewBuffer(body)),
+		}
+		request = mux.SetURLVars(request.WithContext(r.Context()), map[string]string{"id": instanceId})
+
+		// This will send the response to the client
+		a.ApiUpdate(db)(w, request)
+	}
+}
@@ -0,0 +1,144 @@
+package builder_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffHistoryEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		want    []builder.FieldDiff
+		wantErr bool
+	}{
+		{
+			name: "no changes",
+			from: `{"ID":1,"field":"a"}`,
+			to:   `{"ID":1,"field":"a"}`,
+			want: []builder.FieldDiff{},
+		},
+		{
+			name: "changed field",
+			from: `{"ID":1,"field":"a","other":"b"}`,
+			to:   `{"ID":1,"field":"c","other":"b"}`,
+			want: []builder.FieldDiff{
+				{Field: "field", Before: "a", After: "c"},
+			},
+		},
+		{
+			name: "added and removed fields",
+			from: `{"ID":1,"removed":"a"}`,
+			to:   `{"ID":1,"added":"b"}`,
+			want: []builder.FieldDiff{
+				{Field: "added", Before: nil, After: "b"},
+				{Field: "removed", Before: "a", After: nil},
+			},
+		},
+		{
+			name:    "invalid snapshot",
+			from:    `not json`,
+			to:      `{"ID":1}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := builder.HistoryEntry{Detail: tt.from}
+			to := builder.HistoryEntry{Detail: tt.to}
+
+			got, err := builder.DiffHistoryEntries(from, to)
+			if tt.wantErr {
+				assert.Error(t, err, "DiffHistoryEntries should return an error")
+				return
+			}
+
+			assert.NoError(t, err, "DiffHistoryEntries should not return an error")
+			assert.Equal(t, tt.want, got, "DiffHistoryEntries should return the expected changes")
+		})
+	}
+}
+
+// TestRevertRevision tests that a record can be listed by revisions and restored to a previous state.
+//
+// It creates a resource, updates it, and then reverts it to the snapshot taken on creation.
+func TestRevertRevision(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	instance, user, userRollback := th.CreateMockResource(t, e.DB, e.App, nil)
+	defer userRollback()
+
+	updateRequest, _, _ := th.NewRequest(
+		http.MethodPut,
+		`{"field": "updated_field"}`,
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString()},
+	)
+	_, err = th.ExecuteApiCall(t, e.App.ApiUpdate(e.DB), updateRequest, nil)
+	assert.NoError(t, err, "ApiUpdate should not return an error")
+
+	t.Log("Listing revisions")
+	listRequest, _, _ := th.NewRequest(
+		http.MethodGet,
+		"",
+		true,
+		user,
+		map[string]string{"id": instance.GetIDString()},
+	)
+
+	var revisions []builder.HistoryEntry
+	response, err := th.ExecuteApiCall(t, e.App.ApiRevisions(e.DB), listRequest, &revisions)
+	assert.NoError(t, err, "ApiRevisions should not return an error")
+	assert.True(t, response.Success, "ApiRevisions should return a success response")
+	assert.Equal(t, 2, len(revisions), "There should be two revisions")
+	assert.Equal(t, builder.UpdateCRUDAction, revisions[0].Action, "Newest revision should be the update")
+	assert.Equal(t, builder.CreateCRUDAction, revisions[1].Action, "Oldest revision should be the creation")
+
+	t.Log("Reverting to the created revision")
+	revertRequest, _, _ := th.NewRequest(
+		http.MethodPost,
+		"",
+		true,
+		user,
+		map[string]string{
+			"id":        instance.GetIDString(),
+			"historyId": fmt.Sprint(revisions[1].ID),
+		},
+	)
+
+	var reverted th.MockStruct
+	response, err = th.ExecuteApiCall(t, e.App.ApiRevert(e.DB), revertRequest, &reverted)
+	assert.NoError(t, err, "ApiRevert should not return an error")
+	assert.True(t, response.Success, "ApiRevert should return a success response")
+	assert.Equal(t, instance.ID, reverted.ID, "ID should be the same")
+	assert.Equal(t, instance.Field, reverted.Field, "Field should be restored")
+
+	t.Log("Reverting a record of another user")
+	for _, historyId := range []string{fmt.Sprint(revisions[1].ID), "0"} {
+		otherRequest, _, otherRollback := th.NewRequest(
+			http.MethodPost,
+			"",
+			true,
+			nil,
+			map[string]string{
+				"id":        instance.GetIDString(),
+				"historyId": historyId,
+			},
+		)
+
+		response, err = th.ExecuteApiCall(t, e.App.ApiRevert(e.DB), otherRequest, nil)
+		otherRollback()
+		assert.NoError(t, err, "ApiRevert should not return an error")
+		assert.False(t, response.Success, "ApiRevert should not revert records of other users")
+		assert.NotEqual(t, "Revision not found", response.Message, "ApiRevert should not tell whether the revision exists")
+	}
+}
@@ -0,0 +1,524 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// RichTextFormat is the markup a rich text field is written in.
+type RichTextFormat string
+
+const (
+	RichTextHTML     RichTextFormat = "html"
+	RichTextMarkdown RichTextFormat = "markdown"
+)
+
+// mediaScheme is the URL scheme used to embed uploads in rich text, e.g. <img src="media:12">
+// or ![photo](media:12). References are resolved to the URL of the upload in responses.
+const mediaScheme = "media"
+
+// only references used as a link or image destination are resolved, so text that happens
+// to contain media:12 is left alone
+var mediaReferencePattern = regexp.MustCompile(`((?:src|href)="|\]\(\s*<?|\]:[ \t]*<?)` + mediaScheme + `:(\d+)`)
+
+// RichTextAllowlist defines the HTML elements and attributes that are kept when rich text is
+// sanitized. Anything else is removed, and the content of script and style elements is dropped.
+type RichTextAllowlist struct {
+	Elements   map[string][]string // Allowed elements and the attributes allowed on each of them
+	URLSchemes []string            // Schemes allowed in links and images, relative URLs and media references are always allowed
+}
+
+// DefaultRichTextAllowlist is used by the rich text fields registered without an allowlist.
+var DefaultRichTextAllowlist = RichTextAllowlist{
+	Elements: map[string][]string{
+		"p":          nil,
+		"br":         nil,
+		"hr":         nil,
+		"h1":         nil,
+		"h2":         nil,
+		"h3":         nil,
+		"h4":         nil,
+		"h5":         nil,
+		"h6":         nil,
+		"strong":     nil,
+		"b":          nil,
+		"em":         nil,
+		"i":          nil,
+		"u":          nil,
+		"s":          nil,
+		"del":        nil,
+		"sub":        nil,
+		"sup":        nil,
+		"span":       nil,
+		"blockquote": nil,
+		"code":       nil,
+		"pre":        nil,
+		"ul":         nil,
+		"ol":         {"start"},
+		"li":         nil,
+		"a":          {"href", "title"},
+		"img":        {"src", "alt", "title", "width", "height"},
+		"figure":     nil,
+		"figcaption": nil,
+		"table":      nil,
+		"thead":      nil,
+		"tbody":      nil,
+		"tr":         nil,
+		"th":         {"colspan", "rowspan"},
+		"td":         {"colspan", "rowspan"},
+	},
+	URLSchemes: []string{"http", "https", "mailto"},
+}
+
+// Policy returns the sanitization policy of the allowlist.
+func (al RichTextAllowlist) Policy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowRelativeURLs(true)
+	policy.AllowURLSchemes(append([]string{mediaScheme}, al.URLSchemes...)...)
+
+	for element, attributes := range al.Elements {
+		policy.AllowElements(element)
+		if len(attributes) > 0 {
+			policy.AllowAttrs(attributes...).OnElements(element)
+		}
+	}
+
+	return policy
+}
+
+// RichTextField defines a field of an App that stores HTML or Markdown.
+type RichTextField struct {
+	Field      string            // JSON name of the field
+	Format     RichTextFormat    // Markup the field is written in
+	Allowlist  RichTextAllowlist // Elements and attributes kept when the field is sanitized
+	RenderHTML bool              // Whether responses include the field rendered to HTML, in <field>Html
+	policy     *bluemonday.Policy
+}
+
+// NewRichTextField returns the definition of a rich text field. A nil allowlist means
+// DefaultRichTextAllowlist.
+func NewRichTextField(field string, format RichTextFormat, allowlist *RichTextAllowlist, render bool) (*RichTextField, error) {
+	if format != RichTextHTML && format != RichTextMarkdown {
+		return nil, fmt.Errorf("invalid rich text format %q", format)
+	}
+
+	if allowlist == nil {
+		allowlist = &DefaultRichTextAllowlist
+	}
+
+	return &RichTextField{
+		Field:      field,
+		Format:     format,
+		Allowlist:  *allowlist,
+		RenderHTML: render,
+		policy:     allowlist.Policy(),
+	}, nil
+}
+
+// RenderedField returns the key the rendered HTML of the field is sent in.
+func (f *RichTextField) RenderedField() string {
+	return f.Field + "Html"
+}
+
+// MediaType returns the media type of the content of the field.
+func (f *RichTextField) MediaType() string {
+	if f.Format == RichTextMarkdown {
+		return "text/markdown"
+	}
+	return "text/html"
+}
+
+// Sanitize removes the elements and attributes that are not in the allowlist.
+//
+// Markdown is kept as Markdown, only the HTML embedded in it is sanitized. Links and images
+// written with the Markdown syntax can't be rewritten, so it returns an error if their URL
+// has a scheme that is not in the allowlist, e.g. javascript:.
+func (f *RichTextField) Sanitize(value string) (string, error) {
+	if f.Format == RichTextMarkdown {
+		err := checkMarkdownURLs(value, f.Allowlist.URLSchemes)
+		if err != nil {
+			return "", err
+		}
+		return sanitizeMarkdown(value, f.policy), nil
+	}
+	return f.policy.Sanitize(value), nil
+}
+
+// Render returns the value of the field as sanitized HTML.
+func (f *RichTextField) Render(value string) (string, error) {
+	if f.Format == RichTextHTML {
+		return f.policy.Sanitize(value), nil
+	}
+
+	// raw HTML is kept by the renderer, the output goes through the allowlist anyway
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+	)
+
+	var buf bytes.Buffer
+	err := md.Convert([]byte(value), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return f.policy.Sanitize(buf.String()), nil
+}
+
+// urlSchemePattern matches the scheme of a URL, relative URLs have none.
+var urlSchemePattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+
+// checkMarkdownURLs returns an error if a link or image of the given Markdown has a URL with a
+// scheme other than the given ones or media. Relative URLs are allowed.
+func checkMarkdownURLs(value string, schemes []string) error {
+	allowed := map[string]bool{mediaScheme: true}
+	for _, scheme := range schemes {
+		allowed[strings.ToLower(scheme)] = true
+	}
+
+	source := []byte(value)
+	doc := goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser().Parse(text.NewReader(source))
+
+	return ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		var destination string
+		switch node := n.(type) {
+		case *ast.Link:
+			destination = string(node.Destination)
+		case *ast.Image:
+			destination = string(node.Destination)
+		case *ast.AutoLink:
+			destination = string(node.URL(source))
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		// browsers decode the entities and ignore the whitespace and control characters, e.g. java&#9;script:
+		cleaned := strings.Map(func(r rune) rune {
+			if r <= ' ' || r == 0x7f {
+				return -1
+			}
+			return r
+		}, html.UnescapeString(destination))
+
+		match := urlSchemePattern.FindStringSubmatch(cleaned)
+		if match != nil && !allowed[strings.ToLower(match[1])] {
+			return ast.WalkStop, fmt.Errorf("URL %q has a scheme that is not allowed", destination)
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+// sanitizeMarkdown sanitizes the HTML blocks and inline HTML of the given Markdown with the
+// given policy, leaving the rest of the source untouched.
+func sanitizeMarkdown(value string, policy *bluemonday.Policy) string {
+	source := []byte(value)
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	// segments of the source that hold HTML
+	segments := make([]text.Segment, 0)
+	addSegments := func(lines *text.Segments) {
+		if lines.Len() == 0 {
+			return
+		}
+
+		// nested blocks, e.g. in quotes or lists, have the markers between their lines
+		contiguous := true
+		for i := 1; i < lines.Len(); i++ {
+			if lines.At(i).Start != lines.At(i-1).Stop {
+				contiguous = false
+				break
+			}
+		}
+
+		if contiguous {
+			segments = append(segments, text.NewSegment(lines.At(0).Start, lines.At(lines.Len()-1).Stop))
+			return
+		}
+		for i := 0; i < lines.Len(); i++ {
+			segments = append(segments, lines.At(i))
+		}
+	}
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.HTMLBlock:
+			lines := text.NewSegments()
+			lines.AppendAll(node.Lines().Sliced(0, node.Lines().Len()))
+			if node.HasClosure() {
+				lines.Append(node.ClosureLine)
+			}
+			addSegments(lines)
+		case *ast.RawHTML:
+			addSegments(node.Segments)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	if len(segments) == 0 {
+		return value
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+
+	var sb strings.Builder
+	last := 0
+	for _, segment := range segments {
+		if segment.Start < last {
+			continue
+		}
+		sb.Write(source[last:segment.Start])
+		sb.WriteString(policy.Sanitize(string(source[segment.Start:segment.Stop])))
+		last = segment.Stop
+	}
+	sb.Write(source[last:])
+
+	return sb.String()
+}
+
+// GetMediaReferences returns the IDs of the uploads referenced in the given rich text.
+func GetMediaReferences(value string) []string {
+	ids := make([]string, 0)
+	for _, match := range mediaReferencePattern.FindAllStringSubmatch(value, -1) {
+		ids = append(ids, match[2])
+	}
+	return ids
+}
+
+// ResolveMediaReferences replaces the references to uploads in the given rich text with
+// their URLs. References to uploads that are not in the map are left as they are.
+func ResolveMediaReferences(value string, urls map[string]string) string {
+	return mediaReferencePattern.ReplaceAllStringFunc(value, func(match string) string {
+		groups := mediaReferencePattern.FindStringSubmatch(match)
+		url, ok := urls[groups[2]]
+		if !ok {
+			return match
+		}
+		return groups[1] + url
+	})
+}
+
+// GetMediaUrls returns the URLs of the uploads with the given IDs, keyed by ID.
+func GetMediaUrls(db *Database, ids []string) (map[string]string, error) {
+	urls := make(map[string]string)
+	if len(ids) == 0 {
+		return urls, nil
+	}
+
+	var uploads []Upload
+	err := db.DB.Where("id IN ?", ids).Find(&uploads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upload := range uploads {
+		if upload.FileData != nil {
+			urls[fmt.Sprint(upload.SystemData.ID)] = upload.Url
+		}
+	}
+
+	return urls, nil
+}
+
+// RegisterRichTextField declares a field of the model that stores HTML or Markdown.
+//
+// Values are sanitized against the allowlist when records are created or updated, and
+// references to uploads, e.g. <img src="media:12">, are resolved to their URLs in responses.
+//
+// Parameters:
+// - field: the name of the field.
+// - format: the markup the field is written in, RichTextHTML or RichTextMarkdown.
+// - allowlist: the elements and attributes to keep, nil means DefaultRichTextAllowlist.
+// - render: whether responses include the field rendered to HTML, e.g. bodyHtml for body.
+//
+// Returns:
+// - error: an error if the field is not found in the model, is not a string or the format is invalid.
+func (a *App) RegisterRichTextField(field FieldName, format RichTextFormat, allowlist *RichTextAllowlist, render bool) error {
+	structField, err := GetStructFieldByJsonName(a.Model, field.S())
+	if err != nil {
+		return err
+	}
+	if structField.Type.Kind() != reflect.String {
+		return fmt.Errorf("field %s must be a string", field)
+	}
+
+	richText, err := NewRichTextField(field.S(), format, allowlist, render)
+	if err != nil {
+		return err
+	}
+
+	if a.RichText == nil {
+		a.RichText = make(map[string]*RichTextField)
+	}
+	a.RichText[field.S()] = richText
+
+	return nil
+}
+
+// HasRichText returns true if the App has at least one rich text field.
+func (a *App) HasRichText() bool {
+	return len(a.RichText) > 0
+}
+
+// PrepareRichText sanitizes the rich text fields of the given instance, and checks that the
+// uploads they reference exist and can be accessed by the user.
+func (a *App) PrepareRichText(db *Database, instance interface{}, params *RequestParameters) error {
+	if !a.HasRichText() || a.IsContentType() {
+		return nil
+	}
+
+	ids := make([]string, 0)
+	for name, field := range a.RichText {
+		value, err := GetFieldValueByJsonName(instance, name)
+		if err != nil {
+			return err
+		}
+
+		sanitized, err := field.Sanitize(value.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		value.SetString(sanitized)
+		ids = append(ids, GetMediaReferences(sanitized)...)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	q := db.DB.Model(&Upload{}).Where("id IN ?", ids)
+	if !params.IsAdmin() {
+		q = q.Where("created_by_id = ?", params.RequestedById)
+	}
+
+	var found []uint
+	err := q.Pluck("id", &found).Error
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(found))
+	for _, id := range found {
+		existing[fmt.Sprint(id)] = true
+	}
+	for _, id := range ids {
+		if !existing[id] {
+			return fmt.Errorf("media %s not found", id)
+		}
+	}
+
+	return nil
+}
+
+// RenderRichText resolves the references to uploads in the rich text fields of the given
+// records and adds the rendered HTML of the fields that have it enabled.
+//
+// Parameters:
+//   - db: the database to look the uploads up.
+//   - records: a record or a slice of records of the App.
+//
+// Returns:
+//   - interface{}: the records as maps, or the given records if the App has no rich text fields.
+//   - error: an error if the records can't be converted or the uploads can't be queried.
+func (a *App) RenderRichText(db *Database, records interface{}) (interface{}, error) {
+	if !a.HasRichText() {
+		return records, nil
+	}
+
+	items, single, err := jsonifyRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	for _, item := range items {
+		for name := range a.RichText {
+			if value, ok := item[name].(string); ok {
+				ids = append(ids, GetMediaReferences(value)...)
+			}
+		}
+	}
+
+	urls, err := GetMediaUrls(db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		for name, field := range a.RichText {
+			value, ok := item[name].(string)
+			if !ok {
+				continue
+			}
+
+			value = ResolveMediaReferences(value, urls)
+			item[name] = value
+
+			if field.RenderHTML {
+				rendered, err := field.Render(value)
+				if err != nil {
+					return nil, err
+				}
+				item[field.RenderedField()] = rendered
+			}
+		}
+	}
+
+	if single {
+		return items[0], nil
+	}
+	return items, nil
+}
+
+// annotateRichTextSchema sets the media type of the rich text fields in the given schema,
+// and adds their rendered HTML as read only properties.
+func (a *App) annotateRichTextSchema(schema *jsonschema.Schema) {
+	if !a.HasRichText() {
+		return
+	}
+
+	definition, ok := schema.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	if !ok || definition.Properties == nil {
+		return
+	}
+
+	for name, field := range a.RichText {
+		property, ok := definition.Properties.Get(name)
+		if !ok {
+			continue
+		}
+		property.ContentMediaType = field.MediaType()
+
+		if field.RenderHTML {
+			definition.Properties.Set(field.RenderedField(), &jsonschema.Schema{
+				Type:             "string",
+				ContentMediaType: "text/html",
+				ReadOnly:         true,
+			})
+		}
+	}
+}
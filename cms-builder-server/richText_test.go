@@ -0,0 +1,111 @@
+package builder_test
+
+import (
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRichTextSanitize(t *testing.T) {
+	html, err := builder.NewRichTextField("body", builder.RichTextHTML, nil, false)
+	assert.NoError(t, err, "NewRichTextField should not return an error")
+
+	markdown, err := builder.NewRichTextField("body", builder.RichTextMarkdown, nil, false)
+	assert.NoError(t, err, "NewRichTextField should not return an error")
+
+	tests := []struct {
+		name    string
+		field   *builder.RichTextField
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "scripts are removed",
+			field: html,
+			value: `<p>Hi<script>alert(1)</script></p>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "event handlers are removed",
+			field: html,
+			value: `<p onclick="alert(1)">Hi</p>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "javascript links are removed",
+			field: html,
+			value: `<a href="javascript:alert(1)">Hi</a>`,
+			want:  `Hi`,
+		},
+		{
+			name:  "media references are kept",
+			field: html,
+			value: `<img src="media:12" alt="photo">`,
+			want:  `<img src="media:12" alt="photo">`,
+		},
+		{
+			name:  "markdown is kept",
+			field: markdown,
+			value: "# Title\n\n> quote & *text*\n",
+			want:  "# Title\n\n> quote & *text*\n",
+		},
+		{
+			name:  "html in markdown is sanitized",
+			field: markdown,
+			value: "Hi <b onclick=\"alert(1)\">there</b>\n",
+			want:  "Hi <b>there</b>\n",
+		},
+		{
+			name:  "markdown links and images with allowed schemes are kept",
+			field: markdown,
+			value: "[a](https://example.com) [b](/about) ![c](media:12) <mailto:hi@example.com>\n",
+			want:  "[a](https://example.com) [b](/about) ![c](media:12) <mailto:hi@example.com>\n",
+		},
+		{
+			name:    "markdown javascript links are rejected",
+			field:   markdown,
+			value:   "[Hi](javascript:alert(1))\n",
+			wantErr: true,
+		},
+		{
+			name:    "markdown images with encoded schemes are rejected",
+			field:   markdown,
+			value:   "![Hi](java&#9;script:alert(1))\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.Sanitize(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err, "Sanitize should return an error")
+				return
+			}
+			assert.NoError(t, err, "Sanitize should not return an error")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRichTextRender(t *testing.T) {
+	markdown, err := builder.NewRichTextField("body", builder.RichTextMarkdown, nil, true)
+	assert.NoError(t, err, "NewRichTextField should not return an error")
+
+	rendered, err := markdown.Render("# Title\n\n[link](javascript:alert(1)) ![photo](https://example.com/a.png)\n")
+	assert.NoError(t, err, "Render should not return an error")
+	assert.Equal(t, "<h1>Title</h1>\n<p>link <img src=\"https://example.com/a.png\" alt=\"photo\"></p>\n", rendered)
+}
+
+func TestResolveMediaReferences(t *testing.T) {
+	urls := map[string]string{"12": "https://example.com/a.png"}
+
+	value := `<img src="media:12"> ![photo](media:12) ![missing](media:13) media:12`
+	assert.Equal(t, []string{"12", "12", "13"}, builder.GetMediaReferences(value))
+	assert.Equal(t,
+		`<img src="https://example.com/a.png"> ![photo](https://example.com/a.png) ![missing](media:13) media:12`,
+		builder.ResolveMediaReferences(value, urls),
+	)
+}
@@ -2,6 +2,7 @@ package builder
 
 import (
 	"fmt"
+	"reflect"
 	"time"
 
 	gocron "github.com/go-co-op/gocron/v2"
@@ -95,13 +96,16 @@ func (s *Scheduler) RegisterJob(name string, frequency JobFrequency, function an
 		return err
 	}
 
+	task, err := s.newMeasuredTask(name, function, parameters...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating job")
+		return err
+	}
+
 	// add a job to the scheduler
 	_, err = s.Cron.NewJob(
 		frequencyDefinition,
-		gocron.NewTask(
-			function,
-			parameters...,
-		),
+		task,
 		gocron.WithEventListeners(
 			gocron.BeforeJobRuns(
 				func(jobID uuid.UUID, jobName string) {
@@ -165,6 +169,64 @@ func (s *Scheduler) RegisterJob(name string, frequency JobFrequency, function an
 	return nil
 }
 
+// newMeasuredTask returns a task that calls the given function with the given parameters, and
+// records the duration and the result of every run, see Metrics.
+//
+// The hooks of a job only get its ID, and the runs of a job can overlap, so each run is
+// measured by the task itself. The error returned by the function, if any, is passed on.
+func (s *Scheduler) newMeasuredTask(name string, function any, parameters ...any) (gocron.Task, error) {
+	// the wrapper has no parameters, so the ones of the function are checked here
+	fn := reflect.ValueOf(function)
+	if fn.Kind() != reflect.Func {
+		return nil, gocron.ErrNewJobTaskNotFunc
+	}
+
+	// variadic functions take any number of parameters after the fixed ones
+	fnType := fn.Type()
+	fixed := fnType.NumIn()
+	if fnType.IsVariadic() {
+		fixed--
+		if len(parameters) < fixed {
+			return nil, gocron.ErrNewJobWrongNumberOfParameters
+		}
+	} else if len(parameters) != fixed {
+		return nil, gocron.ErrNewJobWrongNumberOfParameters
+	}
+
+	args := make([]reflect.Value, len(parameters))
+	for i, parameter := range parameters {
+		parameterType := fnType.In(min(i, fnType.NumIn()-1))
+		if i >= fixed {
+			parameterType = parameterType.Elem()
+		}
+
+		if parameter == nil {
+			args[i] = reflect.Zero(parameterType)
+			continue
+		}
+		args[i] = reflect.ValueOf(parameter)
+		if !args[i].Type().AssignableTo(parameterType) {
+			return nil, gocron.ErrNewJobWrongTypeOfParameters
+		}
+	}
+
+	return gocron.NewTask(func() error {
+		start := time.Now()
+
+		// Call packs the parameters after the fixed ones in the variadic slice
+		var err error
+		for _, result := range fn.Call(args) {
+			if resultErr, ok := result.Interface().(error); ok {
+				err = resultErr
+				break
+			}
+		}
+
+		s.Builder.Metrics.observeJobRun(name, time.Since(start), err)
+		return err
+	}), nil
+}
+
 func (s *Scheduler) UpdateTaskStatus(id string, status TaskStatus, errMsg string) error {
 	task := s.GetSchedulerTask(id)
 	task.Status = status
@@ -1,9 +1,13 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	// "github.com/gorilla/csrf"
 
@@ -19,29 +23,47 @@ var (
 
 // RouteHandler defines a structure for storing route information.
 type RouteHandler struct {
-	Route        string      // route is the path for the route. i.e. /users/{id}
-	Handler      HandlerFunc // handler is the handler for the route
-	Name         string      // name is the name of the route
-	RequiresAuth bool        // requiresAuth is a flag indicating if the route requires authentication
-	Schema       interface{} // represents the input
-	Method       string      // method is the HTTP method for the route
+	Route        string       // route is the path for the route. i.e. /users/{id}
+	Handler      HandlerFunc  // handler is the handler for the route
+	Name         string       // name is the name of the route
+	RequiresAuth bool         // requiresAuth is a flag indicating if the route requires authentication
+	Schema       interface{}  // represents the input
+	Method       string       // method is the HTTP method for the route, every method is matched if empty
+	Legacy       bool         // legacy routes are kept for compatibility, they are left out of the API documents and clients
+	Middlewares  []Middleware // middlewares the route goes through, after the authentication, the first one runs first
 }
 
 // Server defines a structure for managing an HTTP server with middleware and routing capabilities.
 type Server struct {
 	*http.Server                                   // Server is the underlying HTTP server
 	Middlewares  []func(http.Handler) http.Handler // middlewares is a slice of middleware functions
+	PreAuth      []Middleware                      // PreAuth are the middlewares of the routes under /private, before the authentication
+	Private      []Middleware                      // private are the middlewares of the routes under /private, after the authentication
 	Routes       []RouteHandler                    // routes is a slice of route handlers
 	Root         *mux.Router                       // root is the root handler for the server
+	handler      http.Handler                      // handler is the root wrapped in the router middlewares, see wrapRouter
 	Builder      *Builder
+	mu           sync.RWMutex // mu guards Routes and Root, which can change while serving
+	live         bool         // live is true once the routes are bound, after that any change rebuilds the router
+	updates      int          // updates counts the BeginUpdate calls without a Commit, the router isn't rebuilt meanwhile
+	pending      bool         // pending is true if the routes changed during an update
+	version      uint64       // version counts the changes of the routes, so what is built from them can be cached
+	redirect     *http.Server // redirect is the plain HTTP server redirecting to HTTPS, if enabled
+	LegacyRoutes bool         // LegacyRoutes keeps the verb paths of the Apps, e.g. /api/posts/new, see Admin.registerAPIRoutes
+	Metrics      *Metrics     // Metrics counts the requests of every route, if enabled, see Builder.InitMetrics
+
+	userRateLimit Middleware // userRateLimit is the per-user limit of the /private routes, shared with /graphql
 }
 
 // ServerConfig defines the configuration options for creating a new Server.
 type ServerConfig struct {
-	Host      string // Host is the hostname or IP address to listen on.
-	Port      string // Port is the port number to listen on.
-	CSRFToken string // CSRFToken is the CSRF token to use for CSRF protection.
+	Host      string     // Host is the hostname or IP address to listen on.
+	Port      string     // Port is the port number to listen on.
+	CSRFToken string     // CSRFToken is the CSRF token to use for CSRF protection.
+	TLS       *TLSConfig // TLS enables HTTPS and HTTP/2, the server is served over plain HTTP if nil.
 	Builder   *Builder
+
+	LegacyRoutes bool // LegacyRoutes keeps the verb paths of the Apps for compatibility, e.g. /api/posts/new.
 }
 
 // NewServer creates a new Server instance with the provided configuration.
@@ -49,6 +71,8 @@ type ServerConfig struct {
 // It checks for missing configuration (Host and Port) and returns an error if necessary.
 // Otherwise, it creates a new Gorilla Mux router, sets up the server address and handler,
 // and adds a basic logging middleware by default.
+//
+// If TLS is configured, the certificate is loaded and an error is returned if it's invalid.
 func NewServer(config *ServerConfig) (*Server, error) {
 
 	if config == nil {
@@ -67,40 +91,38 @@ func NewServer(config *ServerConfig) (*Server, error) {
 		config.CSRFToken = "secret"
 	}
 
-	r := mux.NewRouter()
-
 	svr := &Server{
 		Server: &http.Server{
-			Addr:    config.Host + ":" + config.Port,
-			Handler: r,
+			Addr: config.Host + ":" + config.Port,
 		},
-		Middlewares: []func(http.Handler) http.Handler{},
-		Routes:      []RouteHandler{},
-		Root:        r,
-		Builder:     config.Builder,
+		Middlewares:  []func(http.Handler) http.Handler{},
+		Routes:       []RouteHandler{},
+		Builder:      config.Builder,
+		LegacyRoutes: config.LegacyRoutes,
 	}
 
-	// CSRF
-	// csrfKey := []byte(config.CSRFToken) // Replace with a real secret key
-	// csrfMiddleware := csrf.Protect(csrfKey, csrf.CookieName("csrftoken"))
-
-	// Middlewares
+	if config.TLS != nil {
+		tlsConfig, err := newTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		svr.TLSConfig = tlsConfig
 
-	r.Use(CORS)
-	r.Use(LoggingMiddleware)
+		if config.TLS.RedirectPort != "" {
+			svr.redirect = newRedirectServer(config.Host+":"+config.TLS.RedirectPort, config.Port)
+		}
+	}
 
-	// r.Use(csrfMiddleware)
+	// The handler reads the current router on every request, so the router can be
+	// swapped by Reload while the server is running.
+	svr.Root = svr.newRouter()
+	svr.handler = svr.wrapRouter(svr.Root)
+	svr.Handler = http.HandlerFunc(svr.serveRoot)
 
 	// Public Routes
 	svr.AddRoute(
 		"/",
 		func(w http.ResponseWriter, r *http.Request) {
-			err := ValidateRequestMethod(r, "GET")
-			if err != nil {
-				SendJsonResponse(w, http.StatusMethodNotAllowed, err, err.Error())
-				return
-			}
-
 			SendJsonResponse(w, http.StatusOK, nil, "ok")
 		},
 		"healthz",
@@ -116,29 +138,32 @@ func NewServer(config *ServerConfig) (*Server, error) {
 //
 // It sets the following headers:
 //
-// - Access-Control-Allow-Headers: Content-Type, Authorization, Origin
-// - Access-Control-Allow-Methods: GET, POST, PUT, DELETE, OPTIONS
+// - Access-Control-Allow-Headers: Content-Type, Authorization, Origin, X-Request-ID, X-API-Key
+// - Access-Control-Expose-Headers: X-Request-ID and the rate limit headers
+// - Access-Control-Allow-Methods: GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS
 // - Access-Control-Allow-Origin: *
 //
 // It also checks the Origin header against the list of allowed origins
 // and returns a 403 Forbidden response if the origin is not allowed.
 //
-// If the request method is OPTIONS, it returns a 200 OK response immediately.
+// OPTIONS requests, e.g. preflight requests, are answered by the OPTIONS routes, see buildRouter.
+// The metrics are served without the checks, since Prometheus sends no Origin, see MetricsRoute.
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Origin")
+		if r.URL.Path == MetricsRoute {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Origin, "+RequestIDHeader+", "+APIKeyHeader)
+		w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader+", RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 
 		allowedOrigins := config.GetStringSlice(EnvKeys.CorsAllowedOrigins)
 		origin := r.Header.Get("Origin")
 
 		if allowedOrigins[0] == "*" || contains(allowedOrigins, origin) {
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
 		} else {
 			err := fmt.Errorf("origin '%s' is not allowed", origin)
 			log.Warn().Interface("headers", r.Header).Interface("allowedOrigins", allowedOrigins).Interface("origin", origin).Msg("CORS")
@@ -163,56 +188,359 @@ func contains(s []string, e string) bool {
 	return false
 }
 
-// LoggingMiddleware is a sample middleware function that logs the request URI.
+// newRouter creates a router with the base middlewares and no routes.
+func (s *Server) newRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// CSRF
+	// csrfKey := []byte(config.CSRFToken) // Replace with a real secret key
+	// csrfMiddleware := csrf.Protect(csrfKey, csrf.CookieName("csrftoken"))
+
+	// Middlewares
+
+	r.Use(recordRouteName)
+
+	// r.Use(csrfMiddleware)
+
+	return r
+}
+
+// wrapRouter wraps the given router in the router middlewares, so the requests that don't
+// match a route, e.g. 404 and 405, get an ID, an access log line and the CORS headers too,
+// and are counted by the metrics.
+func (s *Server) wrapRouter(root *mux.Router) http.Handler {
+	return chainMiddlewares(root, s.getRouterMiddlewares())
+}
+
+// getRouterMiddlewares returns the middlewares of every request, the first one runs first.
+// The metrics read the route from the request ID middleware, so they run after it.
+func (s *Server) getRouterMiddlewares() []Middleware {
+	middlewares := []Middleware{RequestIDMiddleware, LoggingMiddleware}
+	if s.Metrics != nil {
+		middlewares = append(middlewares, s.Metrics.MetricsMiddleware)
+	}
+	return append(middlewares, CORS)
+}
+
+// serveRoot passes the request to the current router.
+func (s *Server) serveRoot(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	handler := s.handler
+	s.mu.RUnlock()
+
+	handler.ServeHTTP(w, r)
+}
+
+// buildRouter creates a router with the given routes bound.
+//
+// Public routes are bound to the root, and routes that require authentication are
+// bound under /private, behind the authentication middleware.
 //
-// It takes an http.Handler as input and returns a new http.Handler that wraps the original
-// handler and logs the request URI before calling the original handler.
-func LoggingMiddleware(next http.Handler) http.Handler {
+// Routes only match their method, and the GET routes match HEAD too. Every path answers
+// OPTIONS with the methods it allows, without authentication so browsers can send preflight
+// requests, and requests with a method the path doesn't allow get a 405 with an Allow header.
+// Routes without a method match every method.
+func (s *Server) buildRouter(routes []RouteHandler) *mux.Router {
+	r := s.newRouter()
+
+	// Create separate routers for authenticated and public routes
+	authRouter := r.PathPrefix(privatePrefix).Subrouter()
+	publicRouter := r
+
+	// Apply authMiddleware only to the authenticated router
+	for _, middleware := range s.PreAuth {
+		authRouter.Use(middleware)
+	}
+	if s.Builder != nil {
+		authRouter.Use(s.Builder.AuthMiddleware)
+	}
+	for _, middleware := range s.Private {
+		authRouter.Use(middleware)
+	}
+
+	methods := newAllowedMethods()
+
+	for _, route := range routes {
+		if !route.RequiresAuth {
+			bindRoute(publicRouter, route)
+			methods.add(route.Route, route.Method)
+		}
+	}
+
+	for _, route := range routes {
+		if route.RequiresAuth {
+			bindRoute(authRouter, route)
+			methods.add(privatePrefix+route.Route, route.Method)
+		}
+	}
+
+	for _, path := range methods.paths {
+		if allow := methods.allow(path); allow != "" {
+			r.Path(path).Methods(http.MethodOptions).HandlerFunc(optionsHandler(allow))
+		}
+	}
+
+	r.MethodNotAllowedHandler = http.HandlerFunc(methods.methodNotAllowed)
+
+	return r
+}
+
+// bindRoute binds the route to the router, matching its method.
+func bindRoute(r *mux.Router, route RouteHandler) {
+	handler := chainMiddlewares(http.HandlerFunc(route.Handler), route.Middlewares)
+
+	switch route.Method {
+	case "":
+		r.Handle(route.Route, handler).Name(route.Name)
+	case http.MethodGet:
+		r.Handle(route.Route, headHandler(handler)).Methods(http.MethodGet, http.MethodHead).Name(route.Name)
+	default:
+		r.Handle(route.Route, handler).Methods(route.Method).Name(route.Name)
+	}
+}
+
+// headHandler passes HEAD requests to the handler as GET requests. The server discards
+// the body of the responses to HEAD requests.
+func headHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Info().Msg(r.RequestURI)
+		if r.Method == http.MethodHead {
+			r = r.Clone(r.Context())
+			r.Method = http.MethodGet
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// optionsHandler answers OPTIONS requests with the methods allowed by the path.
+func optionsHandler(allow string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowedMethods holds the methods allowed by each path of a router, in the order the
+// paths are bound.
+type allowedMethods struct {
+	paths    []string
+	methods  map[string][]string
+	matchers []*mux.Route // matchers match the paths only, to find the methods allowed by a request
+}
+
+// newAllowedMethods creates an empty allowedMethods.
+func newAllowedMethods() *allowedMethods {
+	return &allowedMethods{
+		paths:   make([]string, 0),
+		methods: make(map[string][]string),
+	}
+}
+
+// add records that the path allows the method. An empty method allows every method.
+func (m *allowedMethods) add(path string, method string) {
+	methods, ok := m.methods[path]
+	if !ok {
+		m.paths = append(m.paths, path)
+		m.matchers = append(m.matchers, mux.NewRouter().Path(path))
+	}
+
+	if method == "" {
+		method = "*"
+	}
+	m.methods[path] = append(methods, method)
+}
+
+// allow returns the value of the Allow header of the path, or an empty string if the
+// path allows every method.
+func (m *allowedMethods) allow(path string) string {
+	return formatAllowedMethods(m.methods[path])
+}
+
+// methodNotAllowed responds with a 405 and the methods allowed by the paths matching the request.
+func (m *allowedMethods) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	methods := make([]string, 0)
+	for i, matcher := range m.matchers {
+		if matcher.Match(r, &mux.RouteMatch{}) {
+			methods = append(methods, m.methods[m.paths[i]]...)
+		}
+	}
+
+	if allow := formatAllowedMethods(methods); allow != "" {
+		w.Header().Set("Allow", allow)
+	}
+
+	err := fmt.Errorf("invalid request method: %s", r.Method)
+	SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
+}
+
+// formatAllowedMethods returns the given methods as the value of an Allow header, adding
+// HEAD for GET and OPTIONS. It returns an empty string if any method is allowed.
+func formatAllowedMethods(methods []string) string {
+	allowed := make(map[string]bool)
+	for _, method := range methods {
+		if method == "*" {
+			return ""
+		}
+
+		allowed[method] = true
+		if method == http.MethodGet {
+			allowed[http.MethodHead] = true
+		}
+	}
+	allowed[http.MethodOptions] = true
+
+	// in a stable order, the usual order of the methods first
+	output := make([]string, 0, len(allowed))
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions} {
+		if allowed[method] {
+			output = append(output, method)
+			delete(allowed, method)
+		}
+	}
+	others := make([]string, 0, len(allowed))
+	for method := range allowed {
+		others = append(others, method)
+	}
+	sort.Strings(others)
+
+	return strings.Join(append(output, others...), ", ")
+}
+
+// Reload binds the registered routes to a new router and swaps it with the current one.
+//
+// Requests in flight finish on the previous router. Once Reload has been called, every
+// route added or removed rebuilds the router, so the changes are served right away. See
+// BeginUpdate to rebuild it once for several changes.
+func (s *Server) Reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reload()
+}
+
+// reload must be called with the lock held.
+func (s *Server) reload() {
+	s.Root = s.buildRouter(s.Routes)
+	s.handler = s.wrapRouter(s.Root)
+	s.live = true
+	s.pending = false
+}
+
+// changed rebuilds the router after the routes changed, unless an update is in progress, in
+// which case the router is rebuilt on Commit. It must be called with the lock held.
+func (s *Server) changed() {
+	s.version++
+	if !s.live {
+		return
+	}
+	if s.updates > 0 {
+		s.pending = true
+		return
+	}
+	s.reload()
+}
+
+// BeginUpdate defers rebuilding the router until Commit, so several routes can be added or
+// removed at once, and requests see all the changes or none of them.
+//
+// Example:
+//
+//	svr.BeginUpdate()
+//	defer svr.Commit()
+//	svr.AddRoute(...)
+//	svr.AddRoute(...)
+func (s *Server) BeginUpdate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updates++
+}
+
+// Commit ends an update started with BeginUpdate, and rebuilds the router once if the routes
+// changed. Updates can be nested, the router is rebuilt when the outermost one ends.
+func (s *Server) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.updates > 0 {
+		s.updates--
+	}
+	if s.updates == 0 && s.pending {
+		s.reload()
+	}
+}
+
 // Run starts the server and listens for incoming connections on the configured address.
 //
 // It logs a message indicating the server is running on the specified port,
 // applies all registered middleware to the server's handler,
-// and finally calls the underlying http.Server's ListenAndServe method.
+// and finally calls the underlying http.Server's ListenAndServe method, or ListenAndServeTLS
+// if TLS is configured, along with the HTTP to HTTPS redirect server if enabled.
 func (s *Server) Run() error {
 
 	// Include schema endpoint
 	s.Builder.Admin.AddApiRoute()
 
-	// Create separate routers for authenticated and public routes
-	authRouter := s.Root.PathPrefix("/private").Subrouter()
-	publicRouter := s.Root
+	// Include OpenAPI document and explorer
+	s.Builder.AddOpenAPIRoutes()
+
+	// Include GraphQL endpoint
+	s.Builder.Admin.AddGraphQLRoute()
+
+	s.Reload()
 
 	for _, middleware := range s.Middlewares {
 		s.Handler = middleware(s.Handler)
 	}
 
-	// Apply authMiddleware only to the authenticated router
-	authRouter.Use(s.Builder.AuthMiddleware)
+	routes := s.GetRoutes()
+
+	log.Info().Strs("middlewares", s.getGlobalMiddlewareChain()).Msg("Middlewares of every route")
 
 	log.Info().Msg("Public routes")
-	for _, route := range s.Routes {
+	for _, route := range routes {
 		if !route.RequiresAuth {
-			log.Info().Msgf("Route: %s", route.Route)
-			publicRouter.HandleFunc(route.Route, route.Handler).Name(route.Name)
+			log.Info().Strs("middlewares", s.GetMiddlewareChain(route)).Msgf("Route: %s %s", route.Method, route.Route)
 		}
 	}
 
 	log.Info().Msg("Authenticated routes")
-	for _, route := range s.Routes {
+	for _, route := range routes {
 		if route.RequiresAuth {
-			log.Info().Msgf("Route: /private%s", route.Route)
-			authRouter.HandleFunc(route.Route, route.Handler).Name(route.Name)
+			log.Info().Strs("middlewares", s.GetMiddlewareChain(route)).Msgf("Route: %s /private%s", route.Method, route.Route)
 		}
 	}
 
-	log.Info().Msgf("Running server on port %s", s.Addr)
-	return s.ListenAndServe()
+	if s.TLSConfig == nil {
+		log.Info().Msgf("Running server on port %s", s.Addr)
+		return s.ListenAndServe()
+	}
+
+	if s.redirect != nil {
+		go func() {
+			log.Info().Msgf("Redirecting HTTP requests on port %s to HTTPS", s.redirect.Addr)
+			err := s.redirect.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Error running redirect server")
+			}
+		}()
+	}
+
+	log.Info().Msgf("Running TLS server on port %s", s.Addr)
+	// the certificate is provided by the TLS config, see newTLSConfig
+	return s.ListenAndServeTLS("", "")
+}
+
+// Shutdown stops the server, and the redirect server if enabled, waiting for the requests
+// in flight until the context is done. See http.Server.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	errs := make([]error, 0)
+
+	if s.redirect != nil {
+		errs = append(errs, s.redirect.Shutdown(ctx))
+	}
+	errs = append(errs, s.Server.Shutdown(ctx))
+
+	return errors.Join(errs...)
 }
 
 // AddMiddleware adds a new middleware function to the server's middleware chain.
@@ -225,17 +553,40 @@ func (s *Server) AddMiddleware(middleware func(http.Handler) http.Handler) {
 	s.Middlewares = append(s.Middlewares, middleware)
 }
 
+// AddPreAuthMiddleware adds a middleware to the routes that require authentication, which
+// runs before the user is verified, e.g. to limit the requests of each IP.
+func (s *Server) AddPreAuthMiddleware(middleware Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PreAuth = append(s.PreAuth, middleware)
+	s.changed()
+}
+
+// AddPrivateMiddleware adds a middleware to the routes that require authentication, which
+// runs after the user is verified, e.g. to limit the requests of each user.
+func (s *Server) AddPrivateMiddleware(middleware Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Private = append(s.Private, middleware)
+	s.changed()
+}
+
 // HandlerFunc is the type of the function that can be used as an http.HandlerFunc.
 // It takes an http.ResponseWriter and an *http.Request as input and returns nothing.
 type HandlerFunc func(w http.ResponseWriter, r *http.Request)
 
-// AddRoute adds a new route to the server's routing table.
+// AddRoute adds a new route to the server's routing table. The route only matches the
+// given method, see buildRouter.
 //
 // It takes three arguments:
 //   - route: The path for the route (e.g., "/", "/users/{id}").
 //   - handler: The function to be called when the route is matched.
 //   - name: An optional name for the route (useful for generating URLs)
 //   - requiresAuth: A boolean flag indicating whether the route requires authentication
+//   - middlewares: The middlewares the route goes through, after the authentication. See Group
+//     to share them between routes.
 //
 // Example:
 //
@@ -245,8 +596,54 @@ type HandlerFunc func(w http.ResponseWriter, r *http.Request)
 //
 // url, err := r.Get("getUser").URL("id", "123") =>
 // "/users/123"
-func (s *Server) AddRoute(route string, handler HandlerFunc, name string, requiresAuth bool, method string, schema interface{}) {
-	s.Routes = append(s.Routes, NewRouteHandler(route, handler, name, requiresAuth, method, schema))
+func (s *Server) AddRoute(route string, handler HandlerFunc, name string, requiresAuth bool, method string, schema interface{}, middlewares ...Middleware) {
+	routeHandler := NewRouteHandler(route, handler, name, requiresAuth, method, schema)
+	routeHandler.Middlewares = middlewares
+	s.addRoute(routeHandler)
+}
+
+// AddLegacyRoute adds a route kept for compatibility, which is served but left out of the
+// API documents and clients. See AddRoute.
+func (s *Server) AddLegacyRoute(route string, handler HandlerFunc, name string, requiresAuth bool, method string, schema interface{}) {
+	routeHandler := NewRouteHandler(route, handler, name, requiresAuth, method, schema)
+	routeHandler.Legacy = true
+	s.addRoute(routeHandler)
+}
+
+// addRoute adds the given route to the server's routing table.
+func (s *Server) addRoute(route RouteHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Routes = append(s.Routes, route)
+	s.changed()
+}
+
+// RemoveRoutes removes the given route and all the routes under it, e.g. "/api/posts"
+// removes "/api/posts", "/api/posts/new" and "/api/posts/{id}", but not "/api/posts-archive".
+//
+// It returns the number of routes removed.
+func (s *Server) RemoveRoutes(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := strings.TrimSuffix(route, "/") + "/"
+
+	routes := make([]RouteHandler, 0, len(s.Routes))
+	for _, r := range s.Routes {
+		if r.Route == route || strings.HasPrefix(r.Route, prefix) {
+			continue
+		}
+		routes = append(routes, r)
+	}
+
+	removed := len(s.Routes) - len(routes)
+	s.Routes = routes
+	if removed > 0 {
+		s.changed()
+	}
+
+	return removed
 }
 
 // NewRouteHandler creates a new RouteHandler instance.
@@ -273,10 +670,24 @@ func NewRouteHandler(route string, handler HandlerFunc, name string, requiresAut
 	}
 }
 
+// routesVersion returns the number of times the routes changed. Registering or removing an
+// App changes its routes too.
+func (s *Server) routesVersion() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.version
+}
+
 // GetRoutes returns a slice of all registered routes.
 //
 // The slice is a shallow copy of the server's internal routes slice, so modifying
 // the slice or its elements will not affect the server's internal state.
 func (s *Server) GetRoutes() []RouteHandler {
-	return s.Routes
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routes := make([]RouteHandler, len(s.Routes))
+	copy(routes, s.Routes)
+	return routes
 }
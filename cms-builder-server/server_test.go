@@ -1,9 +1,12 @@
 package builder_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +32,104 @@ func TestNewServer_ValidConfig(t *testing.T) {
 	assert.NotNil(t, server.Root)
 	assert.NotNil(t, server.Middlewares)
 }
+
+// TestRuntimeRegistrationUpdatesRouting tests that apps registered and unregistered after the
+// routes are bound are served and stop being served without restarting the server.
+func TestRuntimeRegistrationUpdatesRouting(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	type RuntimeApp struct {
+		*builder.SystemData
+		Field string `json:"field"`
+	}
+
+	e.Server.Reload()
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		e.Server.Handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/api/runtime-apps/schema"), "Route should not exist before registering")
+
+	_, err = e.Admin.Register(RuntimeApp{}, false, builder.RolePermissionMap{})
+	assert.NoError(t, err, "Register should not return an error")
+	assert.Equal(t, http.StatusOK, serve("/api/runtime-apps/schema"), "Route should be served after registering")
+
+	err = e.Admin.Unregister("RuntimeApp")
+	assert.NoError(t, err, "Unregister should not return an error")
+	assert.Equal(t, http.StatusNotFound, serve("/api/runtime-apps/schema"), "Route should not be served after unregistering")
+
+	for _, route := range e.Server.GetRoutes() {
+		assert.NotContains(t, route.Route, "/api/runtime-apps", "Routes of the app should be removed")
+	}
+}
+
+// TestServerUpdate tests that the routes added during an update are served once it's committed.
+func TestServerUpdate(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+	server.Reload()
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		builder.SendJsonResponse(w, http.StatusOK, nil, "ok")
+	}
+
+	server.BeginUpdate()
+	server.AddRoute("/first", handler, "first", false, http.MethodGet, nil)
+	server.AddRoute("/second", handler, "second", false, http.MethodGet, nil)
+	assert.Equal(t, http.StatusNotFound, serve("/first"), "Routes should not be served during the update")
+
+	server.Commit()
+	assert.Equal(t, http.StatusOK, serve("/first"), "Routes should be served once the update is committed")
+	assert.Equal(t, http.StatusOK, serve("/second"), "Routes should be served once the update is committed")
+}
+
+// TestMethodRouting tests that routes only match their method, that GET routes answer HEAD,
+// and that the paths answer OPTIONS and wrong methods with the methods they allow.
+func TestMethodRouting(t *testing.T) {
+	server, err := builder.NewServer(&builder.ServerConfig{})
+	assert.NoError(t, err, "NewServer should not return an error")
+
+	handler := func(status int) builder.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			builder.SendJsonResponse(w, status, nil, r.Method)
+		}
+	}
+	server.AddRoute("/items", handler(http.StatusOK), "items-list", false, http.MethodGet, nil)
+	server.AddRoute("/items", handler(http.StatusCreated), "items-new", false, http.MethodPost, nil)
+	server.AddRoute("/items/{id}", handler(http.StatusOK), "items-update", false, http.MethodPut, nil)
+	server.Reload()
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/items").Code)
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/items").Code, "Routes of the same path should match their method")
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/items/1").Code)
+
+	head := serve(http.MethodHead, "/items")
+	assert.Equal(t, http.StatusOK, head.Code, "GET routes should answer HEAD")
+	assert.Contains(t, head.Body.String(), "GET", "HEAD requests should be handled as GET requests")
+
+	options := serve(http.MethodOptions, "/items")
+	assert.Equal(t, http.StatusNoContent, options.Code)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", options.Header().Get("Allow"))
+
+	notAllowed := serve(http.MethodDelete, "/items/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, notAllowed.Code)
+	assert.Equal(t, "PUT, OPTIONS", notAllowed.Header().Get("Allow"))
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/missing").Code)
+}
@@ -0,0 +1,307 @@
+package builder
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters that are not decomposed by unicode normalization
+var slugTransliterations = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'Æ': "ae",
+	'ø': "o",
+	'Ø': "o",
+	'œ': "oe",
+	'Œ': "oe",
+	'đ': "d",
+	'Đ': "d",
+	'ł': "l",
+	'Ł': "l",
+	'þ': "th",
+	'Þ': "th",
+	'&': " and ",
+}
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SlugConfig defines how the slug of an App is generated.
+type SlugConfig struct {
+	Field       string // JSON name of the field where the slug is stored
+	SourceField string // JSON name of the field the slug is generated from
+	KeepHistory bool   // Whether previous slugs keep resolving to the record
+}
+
+// SlugHistory stores a previous slug of a record, so old URLs keep resolving.
+type SlugHistory struct {
+	*SystemData
+	ResourceName string `gorm:"index:idx_slug_history" json:"resourceName"`
+	ResourceId   string `json:"resourceId"`
+	Slug         string `gorm:"index:idx_slug_history" json:"slug"`
+}
+
+// Slugify converts the given text into a URL friendly slug.
+//
+// Accents are removed, letters are lowercased and every sequence of characters
+// that are not letters or digits is replaced by a single dash.
+//
+// For example, "Crème Brûlée & Co." becomes "creme-brulee-and-co".
+func Slugify(text string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if replacement, ok := slugTransliterations[r]; ok {
+			sb.WriteString(replacement)
+			continue
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	slug := slugInvalidChars.ReplaceAllString(sb.String(), "-")
+	return strings.Trim(slug, "-")
+}
+
+// RegisterSlugField declares the field where the slug of the App is stored, and the field
+// it is generated from when a record is created.
+//
+// Parameters:
+// - field: the name of the field that stores the slug.
+// - sourceField: the name of the field the slug is generated from.
+// - keepHistory: whether previous slugs keep resolving to the record after it changes.
+//
+// Returns:
+// - error: an error if any of the fields is not found in the model or is not a string.
+func (a *App) RegisterSlugField(field FieldName, sourceField FieldName, keepHistory bool) error {
+	for _, name := range []FieldName{field, sourceField} {
+		structField, err := GetStructFieldByJsonName(a.Model, name.S())
+		if err != nil {
+			return err
+		}
+		if structField.Type.Kind() != reflect.String {
+			return fmt.Errorf("field %s must be a string", name)
+		}
+	}
+
+	if a.Slug == nil {
+		a.Slug = &SlugConfig{}
+	}
+
+	*a.Slug = SlugConfig{
+		Field:       field.S(),
+		SourceField: sourceField.S(),
+		KeepHistory: keepHistory,
+	}
+
+	return nil
+}
+
+// HasSlug returns true if the App has a slug field.
+func (a *App) HasSlug() bool {
+	return a.Slug != nil && a.Slug.Field != ""
+}
+
+// GetSlug returns the slug of the given instance, or an empty string if the App has no slug field.
+func (a *App) GetSlug(instance interface{}) string {
+	if !a.HasSlug() {
+		return ""
+	}
+
+	value, err := GetFieldValueByJsonName(instance, a.Slug.Field)
+	if err != nil {
+		return ""
+	}
+
+	return value.String()
+}
+
+// isSlugTaken returns true if the slug is used by another record of the App, either as its
+// current slug or in its slug history.
+func (a *App) isSlugTaken(db *Database, slug string, instanceId string) (bool, error) {
+	column, err := db.GetColumnName(a.Model, a.Slug.Field)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	q := db.DB.Model(CreateInstanceForUndeterminedType(a.Model)).Where(column+" = ?", slug)
+	if instanceId != "" {
+		q = q.Where("id <> ?", instanceId)
+	}
+	err = q.Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	q = db.DB.Model(&SlugHistory{}).Where("resource_name = ? AND slug = ?", a.Name(), slug)
+	if instanceId != "" {
+		q = q.Where("resource_id <> ?", instanceId)
+	}
+	err = q.Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GenerateUniqueSlug returns a slug for the given text that is not used by any other record
+// of the App. If the slug is taken, a numeric suffix is added, e.g. "my-post-2".
+//
+// Parameters:
+//   - db: the database to check the slug against.
+//   - text: the text to generate the slug from.
+//   - instanceId: the ID of the record the slug is for, or an empty string for new records.
+func (a *App) GenerateUniqueSlug(db *Database, text string, instanceId string) (string, error) {
+	base := Slugify(text)
+	if base == "" {
+		base = SnakeCase(a.Name())
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := a.isSlugTaken(db, slug, instanceId)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// PrepareSlug sets the slug of the given instance before it is saved.
+//
+// If the slug is empty it is generated from the source field, otherwise the provided
+// slug is normalized. In both cases a suffix is added if another record uses it.
+// It does nothing if the App has no slug field.
+func (a *App) PrepareSlug(db *Database, instance interface{}, instanceId string) error {
+	if !a.HasSlug() {
+		return nil
+	}
+
+	slugValue, err := GetFieldValueByJsonName(instance, a.Slug.Field)
+	if err != nil {
+		return err
+	}
+
+	text := slugValue.String()
+	if text == "" {
+		sourceValue, err := GetFieldValueByJsonName(instance, a.Slug.SourceField)
+		if err != nil {
+			return err
+		}
+		text = sourceValue.String()
+	}
+
+	slug, err := a.GenerateUniqueSlug(db, text, instanceId)
+	if err != nil {
+		return err
+	}
+
+	slugValue.SetString(slug)
+	return nil
+}
+
+// SaveSlugHistory stores the previous slug of a record if it changed and the App keeps slug history.
+func (a *App) SaveSlugHistory(db *Database, instanceId string, previousSlug string, currentSlug string, user *User) error {
+	if !a.HasSlug() || !a.Slug.KeepHistory || previousSlug == "" || previousSlug == currentSlug {
+		return nil
+	}
+
+	entry := SlugHistory{
+		SystemData: &SystemData{
+			CreatedByID: user.ID,
+			UpdatedByID: user.ID,
+		},
+		ResourceName: a.Name(),
+		ResourceId:   instanceId,
+		Slug:         previousSlug,
+	}
+
+	return db.Create(&entry, user).Error
+}
+
+// FindIdBySlug returns the ID of the record of the App with the given slug.
+//
+// The current slug of the records is checked first, then the slug history if the App keeps it.
+// It returns an empty string if no record is found.
+func (a *App) FindIdBySlug(db *Database, slug string) (string, error) {
+	if !a.HasSlug() {
+		return "", fmt.Errorf("%s has no slug field", a.Name())
+	}
+
+	column, err := db.GetColumnName(a.Model, a.Slug.Field)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []uint
+	err = db.DB.Model(CreateInstanceForUndeterminedType(a.Model)).
+		Where(column+" = ?", slug).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return "", err
+	}
+	if len(ids) > 0 {
+		return fmt.Sprint(ids[0]), nil
+	}
+
+	if !a.Slug.KeepHistory {
+		return "", nil
+	}
+
+	var entry SlugHistory
+	res := db.DB.Where("resource_name = ? AND slug = ?", a.Name(), slug).Order("id desc").Limit(1).Find(&entry)
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", nil
+	}
+
+	return entry.ResourceId, nil
+}
+
+// ApiDetailBySlug returns a handler function that responds to GET requests on the
+// by-slug endpoint, e.g. /api/posts/by-slug/{slug}.
+//
+// The slug is resolved to a record ID and the request is passed to the detail handler,
+// so the same permissions and ownership rules apply.
+func (a *App) ApiDetailBySlug(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.HasSlug() {
+			SendJsonResponse(w, http.StatusNotFound, nil, a.Name()+" has no slug field")
+			return
+		}
+
+		slug := GetUrlParam("slug", r)
+		instanceId, err := a.FindIdBySlug(db, slug)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		if instanceId == "" {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		request := mux.SetURLVars(r, map[string]string{"id": instanceId})
+		a.ApiDetail(db)(w, request)
+	}
+}
@@ -0,0 +1,91 @@
+package builder_test
+
+import (
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Hello World", "hello-world"},
+		{"  Crème Brûlée & Co.  ", "creme-brulee-and-co"},
+		{"Straße über Æble", "strasse-uber-aeble"},
+		{"Año 2024: ¡Feliz!", "ano-2024-feliz"},
+		{"---", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.want, builder.Slugify(tt.input))
+		})
+	}
+}
+
+type SluggedStruct struct {
+	*builder.SystemData
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+// TestSlugIsGeneratedOnCreate tests that slugs are generated from the source field, made unique,
+// and that records can be retrieved by their current and previous slugs.
+func TestSlugIsGeneratedOnCreate(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	permissions := builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	}
+
+	app, err := e.Admin.Register(SluggedStruct{}, false, permissions)
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.RegisterSlugField("slug", "title", true)
+	assert.NoError(t, err, "RegisterSlugField should not return an error")
+
+	t.Log("Creating two records with the same title")
+	request, user, userRollback := th.NewRequest(http.MethodPost, `{"title": "Hello Wörld"}`, true, nil, nil)
+	defer userRollback()
+
+	var first SluggedStruct
+	_, err = th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &first)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+
+	request, _, _ = th.NewRequest(http.MethodPost, `{"title": "Hello Wörld"}`, true, user, nil)
+	var second SluggedStruct
+	_, err = th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &second)
+	assert.NoError(t, err, "ApiCreate should not return an error")
+
+	assert.Equal(t, "hello-world", first.Slug[:len("hello-world")], "Slug should be generated from the title")
+	assert.NotEqual(t, first.Slug, second.Slug, "Slugs should be unique")
+
+	t.Log("Changing the slug of the first record")
+	request, _, _ = th.NewRequest(
+		http.MethodPut,
+		`{"slug": "New Slug `+first.GetIDString()+`"}`,
+		true,
+		user,
+		map[string]string{"id": first.GetIDString()},
+	)
+	var updated SluggedStruct
+	_, err = th.ExecuteApiCall(t, app.ApiUpdate(e.DB), request, &updated)
+	assert.NoError(t, err, "ApiUpdate should not return an error")
+	assert.Equal(t, "new-slug-"+first.GetIDString(), updated.Slug, "Slug should be normalized")
+
+	for _, slug := range []string{updated.Slug, first.Slug} {
+		request, _, _ = th.NewRequest(http.MethodGet, "", true, user, map[string]string{"slug": slug})
+
+		var result SluggedStruct
+		_, err = th.ExecuteApiCall(t, app.ApiDetailBySlug(e.DB), request, &result)
+		assert.NoError(t, err, "ApiDetailBySlug should not return an error")
+		assert.Equal(t, first.ID, result.ID, "Slug "+slug+" should resolve to the first record")
+	}
+}
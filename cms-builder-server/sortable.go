@@ -0,0 +1,473 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// SortableConfig defines the field that stores the manual order of the records of an App.
+type SortableConfig struct {
+	Field      string // JSON name of the integer field that stores the position
+	GroupField string // JSON name of the field records are ordered within, e.g. parentId, empty to order all records together
+}
+
+// ReorderInput is the body of the reorder requests.
+//
+// Either IDs are given, and the records are sorted in that order in the positions they
+// already take, or a record is moved before or after another one of the same group.
+type ReorderInput struct {
+	IDs    []uint `json:"ids"`
+	ID     uint   `json:"id"`
+	Before *uint  `json:"before"`
+	After  *uint  `json:"after"`
+}
+
+// SortPosition is the position of a record after it is reordered.
+type SortPosition struct {
+	ID       uint `json:"id"`
+	Position int  `json:"position"`
+}
+
+// sortableRow is the position and group of a record.
+type sortableRow struct {
+	ID       uint
+	Position int
+	Group    interface{}
+}
+
+// EnableSorting lets the records of the App be ordered manually. Records are added at the
+// end of their group, lists are ordered by position by default and they can be reordered
+// with the reorder endpoint, e.g. /api/faqs/reorder.
+//
+// Parameters:
+// - field: the name of the integer field that stores the position.
+// - groupField: the name of the field records are ordered within, e.g. parentId, or empty.
+//
+// Returns:
+// - error: an error if the fields are not found in the model or the position is not an integer.
+func (a *App) EnableSorting(field FieldName, groupField FieldName) error {
+	structField, err := GetStructFieldByJsonName(a.Model, field.S())
+	if err != nil {
+		return err
+	}
+
+	switch structField.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return fmt.Errorf("field %s must be an integer", field)
+	}
+
+	if groupField != "" {
+		_, err = GetStructFieldByJsonName(a.Model, groupField.S())
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Sortable == nil {
+		a.Sortable = &SortableConfig{}
+	}
+
+	*a.Sortable = SortableConfig{
+		Field:      field.S(),
+		GroupField: groupField.S(),
+	}
+
+	return nil
+}
+
+// IsSortable returns true if the records of the App can be ordered manually.
+func (a *App) IsSortable() bool {
+	return a.Sortable != nil && a.Sortable.Field != ""
+}
+
+// getSortableColumns returns the columns of the position and the group fields.
+func (a *App) getSortableColumns(db *Database) (string, string, error) {
+	positionColumn, err := db.GetColumnName(a.Model, a.Sortable.Field)
+	if err != nil {
+		return "", "", err
+	}
+
+	if a.Sortable.GroupField == "" {
+		return positionColumn, "", nil
+	}
+
+	groupColumn, err := db.GetColumnName(a.Model, a.Sortable.GroupField)
+	if err != nil {
+		return "", "", err
+	}
+
+	return positionColumn, groupColumn, nil
+}
+
+// getSortableOrder returns the order of the records by their group and position.
+func (a *App) getSortableOrder(db *Database) (string, error) {
+	positionColumn, groupColumn, err := a.getSortableColumns(db)
+	if err != nil {
+		return "", err
+	}
+
+	if groupColumn == "" {
+		return positionColumn + ",id", nil
+	}
+
+	return groupColumn + "," + positionColumn + ",id", nil
+}
+
+// getSortableRows returns the position and group of the records matching the given scopes,
+// ordered by position.
+func (a *App) getSortableRows(tx *gorm.DB, positionColumn string, groupColumn string, scopes ...func(*gorm.DB) *gorm.DB) ([]sortableRow, error) {
+	columns := []string{"id", positionColumn}
+	if groupColumn != "" {
+		columns = append(columns, groupColumn)
+	}
+
+	rows, err := tx.Model(a.Model).
+		Select(columns).
+		Scopes(scopes...).
+		Order(positionColumn + " asc, id asc").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	output := make([]sortableRow, 0)
+	for rows.Next() {
+		var row sortableRow
+		dest := []interface{}{&row.ID, &row.Position}
+		if groupColumn != "" {
+			dest = append(dest, &row.Group)
+		}
+
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		// drivers can return text as bytes, which can't be compared
+		if b, ok := row.Group.([]byte); ok {
+			row.Group = string(b)
+		}
+
+		output = append(output, row)
+	}
+
+	return output, rows.Err()
+}
+
+// inGroup returns a scope that matches the records of the given group.
+func inGroup(groupColumn string, group interface{}) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if groupColumn == "" {
+			return tx
+		}
+		if group == nil {
+			return tx.Where(groupColumn + " IS NULL")
+		}
+		return tx.Where(groupColumn+" = ?", group)
+	}
+}
+
+// sameGroup returns true if the given group values are equal.
+func sameGroup(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// PreparePosition sets the position of a new record, or of a record moved to another group,
+// to the end of its group. Positions that are set in the request are kept on new records.
+//
+// Parameters:
+// - db: the database to query.
+// - instance: the record.
+// - moved: whether the record is an existing record that changed its group.
+func (a *App) PreparePosition(db *Database, instance interface{}, moved bool) error {
+	if !a.IsSortable() {
+		return nil
+	}
+
+	positionValue, err := GetFieldValueByJsonName(instance, a.Sortable.Field)
+	if err != nil {
+		return err
+	}
+
+	if !moved && !positionValue.IsZero() {
+		return nil
+	}
+
+	positionColumn, groupColumn, err := a.getSortableColumns(db)
+	if err != nil {
+		return err
+	}
+
+	var group interface{}
+	if groupColumn != "" {
+		group, err = a.GetGroup(instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	var last *int
+	err = db.DB.Model(a.Model).
+		Scopes(inGroup(groupColumn, group)).
+		Select("MAX(" + positionColumn + ")").
+		Scan(&last).Error
+	if err != nil {
+		return err
+	}
+
+	position := 1
+	if last != nil {
+		position = *last + 1
+	}
+
+	switch positionValue.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		positionValue.SetUint(uint64(position))
+	default:
+		positionValue.SetInt(int64(position))
+	}
+
+	return nil
+}
+
+// GetGroup returns the value of the group field of the given instance, nil if it is a nil pointer
+// or the App has no group field.
+func (a *App) GetGroup(instance interface{}) (interface{}, error) {
+	if !a.IsSortable() || a.Sortable.GroupField == "" {
+		return nil, nil
+	}
+
+	value, err := GetFieldValueByJsonName(instance, a.Sortable.GroupField)
+	if err != nil {
+		return nil, err
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+
+	return value.Interface(), nil
+}
+
+// Reorder sorts the records of the App as requested in the input and renumbers the positions
+// of their group from 1, in a transaction.
+//
+// Parameters:
+//   - db: the database to update.
+//   - input: the ordered IDs, or the record to move before or after another one.
+//   - query: a condition the records in the input must match, e.g. to check they belong to the user.
+//
+// Returns:
+//   - []SortPosition: the positions of the records of the group.
+//   - error: an error if the input is invalid, the records are not found or belong to different groups.
+func (a *App) Reorder(db *Database, input ReorderInput, query string) ([]SortPosition, error) {
+	if !a.IsSortable() {
+		return nil, fmt.Errorf("%s is not sortable", a.Name())
+	}
+
+	positionColumn, groupColumn, err := a.getSortableColumns(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := input.IDs
+	if len(ids) == 0 {
+		if input.ID == 0 || (input.Before == nil) == (input.After == nil) {
+			return nil, fmt.Errorf("either ids, or id with before or after, are required")
+		}
+
+		target := input.Before
+		if target == nil {
+			target = input.After
+		}
+		if *target == input.ID {
+			return nil, fmt.Errorf("a record can't be moved next to itself")
+		}
+
+		ids = []uint{input.ID, *target}
+	}
+
+	seen := make(map[uint]bool)
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fmt.Errorf("record %d is duplicated", id)
+		}
+		seen[id] = true
+	}
+
+	output := make([]SortPosition, 0)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		rows, err := a.getSortableRows(tx, positionColumn, groupColumn, func(q *gorm.DB) *gorm.DB {
+			q = q.Where("id IN ?", ids)
+			if query != "" {
+				q = q.Where(query)
+			}
+			return q
+		})
+		if err != nil {
+			return err
+		}
+		if len(rows) != len(ids) {
+			return fmt.Errorf("records not found")
+		}
+
+		group := rows[0].Group
+		for _, row := range rows {
+			if !sameGroup(row.Group, group) {
+				return fmt.Errorf("records belong to different groups")
+			}
+		}
+
+		groupRows, err := a.getSortableRows(tx, positionColumn, groupColumn, inGroup(groupColumn, group))
+		if err != nil {
+			return err
+		}
+
+		order := make([]uint, 0, len(groupRows))
+		for _, row := range groupRows {
+			order = append(order, row.ID)
+		}
+
+		if len(input.IDs) > 0 {
+			order = placeInOrder(order, input.IDs)
+		} else {
+			order = moveInOrder(order, input.ID, input.Before, input.After)
+		}
+
+		for i, id := range order {
+			position := i + 1
+			output = append(output, SortPosition{ID: id, Position: position})
+
+			// only the records whose position changed are written
+			if groupRows[indexOfRow(groupRows, id)].Position == position {
+				continue
+			}
+
+			err = tx.Model(a.Model).Where("id = ?", id).UpdateColumn(positionColumn, position).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// placeInOrder sorts the given IDs in the slots they take in the order, leaving the rest in place.
+func placeInOrder(order []uint, ids []uint) []uint {
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	slots := make([]int, 0, len(ids))
+	for i, id := range order {
+		if wanted[id] {
+			slots = append(slots, i)
+		}
+	}
+	sort.Ints(slots)
+
+	output := append([]uint{}, order...)
+	for i, slot := range slots {
+		output[slot] = ids[i]
+	}
+	return output
+}
+
+// moveInOrder moves the given ID before or after the target.
+func moveInOrder(order []uint, id uint, before *uint, after *uint) []uint {
+	output := make([]uint, 0, len(order))
+	for _, current := range order {
+		if current != id {
+			output = append(output, current)
+		}
+	}
+
+	for i, current := range output {
+		if before != nil && current == *before {
+			return append(output[:i], append([]uint{id}, output[i:]...)...)
+		}
+		if after != nil && current == *after {
+			return append(output[:i+1], append([]uint{id}, output[i+1:]...)...)
+		}
+	}
+
+	return append(output, id)
+}
+
+// indexOfRow returns the index of the row with the given ID, or -1.
+func indexOfRow(rows []sortableRow, id uint) int {
+	for i, row := range rows {
+		if row.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApiReorder returns a handler function that responds to POST requests on the
+// reorder endpoint, e.g. /api/faqs/reorder.
+//
+// Users need update permission, and unless they are admins, the records they reorder must be theirs.
+// The response holds the positions of the records of the group after the change.
+func (a *App) ApiReorder(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.IsSortable() {
+			SendJsonResponse(w, http.StatusNotFound, nil, a.Name()+" is not sortable")
+			return
+		}
+
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationUpdate)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to update this resource")
+			return
+		}
+
+		body, err := ReadRequestBody(r)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		var input ReorderInput
+		err = json.Unmarshal(body, &input)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		query := ""
+		if !a.SkipUserBinding && !params.IsAdmin() {
+			query = "created_by_id = '" + params.RequestedById + "'"
+		}
+
+		positions, err := a.Reorder(db, input, query)
+		if err != nil {
+			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, positions, a.Name()+" reordered")
+	}
+}
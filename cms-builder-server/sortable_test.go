@@ -0,0 +1,77 @@
+package builder_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSortableStruct struct {
+	*builder.SystemData
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// TestReorder tests that new records are added at the end, that they can be reordered and
+// that lists are ordered by position.
+func TestReorder(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockSortableStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.EnableSorting("position", "")
+	assert.NoError(t, err, "EnableSorting should not return an error")
+
+	_, user, rollback := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollback()
+
+	t.Log("Creating three records")
+	ids := make([]uint, 0)
+	for i, name := range []string{"first", "second", "third"} {
+		request, _, _ := th.NewRequest(http.MethodPost, fmt.Sprintf(`{"name": "%s"}`, name), true, user, nil)
+
+		var record MockSortableStruct
+		response, err := th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &record)
+		assert.NoError(t, err, "ApiCreate should not return an error")
+		assert.True(t, response.Success, "ApiCreate should return a success response")
+		assert.Equal(t, i+1, record.Position, "Record should be added at the end")
+
+		ids = append(ids, record.ID)
+	}
+
+	t.Log("Moving the third record before the first one")
+	body := fmt.Sprintf(`{"id": %d, "before": %d}`, ids[2], ids[0])
+	request, _, _ := th.NewRequest(http.MethodPost, body, true, user, nil)
+
+	var positions []builder.SortPosition
+	response, err := th.ExecuteApiCall(t, app.ApiReorder(e.DB), request, &positions)
+	assert.NoError(t, err, "ApiReorder should not return an error")
+	assert.True(t, response.Success, "ApiReorder should return a success response")
+
+	t.Log("Listing the records")
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, nil)
+
+	var result []MockSortableStruct
+	_, err = th.ExecuteApiCall(t, app.ApiList(e.DB), request, &result)
+	assert.NoError(t, err, "ApiList should not return an error")
+	assert.Equal(t, 3, len(result), "List should contain the three records")
+	assert.Equal(t, []string{"third", "first", "second"}, []string{result[0].Name, result[1].Name, result[2].Name}, "List should be ordered by position")
+
+	t.Log("Other users can't reorder the records")
+	body = fmt.Sprintf(`{"ids": [%d, %d]}`, ids[1], ids[0])
+	request, _, otherRollback := th.NewRequest(http.MethodPost, body, true, nil, nil)
+	defer otherRollback()
+
+	response, err = th.ExecuteApiCall(t, app.ApiReorder(e.DB), request, nil)
+	assert.NoError(t, err, "ApiReorder should not return an error")
+	assert.False(t, response.Success, "ApiReorder should fail for other users")
+}
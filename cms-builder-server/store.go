@@ -35,6 +35,17 @@ type Store interface {
 	GetFileInfo(file *FileData) (*FileInfo, error)
 }
 
+// getStoreType returns the type of the given store, or "custom" for the stores of other packages.
+func getStoreType(store Store) string {
+	switch store.(type) {
+	case *LocalStore:
+		return string(StoreLocal)
+	case *S3Store:
+		return string(StoreS3)
+	}
+	return "custom"
+}
+
 type LocalStore struct {
 	Path string
 }
@@ -275,12 +286,6 @@ func NewS3Store(folder string) (*S3Store, error) {
 func (b *Builder) ListStoredFilesHandler(cfg *UploaderConfig) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		err := ValidateRequestMethod(r, http.MethodGet)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, err, err.Error())
-			return
-		}
-
 		files, err := b.Store.ListFiles()
 		if err != nil {
 			log.Error().Err(err).Msg("Error deleting file")
@@ -0,0 +1,609 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrCategoryHasChildren is returned when deleting a category that has subcategories, which
+// have to be deleted or moved first.
+var ErrCategoryHasChildren = errors.New("category has subcategories")
+
+// TaxonomyConfig defines whether the records of an App can be tagged and categorized.
+type TaxonomyConfig struct {
+	Tags       bool
+	Categories bool
+}
+
+// Tag is a flat term used to label records of any App with tags enabled.
+type Tag struct {
+	*SystemData
+	Name string `json:"name"`
+	Slug string `gorm:"index" json:"slug"`
+}
+
+// Category is a hierarchical term used to classify records of any App with categories enabled.
+type Category struct {
+	*SystemData
+	Name     string `json:"name"`
+	Slug     string `gorm:"index" json:"slug"`
+	ParentID *uint  `json:"parentId"`
+}
+
+// ResourceTag links a record of an App to a Tag.
+type ResourceTag struct {
+	ID           uint   `gorm:"primaryKey" json:"ID"`
+	ResourceName string `gorm:"index:idx_resource_tag" json:"resourceName"`
+	ResourceId   string `gorm:"index:idx_resource_tag" json:"resourceId"`
+	TagID        uint   `gorm:"index" json:"tagId"`
+}
+
+// ResourceCategory links a record of an App to a Category.
+type ResourceCategory struct {
+	ID           uint   `gorm:"primaryKey" json:"ID"`
+	ResourceName string `gorm:"index:idx_resource_category" json:"resourceName"`
+	ResourceId   string `gorm:"index:idx_resource_category" json:"resourceId"`
+	CategoryID   uint   `gorm:"index" json:"categoryId"`
+}
+
+// CategoryNode is a category together with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// TagUsage is the number of records labeled with a tag.
+type TagUsage struct {
+	Tag   Tag   `json:"tag"`
+	Count int64 `json:"count"`
+}
+
+// BeforeSave prevents a category from being moved under itself or one of its descendants.
+func (c *Category) BeforeSave(tx *gorm.DB) error {
+	if c.ParentID == nil {
+		return nil
+	}
+
+	var id uint
+	if c.SystemData != nil {
+		id = c.ID
+	}
+
+	visited := make(map[uint]bool)
+	parentId := *c.ParentID
+	for {
+		if id != 0 && parentId == id {
+			return fmt.Errorf("category can't be a descendant of itself")
+		}
+		if visited[parentId] {
+			return fmt.Errorf("categories have a cycle")
+		}
+		visited[parentId] = true
+
+		var parent Category
+		res := tx.Session(&gorm.Session{NewDB: true}).
+			Select("id", "parent_id").
+			Where("id = ?", parentId).
+			Limit(1).
+			Find(&parent)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("parent category %d not found", parentId)
+		}
+		if parent.ParentID == nil {
+			return nil
+		}
+		parentId = *parent.ParentID
+	}
+}
+
+// BeforeDelete removes the links of the tag to the records.
+func (t *Tag) BeforeDelete(tx *gorm.DB) error {
+	if t.SystemData == nil || t.ID == 0 {
+		return nil
+	}
+
+	return tx.Session(&gorm.Session{NewDB: true}).Where("tag_id = ?", t.ID).Delete(&ResourceTag{}).Error
+}
+
+// BeforeDelete prevents a category with subcategories from being deleted, so they are not left
+// with a missing parent, and removes the links of the category to the records.
+func (c *Category) BeforeDelete(tx *gorm.DB) error {
+	if c.SystemData == nil || c.ID == 0 {
+		return nil
+	}
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+
+	var children int64
+	err := db.Model(&Category{}).Where("parent_id = ?", c.ID).Count(&children).Error
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrCategoryHasChildren
+	}
+
+	return db.Where("category_id = ?", c.ID).Delete(&ResourceCategory{}).Error
+}
+
+// EnableTags allows the records of the App to be labeled with tags and filtered with ?tag=.
+func (a *App) EnableTags() {
+	if a.Taxonomy == nil {
+		a.Taxonomy = &TaxonomyConfig{}
+	}
+	a.Taxonomy.Tags = true
+}
+
+// EnableCategories allows the records of the App to be classified in categories and filtered
+// with ?category=, which includes the records of the descendant categories.
+func (a *App) EnableCategories() {
+	if a.Taxonomy == nil {
+		a.Taxonomy = &TaxonomyConfig{}
+	}
+	a.Taxonomy.Categories = true
+}
+
+// HasTags returns true if the records of the App can be tagged.
+func (a *App) HasTags() bool {
+	return a.Taxonomy != nil && a.Taxonomy.Tags
+}
+
+// HasCategories returns true if the records of the App can be categorized.
+func (a *App) HasCategories() bool {
+	return a.Taxonomy != nil && a.Taxonomy.Categories
+}
+
+// findTermIds returns the IDs of the terms of the given model matching the given values,
+// which can be IDs or slugs.
+func findTermIds(db *Database, model interface{}, values []string) ([]uint, error) {
+	ids := make([]uint, 0)
+	slugs := make([]string, 0)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		} else {
+			slugs = append(slugs, value)
+		}
+	}
+
+	output := make([]uint, 0)
+	if len(ids) == 0 && len(slugs) == 0 {
+		return output, nil
+	}
+
+	q := db.DB.Model(model)
+	switch {
+	case len(ids) > 0 && len(slugs) > 0:
+		q = q.Where("id IN ? OR slug IN ?", ids, slugs)
+	case len(ids) > 0:
+		q = q.Where("id IN ?", ids)
+	default:
+		q = q.Where("slug IN ?", slugs)
+	}
+
+	err := q.Pluck("id", &output).Error
+	return output, err
+}
+
+// GetCategoryDescendants returns the IDs of the given categories and all their descendants.
+func GetCategoryDescendants(db *Database, ids []uint) ([]uint, error) {
+	var categories []Category
+	err := db.DB.Select("id", "parent_id").Find(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	output := make([]uint, 0)
+	visited := make(map[uint]bool)
+	pending := append([]uint{}, ids...)
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		output = append(output, id)
+		pending = append(pending, children[id]...)
+	}
+
+	return output, nil
+}
+
+// TaxonomyFilter returns the query that filters the records of the App by the ?tag= and
+// ?category= parameters of the request, with the values of its placeholders, or an empty
+// string if there is nothing to filter.
+//
+// Both parameters accept a comma-separated list of IDs or slugs, and match records with any
+// of them. Categories include their descendants.
+func (a *App) TaxonomyFilter(db *Database, r *http.Request) (string, []interface{}, error) {
+	queries := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if tagParam := GetQueryParam("tag", r); tagParam != "" && a.HasTags() {
+		tagIds, err := findTermIds(db, &Tag{}, strings.Split(tagParam, ","))
+		if err != nil {
+			return "", nil, err
+		}
+
+		queries = append(queries, "id IN (?)")
+		args = append(args, db.DB.Model(&ResourceTag{}).
+			Select("CAST(resource_id AS BIGINT)").
+			Where("resource_name = ? AND tag_id IN ?", a.Name(), tagIds))
+	}
+
+	if categoryParam := GetQueryParam("category", r); categoryParam != "" && a.HasCategories() {
+		categoryIds, err := findTermIds(db, &Category{}, strings.Split(categoryParam, ","))
+		if err != nil {
+			return "", nil, err
+		}
+
+		categoryIds, err = GetCategoryDescendants(db, categoryIds)
+		if err != nil {
+			return "", nil, err
+		}
+
+		queries = append(queries, "id IN (?)")
+		args = append(args, db.DB.Model(&ResourceCategory{}).
+			Select("CAST(resource_id AS BIGINT)").
+			Where("resource_name = ? AND category_id IN ?", a.Name(), categoryIds))
+	}
+
+	return JoinQueries(queries...), args, nil
+}
+
+// GetTags returns the tags of the given record of the App.
+func (a *App) GetTags(db *Database, instanceId string) ([]Tag, error) {
+	tags := make([]Tag, 0)
+	err := db.DB.
+		Where("id IN (?)", db.DB.Model(&ResourceTag{}).
+			Select("tag_id").
+			Where("resource_name = ? AND resource_id = ?", a.Name(), instanceId)).
+		Order("name asc").
+		Find(&tags).Error
+	return tags, err
+}
+
+// GetCategories returns the categories of the given record of the App.
+func (a *App) GetCategories(db *Database, instanceId string) ([]Category, error) {
+	categories := make([]Category, 0)
+	err := db.DB.
+		Where("id IN (?)", db.DB.Model(&ResourceCategory{}).
+			Select("category_id").
+			Where("resource_name = ? AND resource_id = ?", a.Name(), instanceId)).
+		Order("name asc").
+		Find(&categories).Error
+	return categories, err
+}
+
+// SetTags replaces the tags of the given record of the App.
+func (a *App) SetTags(db *Database, instanceId string, tagIds []uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("resource_name = ? AND resource_id = ?", a.Name(), instanceId).Delete(&ResourceTag{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, tagId := range tagIds {
+			err = tx.Create(&ResourceTag{ResourceName: a.Name(), ResourceId: instanceId, TagID: tagId}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SetCategories replaces the categories of the given record of the App.
+func (a *App) SetCategories(db *Database, instanceId string, categoryIds []uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("resource_name = ? AND resource_id = ?", a.Name(), instanceId).Delete(&ResourceCategory{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, categoryId := range categoryIds {
+			err = tx.Create(&ResourceCategory{ResourceName: a.Name(), ResourceId: instanceId, CategoryID: categoryId}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetTagUsage returns the number of records of the given Apps labeled with each tag, most
+// used first. Deleted records are not counted, and in the Apps bound to users only the
+// records of the user are counted unless the user is an admin, like in the lists.
+func GetTagUsage(db *Database, apps []*App, params *RequestParameters) ([]TagUsage, error) {
+	type count struct {
+		TagID uint
+		Count int64
+	}
+
+	countsByTag := make(map[uint]int64)
+	for _, app := range apps {
+		if !app.HasTags() {
+			continue
+		}
+
+		records := db.DB.Model(app.Model).Select("id")
+		if app.IsContentType() {
+			records = records.Where("content_type = ?", app.ContentType.Name)
+		}
+		if !app.SkipUserBinding && !params.IsAdmin() {
+			records = records.Where("created_by_id = ?", params.RequestedById)
+		}
+
+		var counts []count
+		err := db.DB.Model(&ResourceTag{}).
+			Select("tag_id, COUNT(*) as count").
+			Where("resource_name = ? AND CAST(resource_id AS BIGINT) IN (?)", app.Name(), records).
+			Group("tag_id").
+			Find(&counts).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range counts {
+			countsByTag[c.TagID] += c.Count
+		}
+	}
+
+	var tags []Tag
+	err := db.DB.Order("name asc").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]TagUsage, 0, len(tags))
+	for _, tag := range tags {
+		output = append(output, TagUsage{Tag: tag, Count: countsByTag[tag.ID]})
+	}
+
+	// tags with the same count stay ordered by name
+	sort.SliceStable(output, func(i, j int) bool {
+		return output[i].Count > output[j].Count
+	})
+
+	return output, nil
+}
+
+// DeleteTerms deletes the links of the records with the given IDs to their tags and
+// categories, once the records are deleted.
+func (a *App) DeleteTerms(db *Database, resourceIds []string) error {
+	if len(resourceIds) == 0 {
+		return nil
+	}
+
+	if a.HasTags() {
+		err := db.DB.Where("resource_name = ? AND resource_id IN ?", a.Name(), resourceIds).Delete(&ResourceTag{}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.HasCategories() {
+		err := db.DB.Where("resource_name = ? AND resource_id IN ?", a.Name(), resourceIds).Delete(&ResourceCategory{}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCategoryTree returns all the categories nested under their parents.
+func GetCategoryTree(db *Database) ([]*CategoryNode, error) {
+	var categories []Category
+	err := db.DB.Order("name asc").Find(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: make([]*CategoryNode, 0)}
+	}
+
+	output := make([]*CategoryNode, 0)
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		output = append(output, node)
+	}
+
+	return output, nil
+}
+
+// apiTerms returns a handler for the endpoints that read (GET) or replace (PUT) the terms of a record.
+//
+// Reading needs read permission and replacing needs update permission on the App, and in
+// both cases the user must have access to the record.
+func (a *App) apiTerms(db *Database, method string, enabled func() bool, name string, model interface{},
+	get func(db *Database, instanceId string) (interface{}, error),
+	set func(db *Database, instanceId string, ids []uint) error) HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !enabled() {
+			SendJsonResponse(w, http.StatusNotFound, nil, a.Name()+" has no "+name)
+			return
+		}
+
+		params := FormatRequestParameters(r, a.Admin.Builder)
+
+		operation := OperationRead
+		if method == http.MethodPut {
+			operation = OperationUpdate
+		}
+
+		isAllowed := a.Permissions.HasPermission(params.Roles, operation)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to access this resource")
+			return
+		}
+
+		instanceId := GetUrlParam("id", r)
+		instance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, instanceId, db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+		if instance == nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			body, err := ReadRequestBody(r)
+			if err != nil {
+				SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+				return
+			}
+
+			input := make(map[string][]uint)
+			err = json.Unmarshal(body, &input)
+			if err != nil {
+				SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
+				return
+			}
+
+			values := make([]string, 0, len(input[name]))
+			for _, id := range input[name] {
+				values = append(values, fmt.Sprint(id))
+			}
+
+			ids, err := findTermIds(db, model, values)
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+			if len(ids) != len(values) {
+				SendJsonResponse(w, http.StatusBadRequest, nil, "Some "+name+" were not found")
+				return
+			}
+
+			err = set(db, instanceId, ids)
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+		}
+
+		terms, err := get(db, instanceId)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, terms, a.Name()+" "+name)
+	}
+}
+
+func (a *App) getTagTerms(db *Database, instanceId string) (interface{}, error) {
+	return a.GetTags(db, instanceId)
+}
+
+func (a *App) getCategoryTerms(db *Database, instanceId string) (interface{}, error) {
+	return a.GetCategories(db, instanceId)
+}
+
+// ApiTags returns a handler function that responds to GET requests on the tags
+// endpoint of a record, e.g. /api/posts/{id}/tags.
+func (a *App) ApiTags(db *Database) HandlerFunc {
+	return a.apiTerms(db, http.MethodGet, a.HasTags, "tags", &Tag{}, a.getTagTerms, a.SetTags)
+}
+
+// ApiUpdateTags returns a handler function that responds to PUT requests on the tags
+// endpoint of a record, e.g. /api/posts/{id}/tags.
+//
+// The tags of the record are replaced with the given IDs, e.g. {"tags": [1, 2]}.
+func (a *App) ApiUpdateTags(db *Database) HandlerFunc {
+	return a.apiTerms(db, http.MethodPut, a.HasTags, "tags", &Tag{}, a.getTagTerms, a.SetTags)
+}
+
+// ApiCategories returns a handler function that responds to GET requests on the
+// categories endpoint of a record, e.g. /api/posts/{id}/categories.
+func (a *App) ApiCategories(db *Database) HandlerFunc {
+	return a.apiTerms(db, http.MethodGet, a.HasCategories, "categories", &Category{}, a.getCategoryTerms, a.SetCategories)
+}
+
+// ApiUpdateCategories returns a handler function that responds to PUT requests on the
+// categories endpoint of a record, e.g. /api/posts/{id}/categories.
+//
+// The categories of the record are replaced with the given IDs, e.g. {"categories": [1, 2]}.
+func (a *App) ApiUpdateCategories(db *Database) HandlerFunc {
+	return a.apiTerms(db, http.MethodPut, a.HasCategories, "categories", &Category{}, a.getCategoryTerms, a.SetCategories)
+}
+
+// ApiTagUsage returns a handler function that responds with the number of records labeled
+// with each tag, e.g. /api/taxonomy/tags/usage?app=Post.
+//
+// Only the records of the Apps the user can read are counted, see GetTagUsage.
+func (a *Admin) ApiTagUsage(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := FormatRequestParameters(r, a.Builder)
+
+		appName := GetQueryParam("app", r)
+		apps := make([]*App, 0)
+		for _, app := range a.GetApps() {
+			if appName != "" && app.Name() != appName {
+				continue
+			}
+			if !app.Permissions.HasPermission(params.Roles, OperationRead) {
+				continue
+			}
+			apps = append(apps, &app)
+		}
+
+		usage, err := GetTagUsage(db, apps, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, usage, "Tag usage")
+	}
+}
+
+// ApiCategoryTree returns a handler function that responds with the categories nested under
+// their parents, e.g. /api/taxonomy/categories/tree.
+func ApiCategoryTree(db *Database) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tree, err := GetCategoryTree(db)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		SendJsonResponse(w, http.StatusOK, tree, "Category tree")
+	}
+}
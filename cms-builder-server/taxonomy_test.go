@@ -0,0 +1,137 @@
+package builder_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinQueries(t *testing.T) {
+	assert.Equal(t, "", builder.JoinQueries("", ""))
+	assert.Equal(t, "(a = 1)", builder.JoinQueries("a = 1", ""))
+	assert.Equal(t, "(a = 1) AND (b = 2 OR c = 3)", builder.JoinQueries("a = 1", "b = 2 OR c = 3"))
+}
+
+// TestCategoryCannotBeItsOwnDescendant tests that moving a category under one of its
+// descendants is rejected.
+func TestCategoryCannotBeItsOwnDescendant(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	root := builder.Category{SystemData: &builder.SystemData{}, Name: th.RandomName(), Slug: strings.ToLower(th.RandomString(12))}
+	err = e.DB.DB.Create(&root).Error
+	assert.NoError(t, err, "Creating the root category should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&root)
+
+	child := builder.Category{SystemData: &builder.SystemData{}, Name: th.RandomName(), Slug: strings.ToLower(th.RandomString(12)), ParentID: &root.ID}
+	err = e.DB.DB.Create(&child).Error
+	assert.NoError(t, err, "Creating the child category should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&child)
+
+	root.ParentID = &child.ID
+	err = e.DB.DB.Save(&root).Error
+	assert.Error(t, err, "Moving a category under its child should return an error")
+}
+
+// TestTaxonomyFilters tests that records can be tagged and categorized, and that lists can be
+// filtered by tag and by category, including the records of child categories.
+func TestTaxonomyFilters(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	e.App.EnableTags()
+	e.App.EnableCategories()
+
+	tag := builder.Tag{SystemData: &builder.SystemData{}, Name: th.RandomName(), Slug: strings.ToLower(th.RandomString(12))}
+	err = e.DB.DB.Create(&tag).Error
+	assert.NoError(t, err, "Creating the tag should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&tag)
+
+	parent := builder.Category{SystemData: &builder.SystemData{}, Name: th.RandomName(), Slug: strings.ToLower(th.RandomString(12))}
+	err = e.DB.DB.Create(&parent).Error
+	assert.NoError(t, err, "Creating the parent category should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&parent)
+
+	child := builder.Category{SystemData: &builder.SystemData{}, Name: th.RandomName(), Slug: strings.ToLower(th.RandomString(12)), ParentID: &parent.ID}
+	err = e.DB.DB.Create(&child).Error
+	assert.NoError(t, err, "Creating the child category should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&child)
+
+	tagged, user, userRollback := th.CreateMockResource(t, e.DB, e.App, nil)
+	defer userRollback()
+	categorized, _, _ := th.CreateMockResource(t, e.DB, e.App, user)
+	th.CreateMockResource(t, e.DB, e.App, user)
+
+	t.Log("Tagging a record")
+	body := fmt.Sprintf(`{"tags": [%d]}`, tag.ID)
+	request, _, _ := th.NewRequest(http.MethodPut, body, true, user, map[string]string{"id": tagged.GetIDString()})
+
+	var tags []builder.Tag
+	response, err := th.ExecuteApiCall(t, e.App.ApiUpdateTags(e.DB), request, &tags)
+	assert.NoError(t, err, "ApiUpdateTags should not return an error")
+	assert.True(t, response.Success, "ApiUpdateTags should return a success response")
+	assert.Equal(t, 1, len(tags), "Record should have one tag")
+
+	t.Log("Categorizing a record under the child category")
+	body = fmt.Sprintf(`{"categories": [%d]}`, child.ID)
+	request, _, _ = th.NewRequest(http.MethodPut, body, true, user, map[string]string{"id": categorized.GetIDString()})
+
+	response, err = th.ExecuteApiCall(t, e.App.ApiUpdateCategories(e.DB), request, nil)
+	assert.NoError(t, err, "ApiUpdateCategories should not return an error")
+	assert.True(t, response.Success, "ApiUpdateCategories should return a success response")
+
+	t.Log("Filtering by tag slug")
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, nil)
+	request.URL.RawQuery = "tag=" + tag.Slug
+
+	var result []th.MockStruct
+	response, err = th.ExecuteApiCall(t, e.App.ApiList(e.DB), request, &result)
+	assert.NoError(t, err, "ApiList should not return an error")
+	assert.Equal(t, 1, len(result), "List should contain the tagged record")
+	assert.Equal(t, tagged.ID, result[0].ID, "List should contain the tagged record")
+
+	t.Log("Filtering by the parent category")
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, nil)
+	request.URL.RawQuery = fmt.Sprintf("category=%d", parent.ID)
+
+	result = nil
+	response, err = th.ExecuteApiCall(t, e.App.ApiList(e.DB), request, &result)
+	assert.NoError(t, err, "ApiList should not return an error")
+	assert.Equal(t, 1, len(result), "List should contain the record of the child category")
+	assert.Equal(t, categorized.ID, result[0].ID, "List should contain the record of the child category")
+
+	t.Log("Checking the tag usage")
+	usageOf := func(params *builder.RequestParameters) int64 {
+		usage, err := builder.GetTagUsage(e.DB, []*builder.App{e.App}, params)
+		assert.NoError(t, err, "GetTagUsage should not return an error")
+		for _, u := range usage {
+			if u.Tag.ID == tag.ID {
+				return u.Count
+			}
+		}
+		return 0
+	}
+	assert.Equal(t, int64(1), usageOf(&builder.RequestParameters{RequestedById: user.GetIDString()}), "Tag should be used once")
+	assert.Equal(t, int64(0), usageOf(&builder.RequestParameters{RequestedById: "0"}), "Records of other users should not be counted")
+
+	t.Log("Deleting a category with subcategories")
+	res := e.DB.DB.Delete(&parent)
+	assert.ErrorIs(t, res.Error, builder.ErrCategoryHasChildren, "Categories with subcategories should not be deleted")
+
+	t.Log("Deleting the tagged record")
+	request, _, _ = th.NewRequest(http.MethodDelete, "", true, user, map[string]string{"id": tagged.GetIDString()})
+	response, err = th.ExecuteApiCall(t, e.App.ApiDelete(e.DB), request, nil)
+	assert.NoError(t, err, "ApiDelete should not return an error")
+	assert.True(t, response.Success, "ApiDelete should return a success response")
+
+	var links int64
+	err = e.DB.DB.Model(&builder.ResourceTag{}).Where("resource_name = ? AND resource_id = ?", e.App.Name(), tagged.GetIDString()).Count(&links).Error
+	assert.NoError(t, err, "Counting the links should not return an error")
+	assert.Equal(t, int64(0), links, "The tags of the deleted record should be unlinked")
+	assert.Equal(t, int64(0), usageOf(&builder.RequestParameters{RequestedById: user.GetIDString()}), "Deleted records should not be counted")
+}
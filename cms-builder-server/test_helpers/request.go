@@ -87,8 +87,8 @@ func NewRequestWithFile(method string, body string, filePath string, authenticat
 		Header: header,
 	}
 
-	for k, v := range vars {
-		r = mux.SetURLVars(r, map[string]string{k: v})
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
 	}
 
 	if body != "" {
@@ -0,0 +1,194 @@
+package builder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTLSCertificateNotProvided = errors.New("tls certificate and key files must be provided together")
+	ErrInvalidTLSVersion         = errors.New("invalid tls version, expected 1.0, 1.1, 1.2 or 1.3")
+	ErrInvalidTLSClientCA        = errors.New("no certificates found in the tls client ca file")
+)
+
+// DefaultTLSMinVersion is the minimum TLS version accepted when none is configured.
+const DefaultTLSMinVersion = "1.2"
+
+// tlsVersions maps the configurable TLS versions to their crypto/tls values.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig defines the options for serving HTTPS. The server is served over HTTP/2,
+// falling back to HTTP/1.1 for the clients that don't support it.
+type TLSConfig struct {
+	CertFile     string // CertFile is the PEM encoded certificate, reloaded when it changes on disk.
+	KeyFile      string // KeyFile is the PEM encoded private key, reloaded when it changes on disk.
+	MinVersion   string // MinVersion is the minimum TLS version accepted, e.g. 1.2. Defaults to DefaultTLSMinVersion.
+	ClientCAFile string // ClientCAFile enables mTLS, clients must present a certificate signed by one of its CAs.
+	RedirectPort string // RedirectPort enables a plain HTTP listener that redirects the requests to HTTPS.
+}
+
+// certificateReloader serves the certificate of a key pair, reloading it when the files
+// change on disk, so renewed certificates are picked up without restarting the server.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// newCertificateReloader loads the key pair from the given files.
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// modTimes returns the last time the certificate and key files were modified.
+func (c *certificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// reload loads the key pair from disk.
+func (c *certificateReloader) reload() error {
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.certificate = &certificate
+	c.certModTime = certModTime
+	c.keyModTime = keyModTime
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files changed.
+//
+// If the new files can't be loaded, e.g. because only one of them was replaced yet, the
+// previous certificate is served until they can.
+func (c *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certModTime, keyModTime, err := c.modTimes()
+
+	c.mu.RLock()
+	changed := err == nil && (!certModTime.Equal(c.certModTime) || !keyModTime.Equal(c.keyModTime))
+	c.mu.RUnlock()
+
+	if changed {
+		err = c.reload()
+		if err != nil {
+			log.Error().Err(err).Str("certFile", c.certFile).Msg("Error reloading TLS certificate")
+		} else {
+			log.Info().Str("certFile", c.certFile).Msg("TLS certificate reloaded")
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.certificate, nil
+}
+
+// newTLSConfig creates the crypto/tls configuration of the server from the given options.
+func newTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, ErrTLSCertificateNotProvided
+	}
+
+	minVersion := config.MinVersion
+	if minVersion == "" {
+		minVersion = DefaultTLSMinVersion
+	}
+
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTLSVersion, minVersion)
+	}
+
+	reloader, err := newCertificateReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     version,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidTLSClientCA
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// newRedirectServer creates a plain HTTP server listening on the given address that
+// redirects every request to the same URL over HTTPS, on the port of the TLS server.
+func newRedirectServer(addr, tlsPort string) *http.Server {
+	return &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			if tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+	}
+}
@@ -0,0 +1,157 @@
+package builder_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate writes a self-signed certificate for localhost with the given common
+// name to the given files, and returns it.
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "GenerateKey should not return an error")
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err, "CreateCertificate should not return an error")
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err, "MarshalECPrivateKey should not return an error")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NoError(t, err, "WriteFile should not return an error")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	assert.NoError(t, err, "WriteFile should not return an error")
+
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err, "ParseCertificate should not return an error")
+
+	return certificate
+}
+
+// freePort returns a port nothing is listening on.
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "Listen should not return an error")
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// TestNewServerTLSConfig tests that invalid TLS options are rejected.
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeTestCertificate(t, certFile, keyFile, "localhost")
+
+	_, err := builder.NewServer(&builder.ServerConfig{TLS: &builder.TLSConfig{CertFile: certFile}})
+	assert.ErrorIs(t, err, builder.ErrTLSCertificateNotProvided, "The key file should be required")
+
+	_, err = builder.NewServer(&builder.ServerConfig{TLS: &builder.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "2.0"}})
+	assert.ErrorIs(t, err, builder.ErrInvalidTLSVersion, "The TLS version should be validated")
+
+	_, err = builder.NewServer(&builder.ServerConfig{TLS: &builder.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}})
+	assert.ErrorIs(t, err, builder.ErrInvalidTLSClientCA, "The client CA file should contain certificates")
+
+	server, err := builder.NewServer(&builder.ServerConfig{TLS: &builder.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}})
+	assert.NoError(t, err, "NewServer should not return an error")
+	assert.Equal(t, uint16(tls.VersionTLS12), server.TLSConfig.MinVersion, "The minimum TLS version should default to 1.2")
+	assert.Equal(t, tls.RequireAndVerifyClientCert, server.TLSConfig.ClientAuth, "Client certificates should be required")
+}
+
+// TestServerTLS tests that the server is served over HTTP/2, that the certificate is reloaded
+// when it changes on disk, and that plain HTTP requests are redirected.
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	first := writeTestCertificate(t, certFile, keyFile, "first")
+
+	port := freePort(t)
+	redirectPort := freePort(t)
+
+	b := &builder.Builder{}
+	b.Admin = builder.NewAdmin(b)
+	server, err := builder.NewServer(&builder.ServerConfig{
+		Host:    "127.0.0.1",
+		Port:    port,
+		Builder: b,
+		TLS:     &builder.TLSConfig{CertFile: certFile, KeyFile: keyFile, RedirectPort: redirectPort},
+	})
+	assert.NoError(t, err, "NewServer should not return an error")
+	b.Server = server
+
+	go server.Run()
+	defer server.Shutdown(context.Background())
+
+	// get connects to the server, trusting only the given certificate
+	get := func(certificate *x509.Certificate) (*http.Response, error) {
+		pool := x509.NewCertPool()
+		pool.AddCert(certificate)
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			ForceAttemptHTTP2: true,
+		}}
+		return client.Get("https://127.0.0.1:" + port + "/")
+	}
+
+	var response *http.Response
+	assert.Eventually(t, func() bool {
+		response, err = get(first)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "The server should be served over TLS")
+	response.Body.Close()
+	assert.Equal(t, "HTTP/2.0", response.Proto, "The server should be served over HTTP/2")
+
+	second := writeTestCertificate(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	response, err = get(second)
+	assert.NoError(t, err, "The new certificate should be served")
+	if err == nil {
+		response.Body.Close()
+		assert.Equal(t, "second", response.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err = client.Get("http://127.0.0.1:" + redirectPort + "/api?x=1")
+	assert.NoError(t, err, "The redirect server should be running")
+	if err == nil {
+		response.Body.Close()
+		assert.Equal(t, http.StatusPermanentRedirect, response.StatusCode)
+		assert.Equal(t, "https://127.0.0.1:"+port+"/api?x=1", response.Header.Get("Location"))
+	}
+}
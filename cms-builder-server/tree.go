@@ -0,0 +1,443 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TreeDeletePolicy defines what happens to the children of a record of a tree when it is deleted.
+type TreeDeletePolicy string
+
+const (
+	TreeDeleteCascade  TreeDeletePolicy = "cascade"  // The descendants are deleted too
+	TreeDeleteReparent TreeDeletePolicy = "reparent" // The children are moved to the parent of the deleted record
+)
+
+// TreeNode is embedded in the models whose records form a tree, e.g. pages or nested menus.
+//
+// Besides the parent, each record stores the path of its ancestors, e.g. "/1/4/" for a record
+// whose parent is 4 and whose grandparent is 1, so subtrees can be queried without recursion.
+// The path and the depth are computed when records are created or moved.
+type TreeNode struct {
+	ParentID *uint  `gorm:"index" json:"parentId"`
+	TreePath string `gorm:"index" json:"treePath"`
+	Depth    int    `json:"depth"`
+}
+
+// TreeConfig defines whether the records of an App form a tree.
+type TreeConfig struct {
+	Enabled  bool
+	OnDelete TreeDeletePolicy
+}
+
+// ErrSubtreeNotOwned is returned when a user deletes a record whose subtree has records of other users.
+var ErrSubtreeNotOwned = errors.New("the subtree has records of other users")
+
+// treeNodeType is used to check that models embed TreeNode
+var treeNodeType = reflect.TypeOf(TreeNode{})
+
+// EnableTree lets the records of the App be nested. The model must embed TreeNode.
+//
+// Parameters:
+// - onDelete: what happens to the children of deleted records, TreeDeleteReparent by default.
+//
+// Returns:
+// - error: an error if the model doesn't embed TreeNode or the policy is invalid.
+func (a *App) EnableTree(onDelete TreeDeletePolicy) error {
+	t := reflect.TypeOf(a.Model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	field, ok := t.FieldByName("TreeNode")
+	if !ok || !field.Anonymous || field.Type != treeNodeType {
+		return fmt.Errorf("%s must embed TreeNode", a.Name())
+	}
+
+	switch onDelete {
+	case "":
+		onDelete = TreeDeleteReparent
+	case TreeDeleteCascade, TreeDeleteReparent:
+	default:
+		return fmt.Errorf("invalid delete policy %q", onDelete)
+	}
+
+	if a.Tree == nil {
+		a.Tree = &TreeConfig{}
+	}
+
+	*a.Tree = TreeConfig{
+		Enabled:  true,
+		OnDelete: onDelete,
+	}
+
+	return nil
+}
+
+// IsTree returns true if the records of the App form a tree.
+func (a *App) IsTree() bool {
+	return a.Tree != nil && a.Tree.Enabled
+}
+
+// GetTreeNode returns the tree data of the given instance.
+func GetTreeNode(instance interface{}) (*TreeNode, error) {
+	v := reflect.ValueOf(instance)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("instance is nil")
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct || !v.CanAddr() {
+		return nil, fmt.Errorf("instance must be a pointer to a struct")
+	}
+
+	field := v.FieldByName("TreeNode")
+	if !field.IsValid() || field.Type() != treeNodeType {
+		return nil, fmt.Errorf("instance doesn't embed TreeNode")
+	}
+
+	return field.Addr().Interface().(*TreeNode), nil
+}
+
+// getInstanceId returns the ID of the given instance.
+func getInstanceId(instance interface{}) (uint, error) {
+	value, err := GetFieldValueByJsonName(instance, "ID")
+	if err != nil {
+		return 0, err
+	}
+	return uint(value.Uint()), nil
+}
+
+// SubtreePath returns the path shared by the descendants of the record with the given ID.
+func (n *TreeNode) SubtreePath(id uint) string {
+	return n.TreePath + fmt.Sprint(id) + "/"
+}
+
+// AncestorIds returns the IDs of the ancestors of the record, from the root to the parent.
+func (n *TreeNode) AncestorIds() []uint {
+	ids := make([]uint, 0)
+	for _, part := range strings.Split(strings.Trim(n.TreePath, "/"), "/") {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// PrepareTree computes the path and depth of the given instance from its parent.
+//
+// The parent must be a record the user can access, and records can't be moved under
+// themselves or their descendants. Records that keep their parent keep their path and
+// depth, so users can edit their records under the records of other users.
+//
+// Parameters:
+// - db: the database to query.
+// - instance: the record.
+// - instanceId: the ID of the record, or empty for new records.
+// - previous: the stored tree node of the record, or nil for new records.
+// - params: the parameters of the request, used to check the user can access the parent.
+func (a *App) PrepareTree(db *Database, instance interface{}, instanceId string, previous *TreeNode, params *RequestParameters) error {
+	if !a.IsTree() {
+		return nil
+	}
+
+	node, err := GetTreeNode(instance)
+	if err != nil {
+		return err
+	}
+
+	if node.ParentID == nil {
+		node.TreePath = "/"
+		node.Depth = 0
+		return nil
+	}
+
+	if previous != nil && previous.ParentID != nil && *previous.ParentID == *node.ParentID {
+		node.TreePath = previous.TreePath
+		node.Depth = previous.Depth
+		return nil
+	}
+
+	if instanceId != "" && fmt.Sprint(*node.ParentID) == instanceId {
+		return fmt.Errorf("a record can't be its own parent")
+	}
+
+	parentInstance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, fmt.Sprint(*node.ParentID), db, params)
+	if err != nil {
+		return fmt.Errorf("parent not found")
+	}
+
+	parent, err := GetTreeNode(parentInstance)
+	if err != nil {
+		return err
+	}
+
+	if instanceId != "" && strings.Contains(parent.TreePath, "/"+instanceId+"/") {
+		return fmt.Errorf("a record can't be moved under one of its descendants")
+	}
+
+	node.TreePath = parent.SubtreePath(*node.ParentID)
+	node.Depth = parent.Depth + 1
+
+	return nil
+}
+
+// MoveSubtree updates the paths and depths of the descendants of the given instance after it
+// was moved from the given path and depth.
+func (a *App) MoveSubtree(db *Database, instance interface{}, previousPath string, previousDepth int) error {
+	if !a.IsTree() {
+		return nil
+	}
+
+	node, err := GetTreeNode(instance)
+	if err != nil {
+		return err
+	}
+
+	if node.TreePath == previousPath {
+		return nil
+	}
+
+	id, err := getInstanceId(instance)
+	if err != nil {
+		return err
+	}
+
+	return a.replaceTreePaths(db, (&TreeNode{TreePath: previousPath}).SubtreePath(id), node.SubtreePath(id), node.Depth-previousDepth)
+}
+
+// replaceTreePaths replaces the given prefix of the paths of the records under it, and shifts their depth.
+func (a *App) replaceTreePaths(db *Database, previousPrefix string, prefix string, depthDelta int) error {
+	pathColumn, err := db.GetColumnName(a.Model, "treePath")
+	if err != nil {
+		return err
+	}
+
+	depthColumn, err := db.GetColumnName(a.Model, "depth")
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Model(a.Model).
+		Where(pathColumn+" LIKE ?", previousPrefix+"%").
+		UpdateColumns(map[string]interface{}{
+			pathColumn:  gorm.Expr("? || SUBSTR("+pathColumn+", ?)", prefix, len(previousPrefix)+1),
+			depthColumn: gorm.Expr(depthColumn+" + ?", depthDelta),
+		}).Error
+}
+
+// DeleteSubtree applies the delete policy of the tree to the descendants of the given instance,
+// before the instance itself is deleted.
+//
+// With TreeDeleteCascade the descendants are deleted and logged in the history. With
+// TreeDeleteReparent the children are moved to the parent of the instance.
+//
+// Both policies change the descendants, so unless the user is an admin or the App skips the
+// user binding, it returns ErrSubtreeNotOwned if any of them was created by another user.
+func (a *App) DeleteSubtree(db *Database, instance interface{}, params *RequestParameters) error {
+	if !a.IsTree() {
+		return nil
+	}
+
+	node, err := GetTreeNode(instance)
+	if err != nil {
+		return err
+	}
+
+	id, err := getInstanceId(instance)
+	if err != nil {
+		return err
+	}
+
+	pathColumn, err := db.GetColumnName(a.Model, "treePath")
+	if err != nil {
+		return err
+	}
+
+	if !a.SkipUserBinding && !params.IsAdmin() {
+		var foreign int64
+		err = db.DB.Model(a.Model).
+			Where(pathColumn+" LIKE ?", node.SubtreePath(id)+"%").
+			Where("created_by_id <> ?", params.RequestedById).
+			Count(&foreign).Error
+		if err != nil {
+			return err
+		}
+		if foreign > 0 {
+			return ErrSubtreeNotOwned
+		}
+	}
+
+	if a.Tree.OnDelete == TreeDeleteCascade {
+		descendants, err := CreateSliceForUndeterminedType(a.Model)
+		if err != nil {
+			return err
+		}
+
+		err = db.DB.Where(pathColumn+" LIKE ?", node.SubtreePath(id)+"%").Find(descendants).Error
+		if err != nil {
+			return err
+		}
+
+		descendantIds := make([]string, 0)
+		items := reflect.ValueOf(descendants).Elem()
+		for i := 0; i < items.Len(); i++ {
+			descendant := items.Index(i).Addr().Interface()
+			descendantId, err := getInstanceId(descendant)
+			if err != nil {
+				return err
+			}
+
+			res := db.Delete(descendant, params.User)
+			if res == nil {
+				return fmt.Errorf("error deleting descendant of %d", id)
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+			descendantIds = append(descendantIds, fmt.Sprint(descendantId))
+		}
+
+		err = a.DeleteTranslations(db, descendantIds)
+		if err != nil {
+			return err
+		}
+
+		return a.DeleteTerms(db, descendantIds)
+	}
+
+	parentColumn, err := db.GetColumnName(a.Model, "parentId")
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Model(a.Model).
+		Where(parentColumn+" = ?", id).
+		UpdateColumn(parentColumn, node.ParentID).Error
+	if err != nil {
+		return err
+	}
+
+	return a.replaceTreePaths(db, node.SubtreePath(id), node.TreePath, -1)
+}
+
+// apiTree handles the requests of the tree endpoints. The given function returns the query
+// that selects the related records of the node in the request, and their order.
+func (a *App) apiTree(db *Database, name string, related func(db *Database, node *TreeNode, id uint) (string, []interface{}, string, error)) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.IsTree() {
+			SendJsonResponse(w, http.StatusNotFound, nil, a.Name()+" is not a tree")
+			return
+		}
+
+		params := FormatRequestParameters(r, a.Admin.Builder)
+		isAllowed := a.Permissions.HasPermission(params.Roles, OperationRead)
+		if !isAllowed {
+			SendJsonResponse(w, http.StatusForbidden, nil, "User is not allowed to read this resource")
+			return
+		}
+
+		instance, err := GetInstanceIfAuthorized(a.Model, a.SkipUserBinding, GetUrlParam("id", r), db, &params)
+		if err != nil {
+			SendJsonResponse(w, http.StatusNotFound, nil, "Instance not found")
+			return
+		}
+
+		node, err := GetTreeNode(instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		id, err := getInstanceId(instance)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		query, args, order, err := related(db, node, id)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		q := db.DB.Where(query, args...)
+		if !a.SkipUserBinding && !params.IsAdmin() {
+			q = q.Where("created_by_id = ?", params.RequestedById)
+		}
+
+		instances, err := CreateSliceForUndeterminedType(a.Model)
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		err = q.Order(order).Find(instances).Error
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		a.SendLocalizedJsonResponse(w, r, db, instances, a.Name()+" "+name, nil)
+	}
+}
+
+// getTreeOrder returns the order of the records of the same level, by position if the App is sortable.
+func (a *App) getTreeOrder(db *Database) string {
+	if a.IsSortable() {
+		if column, err := db.GetColumnName(a.Model, a.Sortable.Field); err == nil {
+			return column + " asc, id asc"
+		}
+	}
+	return "id asc"
+}
+
+// ApiChildren returns a handler function that responds to GET requests on the
+// children endpoint, e.g. /api/pages/{id}/children.
+func (a *App) ApiChildren(db *Database) HandlerFunc {
+	return a.apiTree(db, "children", func(db *Database, node *TreeNode, id uint) (string, []interface{}, string, error) {
+		column, err := db.GetColumnName(a.Model, "parentId")
+		if err != nil {
+			return "", nil, "", err
+		}
+		return column + " = ?", []interface{}{id}, a.getTreeOrder(db), nil
+	})
+}
+
+// ApiDescendants returns a handler function that responds to GET requests on the
+// descendants endpoint, e.g. /api/pages/{id}/descendants.
+//
+// Descendants are ordered by path, so each record comes after its ancestors, and the
+// records of the same path by position if the App is sortable.
+func (a *App) ApiDescendants(db *Database) HandlerFunc {
+	return a.apiTree(db, "descendants", func(db *Database, node *TreeNode, id uint) (string, []interface{}, string, error) {
+		column, err := db.GetColumnName(a.Model, "treePath")
+		if err != nil {
+			return "", nil, "", err
+		}
+		return column + " LIKE ?", []interface{}{node.SubtreePath(id) + "%"}, column + " asc, " + a.getTreeOrder(db), nil
+	})
+}
+
+// ApiAncestors returns a handler function that responds to GET requests on the
+// ancestors endpoint, e.g. /api/pages/{id}/ancestors.
+//
+// Ancestors are ordered from the root to the parent, e.g. to build breadcrumbs.
+func (a *App) ApiAncestors(db *Database) HandlerFunc {
+	return a.apiTree(db, "ancestors", func(db *Database, node *TreeNode, id uint) (string, []interface{}, string, error) {
+		column, err := db.GetColumnName(a.Model, "depth")
+		if err != nil {
+			return "", nil, "", err
+		}
+		return "id IN ?", []interface{}{node.AncestorIds()}, column + " asc", nil
+	})
+}
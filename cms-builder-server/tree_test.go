@@ -0,0 +1,128 @@
+package builder_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockTreeStruct struct {
+	*builder.SystemData
+	builder.TreeNode
+	Name string `json:"name"`
+}
+
+// TestTree tests that records can be nested, that subtrees follow moved records and that
+// records can't be moved under their descendants.
+func TestTree(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockTreeStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	err = app.EnableTree(builder.TreeDeleteReparent)
+	assert.NoError(t, err, "EnableTree should not return an error")
+
+	_, user, rollback := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollback()
+
+	create := func(name string, parent *uint) MockTreeStruct {
+		body := fmt.Sprintf(`{"name": "%s"}`, name)
+		if parent != nil {
+			body = fmt.Sprintf(`{"name": "%s", "parentId": %d}`, name, *parent)
+		}
+		request, _, _ := th.NewRequest(http.MethodPost, body, true, user, nil)
+
+		var record MockTreeStruct
+		response, err := th.ExecuteApiCall(t, app.ApiCreate(e.DB), request, &record)
+		assert.NoError(t, err, "ApiCreate should not return an error")
+		assert.True(t, response.Success, "ApiCreate should return a success response")
+		return record
+	}
+
+	t.Log("Creating a tree")
+	root := create("root", nil)
+	child := create("child", &root.ID)
+	grandchild := create("grandchild", &child.ID)
+	other := create("other", nil)
+	assert.Equal(t, fmt.Sprintf("/%d/%d/", root.ID, child.ID), grandchild.TreePath, "Path should contain the ancestors")
+	assert.Equal(t, 2, grandchild.Depth, "Depth should be the number of ancestors")
+
+	t.Log("Listing the descendants")
+	request, _, _ := th.NewRequest(http.MethodGet, "", true, user, map[string]string{"id": root.GetIDString()})
+
+	var descendants []MockTreeStruct
+	_, err = th.ExecuteApiCall(t, app.ApiDescendants(e.DB), request, &descendants)
+	assert.NoError(t, err, "ApiDescendants should not return an error")
+	assert.Equal(t, 2, len(descendants), "Root should have two descendants")
+
+	t.Log("Moving a record under its descendant")
+	body := fmt.Sprintf(`{"parentId": %d}`, grandchild.ID)
+	request, _, _ = th.NewRequest(http.MethodPut, body, true, user, map[string]string{"id": root.GetIDString()})
+	response, err := th.ExecuteApiCall(t, app.ApiUpdate(e.DB), request, nil)
+	assert.NoError(t, err, "ApiUpdate should not return an error")
+	assert.False(t, response.Success, "ApiUpdate should not allow cycles")
+
+	t.Log("Moving the child with its subtree")
+	body = fmt.Sprintf(`{"parentId": %d}`, other.ID)
+	request, _, _ = th.NewRequest(http.MethodPut, body, true, user, map[string]string{"id": child.GetIDString()})
+	response, err = th.ExecuteApiCall(t, app.ApiUpdate(e.DB), request, nil)
+	assert.NoError(t, err, "ApiUpdate should not return an error")
+	assert.True(t, response.Success, "ApiUpdate should return a success response")
+
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, map[string]string{"id": grandchild.GetIDString()})
+
+	var ancestors []MockTreeStruct
+	_, err = th.ExecuteApiCall(t, app.ApiAncestors(e.DB), request, &ancestors)
+	assert.NoError(t, err, "ApiAncestors should not return an error")
+	assert.Equal(t, []uint{other.ID, child.ID}, []uint{ancestors[0].ID, ancestors[1].ID}, "Ancestors should follow the moved record")
+
+	t.Log("Deleting a record whose subtree has records of another user")
+	_, stranger, rollbackStranger := th.NewRequest(http.MethodPost, "", true, nil, nil)
+	defer rollbackStranger()
+
+	foreign := MockTreeStruct{
+		SystemData: &builder.SystemData{CreatedByID: stranger.ID, UpdatedByID: stranger.ID},
+		TreeNode:   builder.TreeNode{ParentID: &root.ID, TreePath: fmt.Sprintf("/%d/", root.ID), Depth: 1},
+		Name:       "foreign",
+	}
+	err = e.DB.DB.Create(&foreign).Error
+	assert.NoError(t, err, "Create should not return an error")
+
+	t.Log("Editing a record under a record of another user")
+	body = fmt.Sprintf(`{"name": "renamed", "parentId": %d}`, root.ID)
+	request, _, _ = th.NewRequest(http.MethodPut, body, true, stranger, map[string]string{"id": foreign.GetIDString()})
+	response, err = th.ExecuteApiCall(t, app.ApiUpdate(e.DB), request, nil)
+	assert.NoError(t, err, "ApiUpdate should not return an error")
+	assert.True(t, response.Success, "ApiUpdate should not check a parent that didn't change")
+
+	request, _, _ = th.NewRequest(http.MethodDelete, "", true, user, map[string]string{"id": root.GetIDString()})
+	response, err = th.ExecuteApiCall(t, app.ApiDelete(e.DB), request, nil)
+	assert.NoError(t, err, "ApiDelete should not return an error")
+	assert.False(t, response.Success, "ApiDelete should not change records of other users")
+
+	err = e.DB.DB.Delete(&foreign).Error
+	assert.NoError(t, err, "Delete should not return an error")
+
+	t.Log("Deleting the child")
+	request, _, _ = th.NewRequest(http.MethodDelete, "", true, user, map[string]string{"id": child.GetIDString()})
+	response, err = th.ExecuteApiCall(t, app.ApiDelete(e.DB), request, nil)
+	assert.NoError(t, err, "ApiDelete should not return an error")
+	assert.True(t, response.Success, "ApiDelete should return a success response")
+
+	request, _, _ = th.NewRequest(http.MethodGet, "", true, user, map[string]string{"id": other.GetIDString()})
+
+	var children []MockTreeStruct
+	_, err = th.ExecuteApiCall(t, app.ApiChildren(e.DB), request, &children)
+	assert.NoError(t, err, "ApiChildren should not return an error")
+	assert.Equal(t, 1, len(children), "The grandchild should be re-parented")
+	assert.Equal(t, grandchild.ID, children[0].ID, "The grandchild should be re-parented")
+}
@@ -0,0 +1,516 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/invopop/jsonschema"
+	"gorm.io/gorm"
+)
+
+const (
+	TypeScriptModelsFilePath = "typescript/models.ts"
+	TypeScriptClientFilePath = "typescript/client.ts"
+)
+
+// tsReserved are the names of the types of the generated client, which can't be used by the models.
+var tsReserved = map[string]bool{
+	"ApiResponse":   true,
+	"ApiError":      true,
+	"Pagination":    true,
+	"ListOptions":   true,
+	"ClientOptions": true,
+	"TokenSource":   true,
+	"Query":         true,
+	"Client":        true,
+}
+
+var tsIdentifierRegex = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsReturnTypes are the data returned by the routes of the Apps, by route name suffix, where
+// %s is the model of the App.
+var tsReturnTypes = map[string]string{
+	"list":        "%s[]",
+	"get":         "%s",
+	"get-by-slug": "%s",
+	"new":         "%s",
+	"update":      "%s",
+	"patch":       "%s",
+	"revert":      "%s",
+	"children":    "%s[]",
+	"descendants": "%s[]",
+	"ancestors":   "%s[]",
+}
+
+// escapeTsComment escapes the end of comment in the given text, so it can't close the comment.
+func escapeTsComment(text string) string {
+	return strings.ReplaceAll(text, "*/", "*\\/")
+}
+
+// tsComment returns the given text as a JSDoc comment with the given indentation, on a single
+// line if the text has one.
+func tsComment(text string, indent string) string {
+	lines := commentLines(escapeTsComment(text))
+	if len(lines) == 1 {
+		return indent + "/** " + lines[0] + " */\n"
+	}
+
+	var comment strings.Builder
+	comment.WriteString(indent + "/**\n")
+	for _, line := range lines {
+		comment.WriteString(strings.TrimRight(indent+" * "+line, " ") + "\n")
+	}
+	comment.WriteString(indent + " */\n")
+	return comment.String()
+}
+
+// tsProperty returns the key of a property of an interface, quoted if it is not an identifier.
+func tsProperty(name string) string {
+	if tsIdentifierRegex.MatchString(name) {
+		return name
+	}
+	data, _ := json.Marshal(name)
+	return string(data)
+}
+
+// tsCamelCase returns the camelCase identifier of the given name, e.g. posts-list is postsList.
+func tsCamelCase(name string) string {
+	output := ""
+	for _, part := range goIdentifierRegex.Split(name, -1) {
+		output += upperFirst(part)
+	}
+	return lowerFirst(output)
+}
+
+// tsGenerator builds the TypeScript interfaces from the JSON schemas of the Apps.
+type tsGenerator struct {
+	types map[string]string // Source of the interfaces by name
+	names map[string]string // TypeScript names of the definitions by definition name
+}
+
+// typeName returns the TypeScript name of the given definition, which is renamed if it is reserved.
+func (g *tsGenerator) typeName(name string) string {
+	if tsName, ok := g.names[name]; ok {
+		return tsName
+	}
+
+	tsName := goIdentifier(name)
+	if tsReserved[tsName] {
+		tsName += "Record"
+	}
+	g.names[name] = tsName
+	return tsName
+}
+
+// tsType returns the TypeScript type of the given JSON schema, and adds the interfaces it needs.
+func (g *tsGenerator) tsType(name string, schema *jsonschema.Schema, defs jsonschema.Definitions) string {
+	if schema.Ref != "" {
+		defName := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		definition, ok := defs[defName]
+		if !ok {
+			return "unknown"
+		}
+		output := g.tsType(defName, definition, defs)
+		// references are pointers in the models, so they may be null
+		if definition.Type == "object" && definition.Properties != nil && definition.Properties.Len() > 0 {
+			output += " | null"
+		}
+		return output
+	}
+
+	switch schema.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		if schema.Items == nil {
+			return "unknown[]"
+		}
+		item := g.tsType(name, schema.Items, defs)
+		if strings.Contains(item, " ") {
+			return "(" + item + ")[]"
+		}
+		return item + "[]"
+	case "object":
+		if schema.Properties == nil || schema.Properties.Len() == 0 {
+			return "Record<string, unknown>"
+		}
+		return g.addInterface(name, schema, defs)
+	}
+
+	return "unknown"
+}
+
+// addInterface adds the interface of the given JSON schema object, and returns its name.
+func (g *tsGenerator) addInterface(name string, schema *jsonschema.Schema, defs jsonschema.Definitions) string {
+	tsName := g.typeName(name)
+	if _, ok := g.types[tsName]; ok {
+		return tsName
+	}
+	// reserve the name first, so recursive types end
+	g.types[tsName] = ""
+
+	var source strings.Builder
+	fmt.Fprintf(&source, "/** %s is a record of %s. */\n", tsName, name)
+	fmt.Fprintf(&source, "export interface %s {\n", tsName)
+
+	for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		fieldType := g.tsType(tsName+goIdentifier(pair.Key), pair.Value, defs)
+		if pair.Value.Description != "" {
+			source.WriteString(tsComment(pair.Value.Description, "  "))
+		}
+		readOnly := ""
+		if pair.Value.ReadOnly {
+			readOnly = "readonly "
+		}
+		fmt.Fprintf(&source, "  %s%s: %s;\n", readOnly, tsProperty(pair.Key), fieldType)
+	}
+	source.WriteString("}\n")
+
+	g.types[tsName] = source.String()
+	return tsName
+}
+
+// tsRoute is a route in the generated client.
+type tsRoute struct {
+	Name     string // Name of the function
+	Method   string
+	Path     string   // Path as a template literal, with the variables read from params
+	Params   []string // Variables of the path
+	Body     string   // Type of the body, if the method sends one
+	Required bool     // Whether the body is required
+	Query    string   // Type of the query parameters
+	Returns  string   // Type of the data of the response
+}
+
+// newTsRoute returns the route of the client of the given path.
+func newTsRoute(name string, method string, path string) tsRoute {
+	route := tsRoute{
+		Name:    name,
+		Method:  method,
+		Query:   "Query",
+		Returns: "unknown",
+		Params:  make([]string, 0),
+	}
+	if route.Method == "" {
+		route.Method = "GET"
+	}
+
+	for _, match := range openAPIPathParamPattern.FindAllStringSubmatch(path, -1) {
+		route.Params = append(route.Params, match[1])
+	}
+
+	// the variables are read from params and escaped, e.g. /api/posts/${param(params, "id")}
+	escaped := strings.NewReplacer("`", "\\`", "${", "\\${").Replace(path)
+	route.Path = openAPIPathParamPattern.ReplaceAllString(escaped, `${param(params, "$1")}`)
+
+	switch route.Method {
+	case "POST", "PUT", "PATCH":
+		route.Body = "unknown"
+	}
+
+	return route
+}
+
+// GetTypeScriptModels returns the source of a TypeScript module with an interface for the model
+// of each App, built from the same JSON schema as the /schema routes, and the input type of its
+// create and update requests.
+func (b *Builder) GetTypeScriptModels() (string, error) {
+	models, _, err := b.getTypeScript()
+	return models, err
+}
+
+// GetTypeScriptClient returns the source of a TypeScript module with a typed fetch client of
+// every route of the server, which imports the models from ./models, see GetTypeScriptModels.
+//
+// The functions are named after the routes, e.g. postsList for posts-list, and take the
+// variables of the path, the body and the query parameters.
+func (b *Builder) GetTypeScriptClient() (string, error) {
+	_, client, err := b.getTypeScript()
+	return client, err
+}
+
+// getTypeScript returns the source of the models and the client modules.
+func (b *Builder) getTypeScript() (string, string, error) {
+	g := &tsGenerator{
+		types: make(map[string]string),
+		names: make(map[string]string),
+	}
+
+	apps := b.Admin.GetApps()
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name() < apps[j].Name()
+	})
+
+	routes := b.Server.GetRoutes()
+	params := &RequestParameters{}
+
+	clientRoutes := make([]tsRoute, 0)
+	appRoutes := make(map[string]bool)
+	usedNames := make(map[string]bool)
+	inputs := make([]string, 0)
+	imports := make([]string, 0)
+
+	for _, app := range apps {
+		schema := app.GetSchema()
+		defName := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		definition, ok := schema.Definitions[defName]
+		if !ok || definition.Properties == nil {
+			continue
+		}
+
+		name := g.addInterface(defName, definition, schema.Definitions)
+		input := name + "Input"
+
+		var db *gorm.DB
+		if database := app.getDatabase(); database != nil {
+			db = database.DB
+		}
+		fields := make([]string, 0)
+		for _, field := range app.GetInputFields(db) {
+			data, _ := json.Marshal(field)
+			fields = append(fields, string(data))
+		}
+		if len(fields) == 0 {
+			fields = append(fields, "never")
+		}
+		inputs = append(inputs, fmt.Sprintf("/** %s is the body of the create and update requests of %s. */\nexport type %s = Partial<Pick<%s, %s>>;\n",
+			input, app.Name(), input, name, strings.Join(fields, " | ")))
+		imports = append(imports, name, input)
+
+		info := app.GetInfo(routes, params, "")
+		suffixes := make([]string, 0, len(info.Endpoints))
+		for suffix := range info.Endpoints {
+			suffixes = append(suffixes, suffix)
+		}
+		sort.Strings(suffixes)
+
+		for _, suffix := range suffixes {
+			endpoint := info.Endpoints[suffix]
+			appRoutes[endpoint.Path] = true
+
+			route := newTsRoute(tsCamelCase(app.KebabPluralName()+"-"+suffix), endpoint.Method, endpoint.Path)
+			if usedNames[route.Name] {
+				continue
+			}
+			usedNames[route.Name] = true
+
+			if returns, ok := tsReturnTypes[suffix]; ok {
+				route.Returns = fmt.Sprintf(returns, name)
+			}
+			switch suffix {
+			case "list":
+				route.Query = "ListOptions"
+			case "new", "update", "patch":
+				route.Body = input
+				route.Required = true
+			}
+
+			clientRoutes = append(clientRoutes, route)
+		}
+	}
+
+	for _, route := range routes {
+		path := route.Route
+		if route.RequiresAuth {
+			path = privatePrefix + path
+		}
+		name := tsCamelCase(route.Name)
+		if route.Name == "" || route.Legacy || appRoutes[path] || usedNames[name] || !isEnvelopeRoute(route.Route) {
+			continue
+		}
+		usedNames[name] = true
+		clientRoutes = append(clientRoutes, newTsRoute(name, route.Method, path))
+	}
+
+	typeNames := make([]string, 0, len(g.types))
+	for name := range g.types {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+
+	var models strings.Builder
+	models.WriteString("// Code generated by cms-builder. DO NOT EDIT.\n")
+	for _, name := range typeNames {
+		models.WriteString("\n" + g.types[name])
+	}
+	for _, input := range inputs {
+		models.WriteString("\n" + input)
+	}
+
+	var client bytes.Buffer
+	err := tsClientTemplate.Execute(&client, map[string]interface{}{
+		"Title":   escapeTsComment(strings.Join(commentLines(GetAppName()), " ")),
+		"Imports": imports,
+		"Routes":  clientRoutes,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return models.String(), client.String(), nil
+}
+
+// ExportTypeScript writes the TypeScript models and client of the API to
+// TypeScriptModelsFilePath and TypeScriptClientFilePath, see GetTypeScriptClient.
+func (b *Builder) ExportTypeScript() error {
+	models, client, err := b.getTypeScript()
+	if err != nil {
+		return err
+	}
+
+	for filePath, source := range map[string]string{
+		TypeScriptModelsFilePath: models,
+		TypeScriptClientFilePath: client,
+	} {
+		err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filePath, []byte(source), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tsClientTemplate is the source of the generated client.
+var tsClientTemplate = template.Must(template.New("client").Parse(`// Code generated by cms-builder. DO NOT EDIT.
+{{- if .Imports}}
+
+import type {
+{{- range .Imports}}
+  {{.}},
+{{- end}}
+} from "./models";
+{{- end}}
+
+/** Pagination is the page of the records returned by the lists. */
+export interface Pagination {
+  total: number;
+  page: number;
+  limit: number;
+}
+
+/** ApiResponse is the envelope of the responses of the {{.Title}} API. */
+export interface ApiResponse<T> {
+  success: boolean;
+  data: T;
+  message: string;
+  pagination: Pagination | null;
+}
+
+/** ApiError is thrown when the API responds with an error. */
+export class ApiError extends Error {
+  constructor(
+    public readonly status: number,
+    message: string,
+    public readonly data: unknown = null,
+  ) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+/** Query are the query parameters of a request. */
+export type Query = Record<string, string | number | boolean | undefined>;
+
+/** ListOptions are the parameters of the lists, and the values of the list filters. */
+export interface ListOptions {
+  page?: number;
+  limit?: number;
+  order?: string;
+  search?: string;
+  locale?: string;
+  tag?: string;
+  category?: string;
+  [filter: string]: string | number | boolean | undefined;
+}
+
+/** TokenSource returns the token sent in the Authorization header of the requests. */
+export type TokenSource = () => string | null | undefined | Promise<string | null | undefined>;
+
+/** ClientOptions configure the client. */
+export interface ClientOptions {
+  /** Base url of the API, e.g. https://cms.example.com */
+  baseUrl: string;
+  token?: TokenSource;
+  fetch?: typeof fetch;
+}
+
+type Params = Record<string, string | number>;
+
+const param = (params: Params, name: string): string => encodeURIComponent(String(params[name]));
+
+/** createClient returns a client with a function for each route of the {{.Title}} API. */
+export const createClient = (options: ClientOptions) => {
+  const baseUrl = options.baseUrl.replace(/\/$/, "");
+  const doFetch = options.fetch ?? fetch;
+
+  const request = async <T>(method: string, path: string, query?: Query, body?: unknown): Promise<ApiResponse<T>> => {
+    const url = new URL(baseUrl + path);
+    for (const [key, value] of Object.entries(query ?? {})) {
+      if (value !== undefined) {
+        url.searchParams.set(key, String(value));
+      }
+    }
+
+    const headers: Record<string, string> = {};
+    const token = options.token ? await options.token() : null;
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+
+    let payload: BodyInit | undefined;
+    if (body instanceof FormData) {
+      payload = body;
+    } else if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+      payload = JSON.stringify(body);
+    }
+
+    const response = await doFetch(url.toString(), { method, headers, body: payload });
+    const text = await response.text();
+
+    let envelope: ApiResponse<T>;
+    try {
+      envelope = JSON.parse(text);
+    } catch {
+      if (!response.ok) {
+        throw new ApiError(response.status, text);
+      }
+      throw new ApiError(response.status, "Invalid response");
+    }
+
+    if (!response.ok || !envelope.success) {
+      throw new ApiError(response.status, envelope.message, envelope.data);
+    }
+
+    return envelope;
+  };
+
+  return {
+    request,
+{{- range .Routes}}
+    {{.Name}}: ({{if .Params}}params: { {{range $i, $p := .Params}}{{if $i}}; {{end}}"{{$p}}": string | number{{end}} }, {{end}}{{if .Body}}body{{if not .Required}}?{{end}}: {{.Body}}, {{end}}query?: {{.Query}}) =>
+      request<{{.Returns}}>("{{.Method}}", ` + "`{{.Path}}`" + `, query{{if .Body}}, body{{end}}),
+{{- end}}
+  };
+};
+
+/** Client is the client returned by createClient. */
+export type Client = ReturnType<typeof createClient>;
+`))
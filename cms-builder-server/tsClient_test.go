@@ -0,0 +1,57 @@
+package builder_test
+
+import (
+	"os"
+	"testing"
+
+	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
+	th "github.com/frangdelsolar/cms-builder/cms-builder-server/test_helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockTypeScriptStruct struct {
+	*builder.SystemData
+	Title   string   `json:"title"`
+	Tags    []string `json:"tags" gorm:"serializer:json"`
+	Summary string   `json:"summary" jsonschema_description:"Plain text, no */ or HTML.\nUp to 200 characters."`
+}
+
+// TestGetTypeScript tests that the models of the Apps are typed, and that the client has a
+// function for their routes.
+func TestGetTypeScript(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	app, err := e.Admin.Register(&MockTypeScriptStruct{}, false, builder.RolePermissionMap{
+		builder.VisitorRole: builder.AllAllowedAccess,
+	})
+	assert.NoError(t, err, "Register should not return an error")
+	defer e.Admin.Unregister(app.Name())
+
+	models, err := e.Engine.GetTypeScriptModels()
+	assert.NoError(t, err, "GetTypeScriptModels should not return an error")
+	assert.Contains(t, models, "export interface MockTypeScriptStruct {")
+	assert.Contains(t, models, "  tags: string[];")
+	assert.Contains(t, models, "  /**\n   * Plain text, no *\\/ or HTML.\n   * Up to 200 characters.\n   */\n", "Descriptions should not close the comment")
+	assert.Contains(t, models, `export type MockTypeScriptStructInput = Partial<Pick<MockTypeScriptStruct, "title" | "tags" | "summary">>;`)
+
+	client, err := e.Engine.GetTypeScriptClient()
+	assert.NoError(t, err, "GetTypeScriptClient should not return an error")
+	assert.Contains(t, client, "mockTypeScriptStructsList: (query?: ListOptions) =>")
+	assert.Contains(t, client, "mockTypeScriptStructsUpdate: (params: { \"id\": string | number }, body: MockTypeScriptStructInput, query?: Query) =>")
+	assert.Contains(t, client, "request<MockTypeScriptStruct>(\"PUT\", `/private/api/"+app.KebabPluralName()+"/${param(params, \"id\")}`, query, body)")
+}
+
+// TestExportTypeScript tests that the models and the client are written to their files.
+func TestExportTypeScript(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	err = e.Engine.ExportTypeScript()
+	assert.NoError(t, err, "ExportTypeScript should not return an error")
+	defer os.Remove(builder.TypeScriptModelsFilePath)
+	defer os.Remove(builder.TypeScriptClientFilePath)
+
+	assert.FileExists(t, builder.TypeScriptModelsFilePath, "TypeScriptModelsFilePath should exist")
+	assert.FileExists(t, builder.TypeScriptClientFilePath, "TypeScriptClientFilePath should exist")
+}
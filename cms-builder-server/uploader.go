@@ -3,19 +3,24 @@ package builder
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"path"
 	"strconv"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type FileData struct {
 	*SystemData
-	Name string `json:"name"`
-	Path string `json:"path"` // relative path
-	Url  string `json:"url"`  // absolute path
+	Name        string `json:"name"`
+	Path        string `json:"path"` // relative path
+	Url         string `json:"url"`  // absolute path
+	Size        int64  `json:"size"` // bytes
+	ContentType string `json:"contentType"`
 }
 
 type Upload struct {
@@ -41,12 +46,6 @@ func (b *Builder) GetFilePostHandler(cfg *UploaderConfig) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Validate method
-		err := ValidateRequestMethod(r, http.MethodPost)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, nil, err.Error())
-			return
-		}
-
 		uploadApp, err := b.Admin.GetApp("upload")
 		if err != nil {
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
@@ -63,7 +62,7 @@ func (b *Builder) GetFilePostHandler(cfg *UploaderConfig) HandlerFunc {
 		// Parse the multipart form data
 		err = r.ParseMultipartForm(cfg.MaxSize)
 		if err != nil {
-			log.Error().Err(err).Msg("Error parsing multipart form data")
+			GetRequestLogger(r).Error().Err(err).Msg("Error parsing multipart form data")
 			SendJsonResponse(w, http.StatusBadRequest, nil, err.Error())
 			return
 		}
@@ -96,11 +95,14 @@ func (b *Builder) GetFilePostHandler(cfg *UploaderConfig) HandlerFunc {
 			handleUploadError(b.Store, fileData, w, err)
 			return
 		}
+		b.Metrics.observeUpload(getStoreType(b.Store), header.Size)
 
 		uploadRequestBody := map[string]interface{}{
-			"name": fileData.Name,
-			"path": fileData.Path,
-			"url":  fileData.Url,
+			"name":        fileData.Name,
+			"path":        fileData.Path,
+			"url":         fileData.Url,
+			"size":        header.Size,
+			"contentType": contentType,
 		}
 
 		uploadData, err := json.Marshal(uploadRequestBody)
@@ -123,20 +125,17 @@ func (b *Builder) GetFilePostHandler(cfg *UploaderConfig) HandlerFunc {
 // getUploadDeleteHandler returns a handler function that responds to DELETE
 // requests on the delete file endpoint, e.g. /file/{id}/delete.
 //
-// It will delete the file from disk and remove the record from the database.
-// If the file is not found, it will return a 404 Not Found response. If the
-// database record is not found, it will return a 500 Internal Server Error
-// response. If the file is deleted successfully, it will return a 200 OK
-// response with a message saying "File deleted successfully".
+// It will remove the upload records of the file from the database and delete the
+// file from disk. Records that reference the uploads through media fields are
+// handled with the delete policy of their field: if any of them blocks the
+// deletion, it will return a 409 Conflict response with the references and
+// nothing is deleted. Users that are not admins can only delete the files they
+// uploaded, it will return a 403 Forbidden response if any upload of the file
+// belongs to another user. If the file is deleted successfully, it will return a
+// 200 OK response with a message saying "File deleted successfully".
 func (b *Builder) GetFileDeleteHandler(cfg *UploaderConfig) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		err := ValidateRequestMethod(r, http.MethodDelete)
-		if err != nil {
-			SendJsonResponse(w, http.StatusMethodNotAllowed, err, err.Error())
-			return
-		}
-
 		file := GetQueryParam("file", r)
 
 		if file == "" {
@@ -144,8 +143,60 @@ func (b *Builder) GetFileDeleteHandler(cfg *UploaderConfig) HandlerFunc {
 			return
 		}
 
-		err = b.Store.DeleteFile(FileData{Path: file})
+		params := FormatRequestParameters(r, b)
+
+		query := b.DB.DB.Where("path = ?", file)
+
+		// users can only delete their own uploads, deleting them releases the media fields
+		// that reference them
+		if !params.IsAdmin() {
+			var foreign int64
+			err := b.DB.DB.Model(&Upload{}).
+				Where("path = ?", file).
+				Where("created_by_id <> ?", params.RequestedById).
+				Count(&foreign).Error
+			if err != nil {
+				SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+				return
+			}
+			if foreign > 0 {
+				SendJsonResponse(w, http.StatusForbidden, nil, "You are not allowed to delete this file")
+				return
+			}
+			query = query.Where("created_by_id = ?", params.RequestedById)
+		}
+
+		var uploads []Upload
+		err := query.Find(&uploads).Error
+		if err != nil {
+			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
+			return
+		}
+
+		// only admins can delete the files that have no uploads
+		if len(uploads) == 0 && !params.IsAdmin() {
+			SendJsonResponse(w, http.StatusNotFound, nil, "File not found")
+			return
+		}
+
+		// the delete policy of the media fields is applied when the records are deleted, and the
+		// file is deleted last so the records are rolled back if the store fails
+		err = b.DB.DB.Transaction(func(tx *gorm.DB) error {
+			txDb := &Database{DB: tx}
+			for i := range uploads {
+				res := txDb.Delete(&uploads[i], params.User)
+				if res.Error != nil {
+					return res.Error
+				}
+			}
+			return b.Store.DeleteFile(FileData{Path: file})
+		})
 		if err != nil {
+			var inUse *MediaInUseError
+			if errors.As(err, &inUse) {
+				SendJsonResponse(w, http.StatusConflict, inUse.References, inUse.Error())
+				return
+			}
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
@@ -164,7 +215,7 @@ func (b *Builder) GetDownloadHandler(cfg *UploaderConfig) HandlerFunc {
 		file := GetQueryParam("file", r)
 		bytes, err := b.Store.ReadFile(&FileData{Path: file})
 		if err != nil {
-			log.Error().Err(err).Msg("Error reading file")
+			GetRequestLogger(r).Error().Err(err).Msg("Error reading file")
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
@@ -180,7 +231,7 @@ func (b *Builder) GetFileInfoHandler(cfg *UploaderConfig) HandlerFunc {
 		file := GetQueryParam("file", r)
 		fileInfo, err := b.Store.GetFileInfo(&FileData{Path: file})
 		if err != nil {
-			log.Error().Err(err).Msg("Error reading file")
+			GetRequestLogger(r).Error().Err(err).Msg("Error reading file")
 			SendJsonResponse(w, http.StatusInternalServerError, nil, err.Error())
 			return
 		}
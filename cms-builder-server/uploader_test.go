@@ -2,6 +2,7 @@ package builder_test
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
 
 	builder "github.com/frangdelsolar/cms-builder/cms-builder-server"
@@ -125,3 +126,33 @@ func TestAnonymousCanNotUploadForbidden(t *testing.T) {
 
 	assert.Equal(t, result, (builder.Upload{}), "Result should be nil", result)
 }
+
+// TestFileDeleteOwnership tests that users can't delete the files uploaded by other users.
+func TestFileDeleteOwnership(t *testing.T) {
+	e, err := th.GetDefaultEngine()
+	assert.NoError(t, err, "GetDefaultEngine should not return an error")
+
+	_, owner, rollback := th.NewRequest(http.MethodDelete, "", true, nil, nil)
+	defer rollback()
+
+	upload := builder.Upload{
+		SystemData: &builder.SystemData{CreatedByID: owner.ID},
+		FileData:   &builder.FileData{Name: "owned.png", Path: "owned.png", Url: "http://localhost/owned.png", Size: 512, ContentType: "image/png"},
+	}
+	err = e.DB.DB.Create(&upload).Error
+	assert.NoError(t, err, "Creating the upload should not return an error")
+	defer e.DB.DB.Unscoped().Delete(&upload)
+
+	request, _, rollbackOther := th.NewRequest(http.MethodDelete, "", true, nil, nil)
+	defer rollbackOther()
+	request.URL = &url.URL{RawQuery: url.Values{"file": {upload.Path}}.Encode()}
+
+	response, err := th.ExecuteApiCall(t, e.Engine.GetFileDeleteHandler(&builder.UploaderConfig{}), request, nil)
+	assert.NoError(t, err, "GetFileDeleteHandler should not return an error")
+	assert.False(t, response.Success, "Deleting the file of another user should be forbidden")
+
+	var count int64
+	err = e.DB.DB.Model(&builder.Upload{}).Where("id = ?", upload.ID).Count(&count).Error
+	assert.NoError(t, err, "Counting the uploads should not return an error")
+	assert.Equal(t, int64(1), count, "The upload of the owner should be kept")
+}
@@ -24,6 +24,23 @@ func GetStructName(a interface{}) string {
 	return name
 }
 
+// ResourceNamer is implemented by models whose resource name is not the name of their struct,
+// such as the entries of content types.
+type ResourceNamer interface {
+	ResourceName() string
+}
+
+// GetResourceName returns the name of the resource of the given model. It is the name of the
+// struct, unless the model implements ResourceNamer.
+func GetResourceName(model interface{}) string {
+	if namer, ok := model.(ResourceNamer); ok {
+		if name := namer.ResourceName(); name != "" {
+			return name
+		}
+	}
+	return GetStructName(model)
+}
+
 // Pluralize returns the plural form of the given word.
 //
 // Parameters: